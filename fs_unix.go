@@ -0,0 +1,16 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// sameFilesystem reports whether a and b, which must exist, are on the same
+// filesystem, so that renaming one into the other can work. It assumes so
+// when either can't be examined.
+func sameFilesystem(a, b string) bool {
+	var sa, sb syscall.Stat_t
+	if syscall.Stat(a, &sa) != nil || syscall.Stat(b, &sb) != nil {
+		return true
+	}
+	return sa.Dev == sb.Dev
+}
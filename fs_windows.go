@@ -0,0 +1,19 @@
+//go:build windows
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// sameFilesystem reports whether a and b are on the same volume, so that
+// renaming one into the other can work.
+func sameFilesystem(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return true
+	}
+	return strings.EqualFold(filepath.VolumeName(absA), filepath.VolumeName(absB))
+}
@@ -0,0 +1,43 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+	errorLockViolation      = syscall.Errno(33)
+)
+
+// tryLockFile takes an exclusive lock on f without waiting, and reports
+// whether it got it. The lock goes away with the process.
+func tryLockFile(f *os.File) (bool, error) {
+	var overlapped syscall.Overlapped
+	ok, _, callErr := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	if ok != 0 {
+		return true, nil
+	}
+	if callErr == errorLockViolation {
+		return false, nil
+	}
+	return false, callErr
+}
+
+func unlockFile(f *os.File) error {
+	var overlapped syscall.Overlapped
+	ok, _, callErr := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	if ok == 0 {
+		return callErr
+	}
+	return nil
+}
@@ -1,18 +1,56 @@
 package main
 
 import (
+	"archive/tar"
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
 )
 
+// Build metadata, set at build time with
+// -ldflags "-X main.buildVersion=... -X main.buildCommit=... -X main.buildDate=...".
+var (
+	buildVersion = "dev"
+	buildCommit  = "dev"
+	buildDate    = "dev"
+)
+
+// updateSource is where self-update looks for releases when neither
+// --source, WORKSPACE_UPDATE_SOURCE, nor update_source is set. Teams that
+// build the tool for everyone can bake it in with
+// -ldflags "-X main.updateSource=github:org/workspace-manager".
+var updateSource = ""
+
 type StepResult struct {
 	Description string
 	Detail      string
+	Steps       []StepResult  // rendered indented under Description, e.g. per workspace
+	Duration    time.Duration // rendered as a timing column when set (new --trace)
 }
 
 type cleanupState struct {
@@ -21,6 +59,7 @@ type cleanupState struct {
 	worktreeCreated bool
 	ddevStarted     bool
 	ddevName        string
+	pauseOnError    bool
 }
 
 type ProjectType string
@@ -32,67 +71,308 @@ const (
 )
 
 func main() {
-	args := os.Args[1:]
+	removeReplacedBinary()
+	if err := run(os.Args[1:]); err != nil {
+		os.Exit(reportError(os.Stderr, err))
+	}
+}
+
+// Exit codes returned by the CLI. Anything not covered by a more specific
+// kind exits with exitFailure.
+const (
+	exitFailure        = 1
+	exitUsage          = 2
+	exitNotARepo       = 3
+	exitWorktreeExists = 4
+	exitDDEVFailed     = 5
+)
+
+var (
+	ErrUsage          = errors.New("invalid usage")
+	ErrNotARepo       = errors.New("not a workspace project")
+	ErrWorktreeExists = errors.New("worktree already exists")
+	ErrDDEVFailed     = errors.New("ddev command failed")
+)
+
+// cliError tags an error with one of the Err* kinds, which picks the exit
+// code, and with follow-up lines (usage, hints) printed after the message.
+type cliError struct {
+	kind  error
+	err   error
+	hints []string
+}
+
+func (e *cliError) Error() string { return e.err.Error() }
+
+func (e *cliError) Unwrap() []error {
+	if e.kind == nil {
+		return []error{e.err}
+	}
+	return []error{e.kind, e.err}
+}
+
+// exitStatusError passes an interactive child's exit status through as the
+// CLI's own; the child has already reported whatever went wrong.
+type exitStatusError struct {
+	code int
+}
+
+func (e exitStatusError) Error() string { return fmt.Sprintf("exit status %d", e.code) }
+
+func withKind(kind, err error, hints ...string) error {
+	return &cliError{kind: kind, err: err, hints: hints}
+}
+
+func usageError(err error, usage ...string) error {
+	return withKind(ErrUsage, err, usage...)
+}
+
+func withHints(err error, hints ...string) error {
+	return withKind(nil, err, hints...)
+}
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrUsage):
+		return exitUsage
+	case errors.Is(err, ErrNotARepo):
+		return exitNotARepo
+	case errors.Is(err, ErrWorktreeExists):
+		return exitWorktreeExists
+	case errors.Is(err, ErrDDEVFailed):
+		return exitDDEVFailed
+	}
+	return exitFailure
+}
+
+// reportError prints err and any hints attached along the way, and returns
+// the exit code for it.
+func reportError(w io.Writer, err error) int {
+	var status exitStatusError
+	if errors.As(err, &status) {
+		return status.code
+	}
+	fmt.Fprintf(w, "Error: %v\n", err)
+	for e := err; e != nil; {
+		var cerr *cliError
+		if !errors.As(e, &cerr) {
+			break
+		}
+		for _, hint := range cerr.hints {
+			fmt.Fprintln(w, hint)
+		}
+		e = cerr.err
+	}
+	return exitCode(err)
+}
 
+func run(args []string) error {
 	if len(args) == 0 {
 		printUsage()
-		os.Exit(1)
+		return usageError(errors.New("no command given"))
+	}
+
+	if err := resolveBinaries(); err != nil {
+		return err
 	}
 
 	switch args[0] {
 	case "init":
-		cmdInit(args[1:])
+		return cmdInit(args[1:])
 	case "new":
-		cmdNewFromArgs(args[1:])
+		return cmdNewFromArgs(args[1:])
 	case "remove":
-		cmdRemove(args[1:])
+		return cmdRemove(args[1:])
 	case "refresh":
-		cmdRefresh(args[1:])
+		return cmdRefresh(args[1:])
+	case "share":
+		return cmdShare(args[1:])
+	case "doctor":
+		return cmdDoctor(args[1:])
+	case "export":
+		return cmdExport(args[1:])
+	case "archive":
+		return cmdArchive(args[1:])
+	case "which":
+		return cmdWhich(args[1:])
+	case "adopt":
+		return cmdAdopt(args[1:])
+	case "mv":
+		return cmdMove(args[1:])
+	case "freeze":
+		return cmdFreeze(args[1:])
+	case "thaw":
+		return cmdThaw(args[1:])
+	case "open-db":
+		return cmdOpenDB(args[1:])
+	case "ssh":
+		return cmdSSH(args[1:])
+	case "branch":
+		return cmdBranch(args[1:])
+	case "set-head":
+		return cmdSetHead(args[1:])
+	case "stash":
+		return cmdStash(args[1:])
+	case "rebase":
+		return cmdRebase(args[1:])
+	case "duplicate":
+		return cmdDuplicate(args[1:])
+	case "config-ddev":
+		return cmdConfigDDEV(args[1:])
+	case "clean":
+		return cmdClean(args[1:])
+	case "info":
+		return cmdInfo(args[1:])
+	case "switch":
+		return cmdSwitch(args[1:])
+	case "shell-init":
+		return cmdShellInit(args[1:])
+	case "completion":
+		return cmdCompletion(args[1:])
+	case "self-update":
+		return cmdSelfUpdate(args[1:])
+	case "__complete":
+		return cmdComplete(args[1:])
+	case "fetch":
+		return cmdFetch(args[1:])
+	case "ls-remote-branches":
+		return cmdLsRemoteBranches(args[1:])
+	case "snapshot":
+		return cmdSnapshot(args[1:])
+	case "restore":
+		return cmdRestore(args[1:])
+	case "prune":
+		return cmdPrune(args[1:])
+	case "prune-docker":
+		return cmdPruneDocker(args[1:])
+	case "test-connection":
+		return cmdTestConnection(args[1:])
+	case "stop-all":
+		return cmdStopAll(args[1:])
+	case "start-all":
+		return cmdStartAll(args[1:])
 	case "list", "ls":
-		cmdList()
+		return cmdList(args[1:])
 	case "projects":
-		cmdProjects()
+		return cmdProjects()
+	case "version", "--version":
+		fmt.Printf("workspace %s (commit %s, built %s)\n", currentVersion(), buildCommit, buildDate)
 	case "--help", "-h":
 		printUsage()
-		os.Exit(0)
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", args[0])
 		printUsage()
-		os.Exit(1)
+		return usageError(fmt.Errorf("unknown command: %s", args[0]))
 	}
+	return nil
 }
 
 func printUsage() {
 	fmt.Fprintf(os.Stderr, `Usage: workspace <command> [arguments]
 
 Commands:
-  init <url> [folder]     Clone a repo into a bare-clone workspace structure
-  new [--base <branch>] <name> [identifier]
+  init [--print-layout] [--output-dir <path>] [--bare-dir <name>] [--force]
+       [--no-fetch-all | --branches <a,b>] [--min-free-space <size>]
+       [--progress-json <path>] <url> [folder]
+                           Clone a repo into a bare-clone workspace structure
+  init --from-bare <path> [folder]
+                           Build the workspace structure around an existing bare clone
+  test-connection <url>    Check that a remote is reachable before running init
+  new [--base <branch>] [--post-import-cmd <cmd>] [--quiet] [--assign-ports]
+      [--env KEY=VALUE]... [--reuse-db <workspace>]
+      [--copy-from <workspace>] [--checkout] [--pause-on-error] [--hotfix]
+      [--log | --log-file <path>] [--dir-scheme name|identifier] [--run-hooks]
+      [--naming-scheme prefix|suffix] [--wait-healthy] [--wait-timeout <duration>]
+      [--only <phases>] [--branch-prefix <prefix>]
+      [--db-file <path> | --db-prompt | --no-prompt-db] [--dry-run-db]
+      [--identifier <id> | --auto-identifier] [--open] [--print-path]
+      [--progress-json <path>] <name | --pr <number> [name]>
                            Create a new worktree + DDEV environment
-  remove [name]            Remove a worktree + DDEV environment
-  list                     List all workspaces
+  duplicate [--identifier <id>] <source> <new-name>
+                           Fork a workspace: new branch from its HEAD, copy of its DB
+  remove [--force] [--yes] [--progress-json <path>] [name...]
+                           Remove one or more worktrees + DDEV environments
+  list [--sort <key>] [--reverse] [--all] [--older-than <age>] [--all-projects]
+       [--json] [--details] [--stale]
+                           List all workspaces (sort by name, branch, or mtime)
+  prune [--older-than <age>] [--merged] [--dry-run] [--yes]
+                           Remove old and/or merged workspaces
+  prune --dangling-ddev [--dry-run] [--yes]
+                           Delete DDEV projects whose worktree is gone
   projects                 List all workspace projects in ~/Projects
+  share [name] [-- flags]  Share a workspace's DDEV site via ddev share
+  doctor [--fix] [--yes]   Check the project for common problems (and repair them)
+  export <name> [--out <file>] [--base <branch>] [--compression <level>]
+                           Bundle a worktree's patches + DB into a tar.gz
+  archive <name> [--out <file>] [--remove [--force] [--yes]]
+                           Save a worktree's files to db/archives/ as a tar.gz
+  which [--json]           Print the current workspace, branch, and project root
+  config-ddev [name] <key>=<value>... [--yes]
+                           Set scalar keys in the workspace's .ddev/config.yaml
+  ssh [name] [--service <name>]
+                           Open a shell in the workspace's web (or other) container
+  branch [--base <branch>] <name> <new-branch>
+                           Check out another branch in an existing worktree
+  rebase [name] [--onto <base>]
+                           Fetch and rebase a worktree's branch onto origin/develop
+  stash <source> <destination>
+                           Move uncommitted changes from one worktree to another
+  open-db [name] [--open]  Print the workspace's database URL, or open it in a DB GUI
+  adopt <path|branch> [identifier]
+                           Move a hand-made worktree under spaces/ and set up its DDEV
+  mv <name> <new-location>
+                           Relocate a worktree (e.g. to another disk), keeping its name
+  freeze <name> / thaw <name> [--no-start]
+                           Stop a workspace and keep bulk commands away from it, or undo that
+  clean [--db] [--logs] [--older-than <age>] [--include-default] [--dry-run] [--yes]
+                           Delete old DB dumps and logs, reporting reclaimed space
+  info [name] [--json]     Show branch, upstream, HEAD, and DDEV details for a workspace
+  switch [name]            Print a worktree's path (the project root without a name)
+  shell-init [bash|zsh|fish]
+                           Print a "ws" shell function that cd's via switch
+  completion [bash|zsh|fish]
+                           Print a tab-completion script (workspaces, --base branches)
+  version                  Print the version, commit, and build date
+  self-update [--check] [--source <source>]
+                           Install the latest release over this binary
+  fetch [--prune]          Fetch origin and report new or removed remote branches
+  ls-remote-branches [--pattern <glob>]
+                           List origin branches, marking those with a workspace
+  set-head [branch]        Point origin/HEAD at a branch (the remote's HEAD by default)
+  snapshot [name] [--label <label>] [--list]
+                           Take (or list) DDEV database snapshots of a workspace
+  restore [name] [snap]    Restore a workspace's DDEV snapshot (latest by default)
+  prune-docker [--all] [--volumes] [--yes]
+                           Reclaim Docker build cache, images, and (optionally) volumes
+  stop-all                 Stop every running workspace's DDEV project
+  start-all [--only-recent N]
+                           Start workspaces' DDEV projects (optionally N most recent)
 
 Examples:
   workspace init git@github.com:user/project.git
   workspace init git@github.com:user/project.git myproject
+  workspace init --print-layout git@github.com:user/project.git  (preview only)
+  workspace init --template-repo git@github.com:org/template.git --origin git@github.com:org/new.git
+  workspace init --from-bare /var/cache/repos/project.git project
   workspace new 0001-new-task
-  workspace new 0001-new-task t1              (custom DDEV identifier)
+  workspace new 0001-new-task --identifier t1  (custom DDEV identifier)
   workspace new --base develop 0001-new-task  (branch off develop)
   workspace remove 0001-new-task     (remove by name)
   workspace remove                   (remove current directory's worktree)
+  workspace remove 0001-a 0002-b     (remove several at once)
   workspace list                     (list all workspaces)
   workspace refresh [name]           (drop and reimport the database)
+  workspace refresh --db-file ~/Downloads/prod.sql.gz  (reimport from a specific dump)
+  workspace share [name] [-- flags]  (share via ddev share tunnel)
 `)
 }
 
 // findProjectRoot locates the project root from anywhere inside the project
 // (worktree, project root, etc.) by finding the shared git directory.
 func findProjectRoot() (string, error) {
-	cmd := exec.Command("git", "rev-parse", "--git-common-dir")
+	cmd := exec.Command(gitBin, "rev-parse", "--git-common-dir")
 	out, err := cmd.Output()
 	if err != nil {
-		return "", fmt.Errorf("not inside a git repository: %w", err)
+		return "", withKind(ErrNotARepo, fmt.Errorf("not inside a git repository: %w", err))
 	}
 
 	gitCommonDir := strings.TrimSpace(string(out))
@@ -111,735 +391,1141 @@ func findProjectRoot() (string, error) {
 		return "", fmt.Errorf("could not resolve path: %w", err)
 	}
 
-	projectRoot := filepath.Dir(gitCommonDir)
+	projectRoot := projectRootFor(gitCommonDir)
 
-	// Validate that .bare or .git exists at project root
-	if _, err := os.Stat(filepath.Join(projectRoot, ".bare")); err == nil {
-		return projectRoot, nil
+	// Validate that .git exists at the project root: either the pointer file
+	// to the bare directory (.bare unless init was given --bare-dir) or the
+	// bare repository itself.
+	if _, err := os.Stat(filepath.Join(projectRoot, ".git")); err != nil {
+		return "", withKind(ErrNotARepo, fmt.Errorf("could not find project root (no %s or .git at %s)", filepath.Base(gitCommonDir), projectRoot))
 	}
-	if _, err := os.Stat(filepath.Join(projectRoot, ".git")); err == nil {
-		return projectRoot, nil
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("could not get working directory: %w", err)
+	}
+	if err := validateProjectRoot(projectRoot, cwd); err != nil {
+		return "", withKind(ErrNotARepo, err)
+	}
+	if !pathWithin(projectRoot, cwd) {
+		fmt.Fprintf(os.Stderr, "Warning: current directory %s is outside the detected project root %s\n", cwd, projectRoot)
 	}
 
-	return "", fmt.Errorf("could not find project root (no .bare or .git at %s)", projectRoot)
+	return projectRoot, nil
 }
 
-// deriveIdentifier generates a short identifier from a worktree name.
-// It takes the first 4 characters, but if that ends with a hyphen, it
-// uses a "0" prefix plus the first 3 characters instead
-// (e.g. "123-foo" → "0123" not "123-").
-func deriveIdentifier(worktreeName string) string {
-	var id string
-	if len(worktreeName) < 4 {
-		id = worktreeName
-	} else {
-		id = worktreeName[:4]
+// projectRootKey is set in a bare repository that init --from-bare symlinked
+// into a project from another filesystem, to the project's root: git
+// resolves the symlink, so the project can't be found next to it.
+const projectRootKey = "workspace.root"
+
+// projectRootFor returns the project root for the shared git directory: its
+// parent, or the root the repository records when it is symlinked in.
+func projectRootFor(gitCommonDir string) string {
+	root := filepath.Dir(gitCommonDir)
+	if isProjectRoot(root) {
+		return root
 	}
-	if strings.HasSuffix(id, "-") {
-		id = "0" + worktreeName[:3]
+	if recorded, err := gitOutput(root, "--git-dir="+gitCommonDir, "config", "--get", projectRootKey); err == nil && recorded != "" {
+		return recorded
 	}
-	return id
+	return root
 }
 
-// extractProjectName extracts the project name from a git remote URL.
-func extractProjectName(remoteURL string) string {
-	remoteURL = strings.TrimRight(remoteURL, "/")
-	name := filepath.Base(remoteURL)
-	name = strings.TrimSuffix(name, ".git")
-	return name
+// validateProjectRoot checks that projectRoot really is a workspace project
+// (it has a spaces/ directory). The innermost repository wins when git
+// resolves the common dir, so a plain repository nested inside a worktree
+// would otherwise be mistaken for the project; in that case the error names
+// the enclosing project when one can be found above cwd.
+func validateProjectRoot(projectRoot, cwd string) error {
+	if info, err := os.Stat(filepath.Join(projectRoot, "spaces")); err == nil && info.IsDir() {
+		return nil
+	}
+
+	msg := fmt.Sprintf("%s is a git repository but not a workspace project (no spaces/ directory)", projectRoot)
+	for dir := filepath.Dir(projectRoot); ; dir = filepath.Dir(dir) {
+		if isProjectRoot(dir) && pathWithin(dir, cwd) {
+			msg += fmt.Sprintf("; it is nested inside the project at %s, run the command from outside the nested repository", dir)
+			break
+		}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	return fmt.Errorf("%s", msg)
 }
 
-func cmdInit(args []string) {
-	if len(args) < 1 || len(args) > 2 {
-		fmt.Fprintf(os.Stderr, "Error: expected 1 or 2 arguments, got %d\n", len(args))
-		fmt.Fprintf(os.Stderr, "Usage: workspace init <git-remote-url> [folder-name]\n")
-		os.Exit(1)
+// isProjectRoot reports whether dir has the .git and spaces/ entries of a
+// workspace project.
+func isProjectRoot(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return false
 	}
+	info, err := os.Stat(filepath.Join(dir, "spaces"))
+	return err == nil && info.IsDir()
+}
 
-	remoteURL := args[0]
-	var projectName string
-	if len(args) == 2 {
-		projectName = args[1]
-	} else {
-		projectName = extractProjectName(remoteURL)
+// resolveSymlinks returns path with symlinks resolved, or path itself when
+// that fails (missing paths, or shapes EvalSymlinks can't handle on Windows
+// such as some network and WSL paths).
+func resolveSymlinks(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
 	}
-	if projectName == "" {
-		fmt.Fprintf(os.Stderr, "Error: could not determine project name from URL: %s\n", remoteURL)
-		os.Exit(1)
+	return path
+}
+
+// samePath reports whether a and b name the same location, ignoring case
+// on Windows where the filesystem does.
+func samePath(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
 	}
+	return a == b
+}
 
-	cwd, err := os.Getwd()
+// pathWithin reports whether path is root or somewhere below it, comparing
+// symlink-resolved paths when possible.
+func pathWithin(root, path string) bool {
+	rel, err := filepath.Rel(resolveSymlinks(root), resolveSymlinks(path))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error getting current directory: %v\n", err)
-		os.Exit(1)
+		return false
 	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
 
-	projectDir := filepath.Join(cwd, projectName)
+// configFileName is the per-project settings file at the project root.
+const configFileName = ".workspace.yaml"
+
+// workspaceConfig holds per-project settings read from .workspace.yaml.
+type workspaceConfig struct {
+	PostImportCommand string
+	DBCompression     string
+	DirScheme         string
+	HooksDir          string
+	NamingScheme      string
+	DDEVNameTemplate  string
+	BranchPrefix      string
+	MinFreeSpace      int64
+	Confirm           string
+	DDEVDir           string
+	DefaultBase       string
+	DBDir             string
+	GitBin            string
+	DDEVBin           string
+	DockerBin         string
+	UpdateSource      string
+	CopyFiles         []string
+	ArchiveExclude    []string
+}
 
-	// Check if project directory already exists
-	if _, err := os.Stat(projectDir); err == nil {
-		fmt.Fprintf(os.Stderr, "Error: directory already exists: %s\n", projectDir)
-		os.Exit(1)
-	}
+// Confirmation modes for remove: always prompt (the default), prompt only
+// when something could be lost, or never prompt.
+const (
+	confirmAlways    = "always"
+	confirmDirtyOnly = "dirty-only"
+	confirmNever     = "never"
+)
 
-	var steps []StepResult
+func validConfirmMode(value string) bool {
+	return value == confirmAlways || value == confirmDirtyOnly || value == confirmNever
+}
 
-	// Step 1: Create project directory
-	if err := os.MkdirAll(projectDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating project directory: %v\n", err)
-		os.Exit(1)
-	}
-
-	// Step 2: Bare clone
-	fmt.Println("--- Cloning repository (bare) ---")
-	barePath := filepath.Join(projectDir, ".bare")
-	cloneCmd := exec.Command("git", "clone", "--bare", remoteURL, barePath)
-	cloneCmd.Stdout = os.Stdout
-	cloneCmd.Stderr = os.Stderr
-	if err := cloneCmd.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error cloning repository: %v\n", err)
-		cleanupInit(projectDir)
-		os.Exit(1)
-	}
-	steps = append(steps, StepResult{
-		Description: "Cloned repository (bare)",
-		Detail:      barePath,
-	})
+// DDEV project naming schemes for new: <identifier>-<name> (the default) or
+// <name>-<identifier>.
+const (
+	namingPrefix = "prefix"
+	namingSuffix = "suffix"
+)
 
-	// Step 3: Write .git file
-	gitFilePath := filepath.Join(projectDir, ".git")
-	if err := os.WriteFile(gitFilePath, []byte("gitdir: .bare\n"), 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing .git file: %v\n", err)
-		cleanupInit(projectDir)
-		os.Exit(1)
-	}
-	steps = append(steps, StepResult{
-		Description: "Created .git file",
-		Detail:      gitFilePath,
-	})
+func validNamingScheme(value string) bool {
+	return value == namingPrefix || value == namingSuffix
+}
 
-	// Step 4: Reconfigure fetch refspec
-	configCmd := exec.Command("git", "config", "remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*")
-	configCmd.Dir = projectDir
-	if err := configCmd.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error configuring fetch refspec: %v\n", err)
-		cleanupInit(projectDir)
-		os.Exit(1)
+// composeDDEVName builds a workspace's DDEV project name from the identifier
+// and the project's original name according to scheme.
+func composeDDEVName(identifier, originalName, scheme string) string {
+	if scheme == namingSuffix {
+		return normalizeDDEVName(originalName + "-" + identifier)
 	}
+	return normalizeDDEVName(identifier + "-" + originalName)
+}
 
-	fmt.Println("\n--- Fetching branches ---")
-	fetchCmd := exec.Command("git", "fetch", "origin")
-	fetchCmd.Dir = projectDir
-	fetchCmd.Stdout = os.Stdout
-	fetchCmd.Stderr = os.Stderr
-	if err := fetchCmd.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error fetching from origin: %v\n", err)
-		cleanupInit(projectDir)
-		os.Exit(1)
+// ddevNameData holds the values a ddev_name_template can use.
+type ddevNameData struct {
+	Identifier   string
+	OriginalName string
+	WorktreeName string
+	Branch       string
+}
+
+// parseDDEVNameTemplate parses a ddev_name_template and checks it against
+// sample values, so a misspelled field fails when the config is read rather
+// than halfway through new.
+func parseDDEVNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("ddev_name_template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
 	}
-	steps = append(steps, StepResult{
-		Description: "Configured fetch refspec",
-		Detail:      "Fetched all branches",
-	})
+	sample := ddevNameData{Identifier: "0001", OriginalName: "project", WorktreeName: "0001-task", Branch: "feature/0001-task"}
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
 
-	// Step 5: Detect default branch
-	defaultBranch := detectDefaultBranch(projectDir)
-	if defaultBranch == "" {
-		fmt.Fprintf(os.Stderr, "Error: could not detect default branch.\n")
-		fmt.Fprintf(os.Stderr, "Neither 'develop' nor 'main' branches were found on the remote.\n")
-		fmt.Fprintf(os.Stderr, "Please ensure the remote repository has a 'develop' or 'main' branch.\n")
-		cleanupInit(projectDir)
-		os.Exit(1)
+// buildDDEVName names a workspace's DDEV project. An explicit scheme (the
+// --naming-scheme flag) wins; otherwise a configured template is rendered,
+// and without one the configured scheme applies. A rendered name is
+// normalized like composeDDEVName's and must then satisfy DDEV's rules.
+func buildDDEVName(data ddevNameData, flagScheme string, config workspaceConfig) (string, error) {
+	if flagScheme != "" || config.DDEVNameTemplate == "" {
+		scheme := flagScheme
+		if scheme == "" {
+			scheme = config.NamingScheme
+		}
+		name := composeDDEVName(data.Identifier, data.OriginalName, scheme)
+		return name, validateDDEVName(name)
 	}
-	steps = append(steps, StepResult{
-		Description: "Default branch",
-		Detail:      defaultBranch,
-	})
 
-	// Step 6: Create spaces/, db/, and files/ directories, then first worktree
-	spacesDir := filepath.Join(projectDir, "spaces")
-	if err := os.MkdirAll(spacesDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating spaces directory: %v\n", err)
-		cleanupInit(projectDir)
-		os.Exit(1)
+	tmpl, err := parseDDEVNameTemplate(config.DDEVNameTemplate)
+	if err != nil {
+		return "", fmt.Errorf("ddev_name_template: %w", err)
 	}
-	dbDir := filepath.Join(projectDir, "db")
-	if err := os.MkdirAll(dbDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating db directory: %v\n", err)
-		cleanupInit(projectDir)
-		os.Exit(1)
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("ddev_name_template: %w", err)
 	}
-	filesDir := filepath.Join(projectDir, "files")
-	if err := os.MkdirAll(filesDir, 0777); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating files directory: %v\n", err)
-		cleanupInit(projectDir)
-		os.Exit(1)
+	name := normalizeDDEVName(rendered.String())
+	if err := validateDDEVName(name); err != nil {
+		return "", withHints(err, fmt.Sprintf("ddev_name_template %q rendered %q.", config.DDEVNameTemplate, rendered.String()))
 	}
+	return name, nil
+}
 
-	fmt.Println("\n--- Creating worktree ---")
-	wtPath := filepath.Join("spaces", defaultBranch)
-	wtCmd := exec.Command("git", "worktree", "add", wtPath, defaultBranch)
-	wtCmd.Dir = projectDir
-	wtCmd.Stdout = os.Stdout
-	wtCmd.Stderr = os.Stderr
-	if err := wtCmd.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating worktree: %v\n", err)
-		cleanupInit(projectDir)
-		os.Exit(1)
-	}
-	worktreeFullPath := filepath.Join(projectDir, "spaces", defaultBranch)
-	steps = append(steps, StepResult{
-		Description: "Created worktree",
-		Detail:      worktreeFullPath,
-	})
+// Worktree directory naming schemes for new: spaces/<name> (the default) or
+// spaces/<identifier>.
+const (
+	dirSchemeName       = "name"
+	dirSchemeIdentifier = "identifier"
+)
 
-	// Detect project type from DDEV config
-	projectType := getDDEVProjectType(worktreeFullPath)
-	steps = append(steps, StepResult{
-		Description: "Project type",
-		Detail:      string(projectType),
-	})
+func validDirScheme(value string) bool {
+	return value == dirSchemeName || value == dirSchemeIdentifier
+}
 
-	// Link project files
-	filesDetail, err := linkProjectFiles(worktreeFullPath, projectDir, projectType)
+// loadConfig reads .workspace.yaml from the project root. A missing file is
+// not an error and yields the default configuration.
+func loadConfig(projectRoot string) (workspaceConfig, error) {
+	config := workspaceConfig{MinFreeSpace: defaultMinFreeSpace}
+
+	path := filepath.Join(projectRoot, configFileName)
+	values, err := readConfigValues(path)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "\nWarning: failed to link project files: %v\n", err)
-		steps = append(steps, StepResult{
-			Description: "Project files",
-			Detail:      "Failed: " + err.Error(),
-		})
-	} else {
-		steps = append(steps, StepResult{
-			Description: "Project files",
-			Detail:      filesDetail,
-		})
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return config, fmt.Errorf("could not read %s: %w", path, err)
 	}
 
-	// Link Claude Code memory to share with project root
-	memDetail, memErr := linkClaudeMemory(worktreeFullPath, projectDir)
-	if memErr != nil {
-		fmt.Fprintf(os.Stderr, "\nWarning: failed to link Claude memory: %v\n", memErr)
-		steps = append(steps, StepResult{
-			Description: "Claude memory",
-			Detail:      "Failed: " + memErr.Error(),
-		})
-	} else {
-		steps = append(steps, StepResult{
-			Description: "Claude memory",
-			Detail:      memDetail,
-		})
+	if !configWarned[path] {
+		for _, warning := range unknownConfigKeyWarnings(values) {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", path, warning)
+		}
+		configWarned[path] = true
 	}
 
-	// Step 7: Check for DDEV and optionally set it up
-	ddevConfig := filepath.Join(worktreeFullPath, ".ddev", "config.yaml")
-	if _, err := os.Stat(ddevConfig); err == nil {
-		fmt.Println("\n--- Starting DDEV ---")
-		if err := runCommandLive(worktreeFullPath, "ddev", "start"); err != nil {
-			fmt.Fprintf(os.Stderr, "\nWarning: failed to start DDEV: %v\n", err)
-			steps = append(steps, StepResult{
-				Description: "DDEV",
-				Detail:      fmt.Sprintf("Failed to start: %v", err),
-			})
-		} else {
-			steps = append(steps, StepResult{
-				Description: "DDEV",
-				Detail:      "Started",
-			})
-
-			dbDetail, err := handleDBImport(worktreeFullPath, projectDir)
+	for key, value := range values {
+		switch key {
+		case "post_import_command":
+			config.PostImportCommand = value
+		case "db_compression":
+			if !validCompression(value) {
+				return config, fmt.Errorf("%s: invalid db_compression %q (expected none, fast, or best)", path, value)
+			}
+			config.DBCompression = value
+		case "dir_scheme":
+			if !validDirScheme(value) {
+				return config, fmt.Errorf("%s: invalid dir_scheme %q (expected name or identifier)", path, value)
+			}
+			config.DirScheme = value
+		case "hooks_dir":
+			config.HooksDir = value
+		case "naming_scheme":
+			if !validNamingScheme(value) {
+				return config, fmt.Errorf("%s: invalid naming_scheme %q (expected prefix or suffix)", path, value)
+			}
+			config.NamingScheme = value
+		case "ddev_name_template":
+			if _, err := parseDDEVNameTemplate(value); err != nil {
+				return config, fmt.Errorf("%s: invalid ddev_name_template: %w", path, err)
+			}
+			config.DDEVNameTemplate = value
+		case "branch_prefix":
+			config.BranchPrefix = value
+		case "min_free_space":
+			size, err := parseByteSize(value)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "\nWarning: failed to import database: %v\n", err)
-				steps = append(steps, StepResult{
-					Description: "Database",
-					Detail:      fmt.Sprintf("Failed: %v", err),
-				})
-			} else {
-				steps = append(steps, StepResult{
-					Description: "Database",
-					Detail:      dbDetail,
-				})
+				return config, fmt.Errorf("%s: invalid min_free_space %q (expected a size like 500M or 2G)", path, value)
 			}
-
-			if projectType == ProjectDrupal {
-				fmt.Println("\n--- Running composer install ---")
-				if err := runCommandLive(worktreeFullPath, "ddev", "composer", "install"); err != nil {
-					fmt.Fprintf(os.Stderr, "\nWarning: failed to run composer install: %v\n", err)
-					steps = append(steps, StepResult{
-						Description: "Composer install",
-						Detail:      fmt.Sprintf("Failed: %v", err),
-					})
-				} else {
-					steps = append(steps, StepResult{
-						Description: "Composer install",
-						Detail:      "Complete",
-					})
-				}
+			config.MinFreeSpace = size
+		case "confirm":
+			if !validConfirmMode(value) {
+				return config, fmt.Errorf("%s: invalid confirm %q (expected always, dirty-only, or never)", path, value)
+			}
+			config.Confirm = value
+		case "ddev_dir":
+			clean := filepath.Clean(filepath.FromSlash(value))
+			if filepath.IsAbs(clean) || strings.HasPrefix(clean, string(filepath.Separator)) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+				return config, fmt.Errorf("%s: invalid ddev_dir %q (expected a path inside the worktree)", path, value)
+			}
+			config.DDEVDir = clean
+		case "default_base":
+			config.DefaultBase = value
+		case "db_dir":
+			config.DBDir = value
+		case "git_bin":
+			config.GitBin = value
+		case "ddev_bin":
+			config.DDEVBin = value
+		case "docker_bin":
+			config.DockerBin = value
+		case "update_source":
+			config.UpdateSource = value
+		case "copy_files":
+			patterns, err := parsePathPatterns(value)
+			if err != nil {
+				return config, fmt.Errorf("%s: invalid copy_files: %w", path, err)
+			}
+			config.CopyFiles = patterns
+		case "archive_exclude":
+			patterns, err := parsePathPatterns(value)
+			if err != nil {
+				return config, fmt.Errorf("%s: invalid archive_exclude: %w", path, err)
 			}
+			config.ArchiveExclude = patterns
 		}
-	} else {
-		steps = append(steps, StepResult{
-			Description: "DDEV",
-			Detail:      "Skipped (no .ddev/config.yaml found)",
-		})
 	}
+	if config.NamingScheme != "" && config.DDEVNameTemplate != "" {
+		return config, fmt.Errorf("%s: naming_scheme and ddev_name_template cannot both be set", path)
+	}
+	return config, nil
+}
 
-	// Done
-	fmt.Println()
-	printSummary(steps)
+// configKeys are the keys loadConfig understands; anything else in
+// .workspace.yaml is reported as a likely typo.
+var configKeys = []string{
+	"post_import_command",
+	"db_compression",
+	"dir_scheme",
+	"hooks_dir",
+	"naming_scheme",
+	"ddev_name_template",
+	"branch_prefix",
+	"min_free_space",
+	"confirm",
+	"ddev_dir",
+	"default_base",
+	"db_dir",
+	"git_bin",
+	"ddev_bin",
+	"docker_bin",
+	"update_source",
+	"copy_files",
+	"archive_exclude",
 }
 
-func detectDefaultBranch(projectDir string) string {
-	// Prefer develop, fall back to main
-	for _, branch := range []string{"develop", "main"} {
-		cmd := exec.Command("git", "rev-parse", "--verify", "refs/remotes/origin/"+branch)
-		cmd.Dir = projectDir
-		if err := cmd.Run(); err == nil {
-			return branch
+// configWarned records the config files whose unknown keys were already
+// reported, since a command may load the same file more than once.
+var configWarned = make(map[string]bool)
+
+// unknownConfigKeyWarnings describes each key in values that isn't in
+// configKeys, suggesting the closest known key when it is only a typo away.
+func unknownConfigKeyWarnings(values map[string]string) []string {
+	var unknown []string
+	for key := range values {
+		known := false
+		for _, k := range configKeys {
+			if key == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			unknown = append(unknown, key)
 		}
 	}
+	sort.Strings(unknown)
 
-	return ""
+	var warnings []string
+	for _, key := range unknown {
+		warning := fmt.Sprintf("unknown key %q is ignored", key)
+		if suggestion := closestConfigKey(key); suggestion != "" {
+			warning += fmt.Sprintf(" (did you mean %q?)", suggestion)
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings
 }
 
-func cleanupInit(projectDir string) {
-	fmt.Fprintf(os.Stderr, "\n--- Cleaning up ---\n")
-	fmt.Fprintf(os.Stderr, "Removing project directory %s...\n", projectDir)
-	if err := os.RemoveAll(projectDir); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to remove project directory: %v\n", err)
+// closestConfigKey returns the known key nearest to key by edit distance,
+// or "" when none is close enough to be a plausible typo.
+func closestConfigKey(key string) string {
+	best, bestDist := "", len(key)/3+2
+	for _, k := range configKeys {
+		if d := levenshtein(key, k); d < bestDist {
+			best, bestDist = k, d
+		}
 	}
-	fmt.Fprintf(os.Stderr, "Cleanup complete.\n")
+	return best
 }
 
-type worktreeEntry struct {
-	path   string
-	branch string
-	isBare bool
-}
-
-// parseWorktreeList parses the output of `git worktree list --porcelain`
-// into a slice of worktreeEntry structs.
-func parseWorktreeList(output string) []worktreeEntry {
-	var entries []worktreeEntry
-	var current worktreeEntry
-	inEntry := false
-
-	for _, line := range strings.Split(output, "\n") {
-		if strings.HasPrefix(line, "worktree ") {
-			if inEntry {
-				entries = append(entries, current)
-			}
-			current = worktreeEntry{path: strings.TrimPrefix(line, "worktree ")}
-			inEntry = true
-		} else if line == "bare" {
-			current.isBare = true
-		} else if strings.HasPrefix(line, "branch ") {
-			ref := strings.TrimPrefix(line, "branch ")
-			current.branch = strings.TrimPrefix(ref, "refs/heads/")
-		} else if line == "" {
-			if inEntry {
-				entries = append(entries, current)
-				current = worktreeEntry{}
-				inEntry = false
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
 			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
 		}
+		prev, cur = cur, prev
 	}
-	// Handle last entry if output doesn't end with a blank line
-	if inEntry {
-		entries = append(entries, current)
-	}
-
-	return entries
+	return prev[len(b)]
 }
 
-func cmdProjects() {
-	homeDir, err := os.UserHomeDir()
+// dbDir returns the directory holding the project's database dumps: db_dir
+// from .workspace.yaml (absolute, ~/-relative, or relative to the project
+// root) or <projectRoot>/db.
+func dbDir(projectRoot string) (string, error) {
+	config, err := loadConfig(projectRoot)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: could not determine home directory: %v\n", err)
-		os.Exit(1)
+		return "", err
 	}
-
-	projectsDir := filepath.Join(homeDir, "Projects")
-	entries, err := os.ReadDir(projectsDir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			fmt.Println("No ~/Projects directory found.")
-			return
-		}
-		fmt.Fprintf(os.Stderr, "Error reading ~/Projects: %v\n", err)
-		os.Exit(1)
+	dir := expandHome(config.DBDir)
+	switch {
+	case dir == "":
+		return filepath.Join(projectRoot, "db"), nil
+	case !filepath.IsAbs(dir):
+		return filepath.Join(projectRoot, dir), nil
 	}
+	return filepath.Clean(dir), nil
+}
 
-	type worktreeInfo struct {
-		name   string
-		branch string
+// expandHome replaces a leading ~ or ~/ in path with the home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
 	}
-
-	type projectInfo struct {
-		name       string
-		path       string
-		worktrees  []worktreeInfo
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
 	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
 
-	var projects []projectInfo
+// Binaries the tool runs. Each can point somewhere off PATH (e.g. asdf or
+// mise shims that cron doesn't see); see resolveBinaries.
+var (
+	gitBin    = "git"
+	ddevBin   = "ddev"
+	dockerBin = "docker"
+)
 
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+// resolveBinaries applies the WORKSPACE_GIT_BIN, WORKSPACE_DDEV_BIN, and
+// WORKSPACE_DOCKER_BIN environment variables, or else the git_bin, ddev_bin,
+// and docker_bin keys of the enclosing project's .workspace.yaml, resolving
+// each with exec.LookPath. Binaries that aren't overridden stay bare names,
+// looked up on PATH when they are run.
+func resolveBinaries() error {
+	var config workspaceConfig
+	if root := enclosingProjectRoot(); root != "" {
+		// Commands that use the config report its errors themselves
+		config, _ = loadConfig(root)
+	}
+	binaries := []struct {
+		key, env, configured string
+		target               *string
+	}{
+		{"git_bin", "WORKSPACE_GIT_BIN", config.GitBin, &gitBin},
+		{"ddev_bin", "WORKSPACE_DDEV_BIN", config.DDEVBin, &ddevBin},
+		{"docker_bin", "WORKSPACE_DOCKER_BIN", config.DockerBin, &dockerBin},
+	}
+	for _, bin := range binaries {
+		value, source := os.Getenv(bin.env), bin.env
+		if value == "" {
+			value, source = bin.configured, bin.key+" in .workspace.yaml"
 		}
-
-		dirPath := filepath.Join(projectsDir, entry.Name())
-		spacesDir := filepath.Join(dirPath, "spaces")
-
-		if info, err := os.Stat(spacesDir); err != nil || !info.IsDir() {
+		if value == "" {
 			continue
 		}
-
-		// Run git worktree list --porcelain
-		cmd := exec.Command("git", "worktree", "list", "--porcelain")
-		cmd.Dir = dirPath
-		out, err := cmd.Output()
+		path, err := exec.LookPath(expandHome(value))
 		if err != nil {
-			continue
-		}
-
-		var worktrees []worktreeInfo
-		for _, entry := range parseWorktreeList(string(out)) {
-			if !entry.isBare && strings.HasPrefix(entry.path, spacesDir+string(filepath.Separator)) {
-				name := strings.TrimPrefix(entry.path, spacesDir+string(filepath.Separator))
-				worktrees = append(worktrees, worktreeInfo{name: name, branch: entry.branch})
-			}
+			return withHints(fmt.Errorf("%s is set to %q, which can't be run: %w", source, value, err),
+				"Set it to the binary's absolute path, or unset it to use "+filepath.Base(*bin.target)+" from PATH.")
 		}
-
-		projects = append(projects, projectInfo{
-			name:      entry.Name(),
-			path:      dirPath,
-			worktrees: worktrees,
-		})
+		*bin.target = path
 	}
+	return nil
+}
 
-	if len(projects) == 0 {
-		fmt.Println("No workspace projects found in ~/Projects.")
-		return
+// enclosingProjectRoot returns the nearest directory at or above cwd that
+// looks like a project root, or "" when there is none. Unlike
+// findProjectRoot it doesn't run git, whose binary may not be resolved yet.
+func enclosingProjectRoot() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
 	}
-
-	for i, proj := range projects {
-		fmt.Printf("%s (~/Projects/%s)\n", proj.name, proj.name)
-
-		if len(proj.worktrees) == 0 {
-			fmt.Println("  (no worktrees)")
-		} else {
-			maxName := 0
-			for _, wt := range proj.worktrees {
-				if len(wt.name) > maxName {
-					maxName = len(wt.name)
-				}
-			}
-			for _, wt := range proj.worktrees {
-				if wt.branch != "" {
-					fmt.Printf("  %-*s  (%s)\n", maxName, wt.name, wt.branch)
-				} else {
-					fmt.Printf("  %-*s  (detached)\n", maxName, wt.name)
-				}
-			}
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		if isProjectRoot(dir) {
+			return dir
+		}
+		if dir == filepath.Dir(dir) {
+			return ""
 		}
+	}
+}
 
-		if i < len(projects)-1 {
-			fmt.Println()
+// defaultMinFreeSpace is how much free disk space init and database imports
+// want before they start, unless configured otherwise.
+const defaultMinFreeSpace = 2 << 30
+
+// parseByteSize parses a size such as "2G", "500M", "1.5GB" or a plain byte
+// count. Units are powers of 1024.
+func parseByteSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(s, "B")
+	multiplier := int64(1)
+	if s != "" {
+		if i := strings.IndexByte("KMGT", s[len(s)-1]); i >= 0 {
+			multiplier = int64(1) << (10 * (i + 1))
+			s = s[:len(s)-1]
 		}
 	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(n * float64(multiplier)), nil
 }
 
-func cmdList() {
-	projectRoot, err := findProjectRoot()
+// checkFreeSpace fails when the filesystem that holds (or will hold) path has
+// less than needed bytes available, so an operation stops before filling the
+// disk halfway through. A zero need disables the check, and free space that
+// cannot be read only produces a warning.
+func checkFreeSpace(path string, needed int64, operation string) error {
+	if needed <= 0 {
+		return nil
+	}
+	dir := path
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	free, err := freeDiskSpace(dir)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Warning: could not check free disk space in %s: %v\n", dir, err)
+		return nil
 	}
+	if free < needed {
+		return fmt.Errorf("not enough disk space for %s in %s: %s free, %s needed", operation, dir, formatBytes(free), formatBytes(needed))
+	}
+	return nil
+}
 
-	// Detect project type from DDEV config
-	projectType := detectProjectType(projectRoot)
-	_ = projectType
-
-	cmd := exec.Command("git", "worktree", "list", "--porcelain")
-	cmd.Dir = projectRoot
-	out, err := cmd.Output()
+// readConfigValues reads a flat "key: value" YAML file. Blank lines and
+// comments are skipped and surrounding quotes are stripped from values.
+func readConfigValues(path string) (map[string]string, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error listing worktrees: %v\n", err)
-		os.Exit(1)
+		return nil, err
 	}
+	defer f.Close()
 
-	spacesDir := filepath.Join(projectRoot, "spaces")
-
-	type workspace struct {
-		name   string
-		branch string
-		path   string
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
 	}
+	return values, nil
+}
 
-	var workspaces []workspace
-	for _, entry := range parseWorktreeList(string(out)) {
-		if !entry.isBare && strings.HasPrefix(entry.path, spacesDir+string(filepath.Separator)) {
-			name := strings.TrimPrefix(entry.path, spacesDir+string(filepath.Separator))
-			workspaces = append(workspaces, workspace{
-				name:   name,
-				branch: entry.branch,
-				path:   entry.path,
-			})
-		}
+// deriveIdentifier generates a short identifier from a worktree name.
+// It takes the first 4 characters, but if that ends with a hyphen, it
+// uses a "0" prefix plus the first 3 characters instead
+// (e.g. "123-foo" → "0123" not "123-").
+func deriveIdentifier(worktreeName string) string {
+	var id string
+	if len(worktreeName) < 4 {
+		id = worktreeName
+	} else {
+		id = worktreeName[:4]
 	}
+	if strings.HasSuffix(id, "-") {
+		id = "0" + worktreeName[:3]
+	}
+	return id
+}
 
-	if len(workspaces) == 0 {
-		fmt.Println("No workspaces found.")
-		return
+var (
+	ddevNameInvalidChars = regexp.MustCompile(`[^a-z0-9-]+`)
+	ddevNameRepeatedDash = regexp.MustCompile(`-{2,}`)
+	ddevNameValid        = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+)
+
+// normalizeDDEVName turns s into a legal DDEV project name: lowercase, with
+// runs of disallowed characters replaced by a single "-" and no leading or
+// trailing "-" (e.g. "PR#12" → "pr-12").
+func normalizeDDEVName(s string) string {
+	s = strings.ToLower(s)
+	s = ddevNameInvalidChars.ReplaceAllString(s, "-")
+	s = ddevNameRepeatedDash.ReplaceAllString(s, "-")
+	return strings.Trim(s, "-")
+}
+
+// validateDDEVName checks a DDEV project name against DDEV's rules: it's
+// used as a hostname label, so lowercase alphanumerics and inner hyphens only,
+// at most 63 characters.
+func validateDDEVName(name string) error {
+	if len(name) > 63 {
+		return fmt.Errorf("DDEV project name %q is longer than 63 characters", name)
 	}
+	if !ddevNameValid.MatchString(name) {
+		return fmt.Errorf("DDEV project name %q is invalid (use lowercase letters, digits, and hyphens)", name)
+	}
+	return nil
+}
 
-	// Find the longest name for alignment
-	maxName := 0
-	for _, ws := range workspaces {
-		if len(ws.name) > maxName {
-			maxName = len(ws.name)
-		}
+// extractProjectName extracts the project name from a git remote URL or a
+// local repository path (the repository's directory, not its .git).
+func extractProjectName(remoteURL string) string {
+	if path, ok := localRepoPath(remoteURL); ok {
+		remoteURL = strings.TrimSuffix(path, string(filepath.Separator)+".git")
 	}
+	remoteURL = strings.TrimRight(remoteURL, "/")
+	name := filepath.Base(remoteURL)
+	name = strings.TrimSuffix(name, ".git")
+	return name
+}
 
-	for _, ws := range workspaces {
-		if ws.branch != "" {
-			fmt.Printf("  %-*s  (%s)\n", maxName, ws.name, ws.branch)
-		} else {
-			fmt.Printf("  %-*s  (detached)\n", maxName, ws.name)
-		}
+// localRepoPath returns the absolute path of arg when it names a directory
+// on disk rather than a remote URL.
+func localRepoPath(arg string) (string, bool) {
+	if arg == "" || strings.Contains(arg, "://") {
+		return "", false
+	}
+	info, err := os.Stat(arg)
+	if err != nil || !info.IsDir() {
+		return "", false
+	}
+	abs, err := filepath.Abs(arg)
+	if err != nil {
+		return "", false
 	}
+	return abs, true
 }
 
-type newArgs struct {
-	worktreeName       string
-	identifier         string
-	baseBranch         string
-	identifierExplicit bool
+type initArgs struct {
+	remoteURL    string
+	projectName  string
+	printLayout  bool
+	outputDir    string
+	templateRepo string
+	bareDir      string
+	noFetchAll   bool
+	branches     string
+	force        bool
+	minFreeSpace int64
+	progressJSON string
+	fromBare     string
 }
 
-// parseNewArgs parses the arguments for the "new" subcommand.
-func parseNewArgs(args []string) (newArgs, error) {
-	var baseBranch string
+// defaultBareDir is where init puts the bare clone unless --bare-dir is given.
+const defaultBareDir = ".bare"
+
+// parseInitArgs parses the arguments for the "init" subcommand.
+func parseInitArgs(args []string) (initArgs, error) {
+	parsed := initArgs{bareDir: defaultBareDir, minFreeSpace: defaultMinFreeSpace}
 	var positional []string
 
 	for i := 0; i < len(args); i++ {
-		if args[i] == "--base" {
-			if i+1 >= len(args) {
-				return newArgs{}, fmt.Errorf("--base requires a branch name")
+		if value, n, err := parseValueFlag(args, i, "--output-dir"); err != nil {
+			return initArgs{}, err
+		} else if n > 0 {
+			parsed.outputDir = value
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--progress-json"); err != nil {
+			return initArgs{}, err
+		} else if n > 0 {
+			parsed.progressJSON = value
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--bare-dir"); err != nil {
+			return initArgs{}, err
+		} else if n > 0 {
+			parsed.bareDir = value
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--from-bare"); err != nil {
+			return initArgs{}, err
+		} else if n > 0 {
+			parsed.fromBare = value
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--template-repo"); err != nil {
+			return initArgs{}, err
+		} else if n > 0 {
+			parsed.templateRepo = value
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--origin"); err != nil {
+			return initArgs{}, err
+		} else if n > 0 {
+			parsed.remoteURL = value
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--branches"); err != nil {
+			return initArgs{}, err
+		} else if n > 0 {
+			parsed.branches = value
+			parsed.noFetchAll = true
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--min-free-space"); err != nil {
+			return initArgs{}, err
+		} else if n > 0 {
+			size, err := parseByteSize(value)
+			if err != nil {
+				return initArgs{}, fmt.Errorf("invalid --min-free-space %q (expected a size like 500M or 2G)", value)
 			}
-			baseBranch = args[i+1]
-			i++
-		} else if strings.HasPrefix(args[i], "--base=") {
-			baseBranch = strings.TrimPrefix(args[i], "--base=")
+			parsed.minFreeSpace = size
+			i += n - 1
+		} else if args[i] == "--no-fetch-all" {
+			parsed.noFetchAll = true
+		} else if args[i] == "--force" {
+			parsed.force = true
+		} else if args[i] == "--print-layout" {
+			parsed.printLayout = true
 		} else {
 			positional = append(positional, args[i])
 		}
 	}
 
-	if len(positional) < 1 || len(positional) > 2 {
-		return newArgs{}, fmt.Errorf("expected 1 or 2 positional arguments, got %d", len(positional))
+	switch parsed.bareDir {
+	case "", ".", "..", "spaces", "db", "files":
+		return initArgs{}, fmt.Errorf("invalid --bare-dir %q", parsed.bareDir)
+	}
+	if strings.ContainsRune(parsed.bareDir, '/') || strings.ContainsRune(parsed.bareDir, filepath.Separator) {
+		return initArgs{}, fmt.Errorf("--bare-dir must be a directory name, not a path: %q", parsed.bareDir)
 	}
 
-	worktreeName := positional[0]
-	if worktreeName == "" {
-		return newArgs{}, fmt.Errorf("worktree name cannot be empty")
+	if parsed.templateRepo != "" {
+		// The template is cloned and the project pushed to --origin, so
+		// the only positional is the optional folder name.
+		if parsed.remoteURL == "" {
+			return initArgs{}, fmt.Errorf("--template-repo requires --origin <url> for the new repository")
+		}
+		if len(positional) > 1 {
+			return initArgs{}, fmt.Errorf("expected at most 1 argument with --template-repo, got %d", len(positional))
+		}
+		positional = append([]string{parsed.remoteURL}, positional...)
+	} else if parsed.remoteURL != "" {
+		return initArgs{}, fmt.Errorf("--origin can only be used with --template-repo")
+	}
+
+	if parsed.fromBare != "" {
+		// origin comes from the bare repository's config, so the only
+		// positional is the optional folder name.
+		if parsed.templateRepo != "" {
+			return initArgs{}, fmt.Errorf("--from-bare cannot be combined with --template-repo")
+		}
+		if len(positional) > 1 {
+			return initArgs{}, fmt.Errorf("expected at most 1 argument with --from-bare, got %d", len(positional))
+		}
+		if path, ok := localRepoPath(parsed.fromBare); ok {
+			parsed.fromBare = path
+		}
+		if len(positional) == 1 {
+			parsed.projectName = positional[0]
+		} else {
+			parsed.projectName = extractProjectName(parsed.fromBare)
+		}
+		if parsed.projectName == "" || parsed.projectName == "." {
+			return initArgs{}, fmt.Errorf("could not determine project name from %s; pass a folder name", parsed.fromBare)
+		}
+		return parsed, nil
 	}
 
-	var identifier string
-	identifierExplicit := len(positional) == 2
-	if identifierExplicit {
-		identifier = positional[1]
+	if len(positional) < 1 || len(positional) > 2 {
+		return initArgs{}, fmt.Errorf("expected 1 or 2 arguments, got %d", len(positional))
+	}
+
+	// Local repositories are recorded by absolute path so origin keeps
+	// working from inside the project.
+	parsed.remoteURL = positional[0]
+	if path, ok := localRepoPath(parsed.remoteURL); ok {
+		parsed.remoteURL = path
+	}
+	if path, ok := localRepoPath(parsed.templateRepo); ok {
+		parsed.templateRepo = path
+	}
+	if len(positional) == 2 {
+		parsed.projectName = positional[1]
 	} else {
-		identifier = deriveIdentifier(worktreeName)
+		parsed.projectName = extractProjectName(parsed.remoteURL)
+	}
+	if parsed.projectName == "" {
+		return initArgs{}, fmt.Errorf("could not determine project name from URL: %s", parsed.remoteURL)
 	}
 
-	return newArgs{
-		worktreeName:       worktreeName,
-		identifier:         identifier,
-		baseBranch:         baseBranch,
-		identifierExplicit: identifierExplicit,
-	}, nil
+	return parsed, nil
 }
 
-func cmdNewFromArgs(args []string) {
-	parsed, err := parseNewArgs(args)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		fmt.Fprintf(os.Stderr, "Usage: workspace new [--base <branch>] <worktree-name> [identifier]\n")
-		os.Exit(1)
+// printInitLayout prints the directory structure init would create for
+// projectDir, without touching the disk or network. bareSource describes
+// where the bare repository comes from.
+func printInitLayout(projectDir, bareSource, bareDir string) {
+	fmt.Printf("workspace init would create:\n\n")
+	fmt.Printf("  %s/\n", projectDir)
+	fmt.Printf("    %-20s <- %s\n", bareDir+"/", bareSource)
+	if bareDir != ".git" {
+		fmt.Printf("    .git                 <- file containing \"gitdir: %s\"\n", bareDir)
+	}
+	fmt.Printf("    spaces/\n")
+	fmt.Printf("      <default-branch>/  <- first worktree (develop, else main)\n")
+	fmt.Printf("    db/                  <- database dumps (db.sql.gz)\n")
+	fmt.Printf("    files/               <- shared project files\n")
+
+	if _, err := os.Stat(projectDir); err == nil {
+		fmt.Printf("\nWarning: %s already exists; init would refuse to run.\n", projectDir)
 	}
-	cmdNew(parsed.worktreeName, parsed.identifier, parsed.baseBranch, parsed.identifierExplicit)
 }
 
-func cmdNew(worktreeName, identifier, baseBranch string, identifierExplicit bool) {
-	projectRoot, err := findProjectRoot()
+func cmdInit(args []string) error {
+	parsed, err := parseInitArgs(args)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return usageError(err,
+			"Usage: workspace init [--print-layout] [--output-dir <path>] [--bare-dir <name>] [--no-fetch-all | --branches <a,b>] [--min-free-space <size>] [--force] [--progress-json <path>] <git-remote-url> [folder-name]",
+			"       workspace init --template-repo <url> --origin <url> [folder-name]",
+			"       workspace init --from-bare <path> [folder-name]")
 	}
-
-	// Fetch latest refs from origin
-	fmt.Println("--- Fetching latest changes ---")
-	fetchCmd := exec.Command("git", "fetch", "origin")
-	fetchCmd.Dir = projectRoot
-	fetchCmd.Stdout = os.Stdout
-	fetchCmd.Stderr = os.Stderr
-	if err := fetchCmd.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to fetch from origin: %v\n", err)
+	stopProgress, err := startProgress("init", parsed.progressJSON, nil)
+	if err != nil {
+		return err
 	}
+	defer stopProgress()
 
-	// Validate base branch exists if specified
-	if baseBranch != "" {
-		cmd := exec.Command("git", "rev-parse", "--verify", baseBranch)
-		cmd.Dir = projectRoot
-		if err := cmd.Run(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: branch %q does not exist\n", baseBranch)
-			os.Exit(1)
+	remoteURL := parsed.remoteURL
+	projectName := parsed.projectName
+
+	// An adopted bare repository already knows where origin is.
+	if parsed.fromBare != "" {
+		remoteURL, err = bareRepoOrigin(parsed.fromBare)
+		if err != nil {
+			return err
 		}
 	}
 
-	// Default to origin/develop if it exists and no base was specified
-	if baseBranch == "" {
-		cmd := exec.Command("git", "rev-parse", "--verify", "refs/remotes/origin/develop")
-		cmd.Dir = projectRoot
-		if cmd.Run() == nil {
-			baseBranch = "origin/develop"
+	// In template mode the bare clone comes from the template and origin is
+	// repointed at the new repository afterwards.
+	cloneURL := remoteURL
+	if parsed.templateRepo != "" {
+		cloneURL = parsed.templateRepo
+	}
+
+	parentDir := parsed.outputDir
+	if parentDir == "" {
+		parentDir, err = os.Getwd()
+		if err != nil {
+			return fmt.Errorf("getting current directory: %w", err)
 		}
 	}
+	parentDir, err = filepath.Abs(parentDir)
+	if err != nil {
+		return fmt.Errorf("resolving output directory: %w", err)
+	}
 
-	worktreePath := filepath.Join(projectRoot, "spaces", worktreeName)
-	state := &cleanupState{worktreePath: worktreePath, projectRoot: projectRoot}
-	var steps []StepResult
+	projectDir := filepath.Join(parentDir, projectName)
 
-	// Step 1: Create git worktree
-	err = createWorktree(projectRoot, worktreeName, baseBranch)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating worktree: %v\n", err)
-		cleanup(state)
-		os.Exit(1)
+	if parsed.fromBare != "" && (pathWithin(parsed.fromBare, projectDir) || pathWithin(projectDir, parsed.fromBare)) {
+		return usageError(fmt.Errorf("the project folder %s overlaps the bare repository %s", projectDir, parsed.fromBare), "Pass a different folder name or --output-dir.")
 	}
-	state.worktreeCreated = true
-	steps = append(steps, StepResult{
-		Description: "Created git worktree",
-		Detail:      worktreeName,
-	})
 
-	// Step 2: Push branch and set up tracking if it doesn't exist on the remote
-	remoteBranchCheck := exec.Command("git", "rev-parse", "--verify", "refs/remotes/origin/"+worktreeName)
-	remoteBranchCheck.Dir = projectRoot
-	if remoteBranchCheck.Run() != nil {
-		fmt.Println("\n--- Pushing branch to remote ---")
-		pushCmd := exec.Command("git", "push", "-u", "origin", worktreeName)
-		pushCmd.Dir = worktreePath
-		pushCmd.Stdout = os.Stdout
-		pushCmd.Stderr = os.Stderr
-		if err := pushCmd.Run(); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to push branch to remote: %v\n", err)
-			steps = append(steps, StepResult{
-				Description: "Push branch to remote",
-				Detail:      "Failed (can be pushed manually later)",
-			})
-		} else {
-			steps = append(steps, StepResult{
-				Description: "Pushed branch to remote",
-				Detail:      worktreeName + " → origin/" + worktreeName,
-			})
+	_, local := localRepoPath(cloneURL)
+	if local {
+		if _, err := gitOutput(cloneURL, "rev-parse", "--git-dir"); err != nil {
+			return fmt.Errorf("%s is a directory but not a git repository", cloneURL)
+		}
+		if filepath.Clean(projectDir) == filepath.Clean(cloneURL) {
+			return usageError(fmt.Errorf("the project would be created in %s itself", cloneURL), "Pass a folder name: workspace init <path> <folder-name>")
 		}
-	} else {
-		steps = append(steps, StepResult{
-			Description: "Remote branch",
-			Detail:      "Already exists, skipped push",
-		})
 	}
 
-	// Step 3: Detect DDEV from the new worktree
-	originalName, err := getDDEVProjectName(worktreePath)
-	hasDDEV := err == nil
-	projectType := getDDEVProjectType(worktreePath)
+	if parsed.printLayout {
+		bareSource := "bare clone of " + cloneURL
+		if parsed.fromBare != "" {
+			bareSource = parsed.fromBare + " (moved here)"
+		}
+		printInitLayout(projectDir, bareSource, parsed.bareDir)
+		return nil
+	}
 
-	// Link Claude Code memory to share with project root (before potential early return)
-	memDetail, memErr := linkClaudeMemory(worktreePath, projectRoot)
-	if memErr != nil {
-		fmt.Fprintf(os.Stderr, "\nWarning: failed to link Claude memory: %v\n", memErr)
+	// Check if project directory already exists; --force resumes into an
+	// empty directory or one left behind by an interrupted init
+	resume := false
+	if _, err := os.Stat(projectDir); err == nil {
+		if !parsed.force {
+			return withHints(fmt.Errorf("directory already exists: %s", projectDir), "If it is empty or left over from an interrupted init, re-run with --force to resume.")
+		}
+		if err := checkResumableInitDir(projectDir, parsed.bareDir); err != nil {
+			return err
+		}
+		resume = true
+	}
+
+	// Nothing is cloned when adopting a bare repository; the fetch only
+	// brings it up to date.
+	if parsed.fromBare == "" && (!resume || !usableBareClone(filepath.Join(projectDir, parsed.bareDir), cloneURL, remoteURL)) {
+		if err := checkFreeSpace(projectDir, parsed.minFreeSpace, "the clone"); err != nil {
+			return withHints(err, "Free up space, or pass --min-free-space <size> to change the threshold (0 disables the check).")
+		}
+	}
+
+	var steps []StepResult
+
+	// Step 1: Create project directory
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		return fmt.Errorf("creating project directory: %w", err)
+	}
+
+	// A bare repository adopted with --from-bare is put back before the
+	// partial project is removed, so a failed init doesn't lose it.
+	barePath := filepath.Join(projectDir, parsed.bareDir)
+	restoreBare := func() {}
+	abort := func() {
+		restoreBare()
+		cleanupInit(projectDir)
+	}
+
+	// Step 2: Bare clone (reusing a complete one when resuming)
+	if resume && usableBareClone(barePath, cloneURL, remoteURL) {
+		// Forget worktrees the interrupted run registered but never finished
+		_, _ = gitOutput(projectDir, "worktree", "prune")
 		steps = append(steps, StepResult{
-			Description: "Claude memory",
-			Detail:      "Failed: " + memErr.Error(),
+			Description: "Cloned repository (bare)",
+			Detail:      barePath + " (reused)",
+		})
+	} else if parsed.fromBare != "" {
+		if resume {
+			if err := os.RemoveAll(barePath); err != nil {
+				return fmt.Errorf("removing partial bare clone: %w", err)
+			}
+		}
+		detail, restore, err := adoptBareRepo(parsed.fromBare, barePath, projectDir, !sameFilesystem(parsed.fromBare, projectDir))
+		if err != nil {
+			cleanupInit(projectDir)
+			return err
+		}
+		restoreBare = restore
+		steps = append(steps, StepResult{
+			Description: "Adopted bare repository",
+			Detail:      detail,
 		})
 	} else {
+		if resume {
+			if err := os.RemoveAll(barePath); err != nil {
+				return fmt.Errorf("removing partial bare clone: %w", err)
+			}
+		}
+		clonePhase := "Cloning repository (bare)"
+		if local {
+			clonePhase = fmt.Sprintf("Cloning local repository %s (bare)", cloneURL)
+		}
+		cloneArgs := []string{"clone", "--bare"}
+		if parsed.noFetchAll {
+			// Only the remote's HEAD branch; the rest of the narrowed set is
+			// fetched below.
+			cloneArgs = append(cloneArgs, "--single-branch")
+		}
+		cloneCmd := exec.Command(gitBin, append(cloneArgs, cloneURL, barePath)...)
+		cloneCmd.Stdout = os.Stdout
+		cloneCmd.Stderr = os.Stderr
+		if err := runPhase(clonePhase, cloneCmd.Run); err != nil {
+			abort()
+			return fmt.Errorf("cloning repository: %w", err)
+		}
+		detail := barePath
+		if local {
+			detail += " (from " + cloneURL + ")"
+		}
 		steps = append(steps, StepResult{
-			Description: "Claude memory",
-			Detail:      memDetail,
+			Description: "Cloned repository (bare)",
+			Detail:      detail,
 		})
 	}
 
-	if !hasDDEV {
+	// Step 3: Write .git file (not needed when the bare clone is .git itself)
+	if parsed.bareDir != ".git" {
+		gitFilePath := filepath.Join(projectDir, ".git")
+		if err := os.WriteFile(gitFilePath, []byte("gitdir: "+parsed.bareDir+"\n"), 0644); err != nil {
+			abort()
+			return fmt.Errorf("writing .git file: %w", err)
+		}
 		steps = append(steps, StepResult{
-			Description: "DDEV",
-			Detail:      "Skipped (no .ddev/config.yaml found)",
+			Description: "Created .git file",
+			Detail:      gitFilePath,
 		})
-		fmt.Println()
-		printSummary(steps)
-		return
 	}
 
-	steps = append(steps, StepResult{
-		Description: "Read DDEV project name",
-		Detail:      originalName,
-	})
-
-	// Step 4: Rename DDEV project (skip for develop/main — keep default name,
-	// unless the user explicitly provided an identifier to override it)
-	isDefaultBranch := (worktreeName == "develop" || worktreeName == "main") && !identifierExplicit
-	ddevName := originalName
-	if !isDefaultBranch {
-		ddevName = identifier + "-" + originalName
-		err = createDDEVLocalConfig(worktreePath, ddevName)
+	// Template mode: repoint origin and seed it with the template's default branch
+	if parsed.templateRepo != "" {
+		branch, err := seedFromTemplate(projectDir, remoteURL)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating DDEV local config: %v\n", err)
-			cleanup(state)
-			os.Exit(1)
+			abort()
+			return fmt.Errorf("seeding new repository from template: %w", err)
 		}
 		steps = append(steps, StepResult{
-			Description: "Created DDEV local config",
-			Detail:      ddevName,
+			Description: "Seeded from template",
+			Detail:      fmt.Sprintf("%s (%s) → %s", parsed.templateRepo, branch, remoteURL),
 		})
+	}
 
-		// Update settings.ddev.php with new DB host (Drupal projects)
-		if projectType == ProjectDrupal {
-			settingsPath := filepath.Join(worktreePath, "web", "sites", "default", "settings.ddev.php")
-			if _, statErr := os.Stat(settingsPath); statErr == nil {
-				err = updateSettingsDdevPHP(settingsPath, ddevName)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error updating settings.ddev.php: %v\n", err)
-					cleanup(state)
-					os.Exit(1)
-				}
-				assumeCmd := exec.Command("git", "update-index", "--assume-unchanged", filepath.Join("web", "sites", "default", "settings.ddev.php"))
-				assumeCmd.Dir = worktreePath
-				_ = assumeCmd.Run()
-				steps = append(steps, StepResult{
-					Description: "Updated settings.ddev.php",
-					Detail:      "DB host set to ddev-" + ddevName + "-db",
-				})
-			}
+	// Step 4: Reconfigure fetch refspec
+	refspecs := []string{"+refs/heads/*:refs/remotes/origin/*"}
+	fetchDetail := "Fetched all branches"
+	if parsed.noFetchAll {
+		branches, err := existingRemoteBranches(projectDir, fetchBranchList(parsed.branches))
+		if err != nil {
+			abort()
+			return err
+		}
+		refspecs = nil
+		for _, branch := range branches {
+			refspecs = append(refspecs, "+refs/heads/"+branch+":refs/remotes/origin/"+branch)
+		}
+		fetchDetail = "Fetched " + strings.Join(branches, ", ")
+	}
+	for i, refspec := range refspecs {
+		configArgs := []string{"config", "--add", "remote.origin.fetch", refspec}
+		if i == 0 {
+			configArgs = []string{"config", "--replace-all", "remote.origin.fetch", refspec}
+		}
+		if _, err := gitOutput(projectDir, configArgs...); err != nil {
+			abort()
+			return fmt.Errorf("configuring fetch refspec: %w", err)
 		}
+	}
+
+	fetchCmd := exec.Command(gitBin, "fetch", "origin")
+	fetchCmd.Dir = projectDir
+	fetchCmd.Stdout = os.Stdout
+	fetchCmd.Stderr = os.Stderr
+	if err := runPhase("Fetching branches", fetchCmd.Run); err != nil {
+		abort()
+		return fmt.Errorf("fetching from origin: %w", err)
+	}
+	steps = append(steps, StepResult{
+		Description: "Configured fetch refspec",
+		Detail:      fetchDetail,
+	})
+
+	// Step 5: Detect default branch
+	defaultBranch := detectDefaultBranch(projectDir)
+	if defaultBranch == "" {
+		abort()
+		return withHints(fmt.Errorf("could not detect default branch"),
+			"Neither 'develop' nor 'main' branches were found on the remote.",
+			"Please ensure the remote repository has a 'develop' or 'main' branch.")
+	}
+	steps = append(steps, StepResult{
+		Description: "Default branch",
+		Detail:      defaultBranch,
+	})
+
+	// A bare clone has no refs/remotes/origin/HEAD; take the remote's HEAD,
+	// or the detected default branch when the remote doesn't advertise one.
+	head, err := setOriginHead(projectDir, "")
+	if err != nil {
+		head, err = setOriginHead(projectDir, defaultBranch)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not set origin/HEAD: %v\n", err)
+		steps = append(steps, StepResult{
+			Description: "origin/HEAD",
+			Detail:      "Not set (run workspace set-head <branch>)",
+		})
 	} else {
 		steps = append(steps, StepResult{
-			Description: "DDEV project name",
-			Detail:      originalName + " (kept default)",
+			Description: "origin/HEAD",
+			Detail:      head,
 		})
 	}
 
-	// Remove .ddev/traefik so DDEV regenerates it for the new project
-	traefikPath := filepath.Join(worktreePath, ".ddev", "traefik")
-	if err := os.RemoveAll(traefikPath); err != nil {
-		fmt.Fprintf(os.Stderr, "Error removing .ddev/traefik: %v\n", err)
-		cleanup(state)
-		os.Exit(1)
+	// Step 6: Create spaces/, db/, and files/ directories, then first worktree
+	spacesDir := filepath.Join(projectDir, "spaces")
+	if err := os.MkdirAll(spacesDir, 0755); err != nil {
+		abort()
+		return fmt.Errorf("creating spaces directory: %w", err)
+	}
+	dumpDir, err := dbDir(projectDir)
+	if err != nil {
+		abort()
+		return err
+	}
+	if err := os.MkdirAll(dumpDir, 0755); err != nil {
+		abort()
+		return fmt.Errorf("creating db directory: %w", err)
+	}
+	filesDir := filepath.Join(projectDir, "files")
+	if err := os.MkdirAll(filesDir, 0777); err != nil {
+		abort()
+		return fmt.Errorf("creating files directory: %w", err)
+	}
+
+	wtPath := filepath.Join("spaces", defaultBranch)
+	wtCmd := exec.Command(gitBin, "worktree", "add", wtPath, defaultBranch)
+	wtCmd.Dir = projectDir
+	wtCmd.Stdout = os.Stdout
+	wtCmd.Stderr = os.Stderr
+	if err := runPhase("Creating worktree", wtCmd.Run); err != nil {
+		abort()
+		return fmt.Errorf("creating worktree: %w", err)
 	}
+	worktreeFullPath := filepath.Join(projectDir, "spaces", defaultBranch)
+	steps = append(steps, StepResult{
+		Description: "Created worktree",
+		Detail:      worktreeFullPath,
+	})
+
+	// Detect project type from DDEV config
+	projectType := getDDEVProjectType(worktreeFullPath)
+	steps = append(steps, StepResult{
+		Description: "Project type",
+		Detail:      string(projectType),
+	})
 
-	// Link project files (before DDEV start so files are available immediately)
-	filesDetail, err := linkProjectFiles(worktreePath, projectRoot, projectType)
+	// Link project files
+	filesDetail, err := linkProjectFiles(worktreeFullPath, projectDir, projectType)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "\nWarning: failed to link project files: %v\n", err)
 		steps = append(steps, StepResult{
@@ -853,488 +1539,8741 @@ func cmdNew(worktreeName, identifier, baseBranch string, identifierExplicit bool
 		})
 	}
 
-	// Step 4: Start DDEV
-	state.ddevName = ddevName
-	fmt.Println("\n--- Starting DDEV ---")
-	err = runCommandLive(worktreePath, "ddev", "start")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "\nError starting DDEV: %v\n", err)
-		cleanup(state)
-		os.Exit(1)
+	// Link Claude Code memory to share with project root
+	memDetail, memErr := linkClaudeMemory(worktreeFullPath, projectDir)
+	if memErr != nil {
+		fmt.Fprintf(os.Stderr, "\nWarning: failed to link Claude memory: %v\n", memErr)
+		steps = append(steps, StepResult{
+			Description: "Claude memory",
+			Detail:      "Failed: " + memErr.Error(),
+		})
+	} else {
+		steps = append(steps, StepResult{
+			Description: "Claude memory",
+			Detail:      memDetail,
+		})
 	}
-	state.ddevStarted = true
-	steps = append(steps, StepResult{
-		Description: "Started DDEV",
-		Detail:      ddevName,
-	})
 
-	// Step 5: Composer install for Drupal projects
-	if projectType == ProjectDrupal {
-		fmt.Println("\n--- Running composer install ---")
-		if err := runCommandLive(worktreePath, "ddev", "composer", "install"); err != nil {
-			fmt.Fprintf(os.Stderr, "\nWarning: failed to run composer install: %v\n", err)
+	// Step 7: Check for DDEV and optionally set it up
+	ddevConfig := filepath.Join(ddevRoot(worktreeFullPath), ".ddev", "config.yaml")
+	if _, err := os.Stat(ddevConfig); err == nil {
+		if err := runPhase("Starting DDEV", func() error {
+			return runDDEVLocked(ddevRoot(worktreeFullPath), nil, "start")
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "\nWarning: failed to start DDEV: %v\n", err)
 			steps = append(steps, StepResult{
-				Description: "Composer install",
-				Detail:      fmt.Sprintf("Failed: %v", err),
+				Description: "DDEV",
+				Detail:      fmt.Sprintf("Failed to start: %v", err),
 			})
 		} else {
 			steps = append(steps, StepResult{
-				Description: "Composer install",
-				Detail:      "Complete",
+				Description: "DDEV",
+				Detail:      "Started",
 			})
+
+			dbDetail, err := handleDBImport(worktreeFullPath, projectDir, dbImportOptions{})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\nWarning: failed to import database: %v\n", err)
+				steps = append(steps, StepResult{
+					Description: "Database",
+					Detail:      fmt.Sprintf("Failed: %v", err),
+				})
+			} else {
+				steps = append(steps, StepResult{
+					Description: "Database",
+					Detail:      dbDetail,
+				})
+			}
+
+			if projectType == ProjectDrupal {
+				if err := runPhase("Running composer install", func() error {
+					return runCommandLive(ddevRoot(worktreeFullPath), ddevBin, "composer", "install")
+				}); err != nil {
+					fmt.Fprintf(os.Stderr, "\nWarning: failed to run composer install: %v\n", err)
+					steps = append(steps, StepResult{
+						Description: "Composer install",
+						Detail:      fmt.Sprintf("Failed: %v", err),
+					})
+				} else {
+					steps = append(steps, StepResult{
+						Description: "Composer install",
+						Detail:      "Complete",
+					})
+				}
+			}
 		}
+	} else {
+		steps = append(steps, StepResult{
+			Description: "DDEV",
+			Detail:      "Skipped (no .ddev/config.yaml found)",
+		})
 	}
 
-	// Step 6: Handle DB import
-	dbDetail, err := handleDBImport(worktreePath, projectRoot)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "\nError importing database: %v\n", err)
-		cleanup(state)
-		os.Exit(1)
+	// Step 8: Remember the project for list --all-projects
+	if err := registerProject(projectDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not register project: %v\n", err)
+		steps = append(steps, StepResult{
+			Description: "Project registry",
+			Detail:      fmt.Sprintf("Failed: %v", err),
+		})
+	} else {
+		steps = append(steps, StepResult{
+			Description: "Project registry",
+			Detail:      "Registered",
+		})
 	}
-	steps = append(steps, StepResult{
-		Description: "Database",
-		Detail:      dbDetail,
-	})
 
 	// Done
 	fmt.Println()
-	printSummary(steps)
+	renderSummary("Workspace Setup", steps)
+	return nil
 }
 
-func cmdRefresh(args []string) {
-  projectRoot, err := findProjectRoot()
-  if err != nil {
-    fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-    os.Exit(1)
-  }
-
-  var targetPath string
-  if len(args) > 0 && args[0] != "" {
-    targetPath = filepath.Join(projectRoot, "spaces", args[0])
-  } else {
-    targetPath, err = os.Getwd()
-    if err != nil {
-      fmt.Fprintf(os.Stderr, "Error getting current directory: %v\n", err)
-      os.Exit(1)
-    }
-  }
-
-  targetPath, err = filepath.Abs(targetPath)
-  if err != nil {
-    fmt.Fprintf(os.Stderr, "Error resolving path: %v\n", err)
-    os.Exit(1)
-  }
-  targetPath, err = filepath.EvalSymlinks(targetPath)
-  if err != nil {
-    fmt.Fprintf(os.Stderr, "Error resolving path: %v\n", err)
-    os.Exit(1)
-  }
-
-  if _, err := validateWorktree(targetPath, projectRoot); err != nil {
-    fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-    os.Exit(1)
-  }
-
-  var steps []StepResult
-
-  dbDetail, err := handleDBImport(targetPath, projectRoot)
-  if err != nil {
-    fmt.Fprintf(os.Stderr, "\nError importing database: %v\n", err)
-    os.Exit(1)
-  }
-  steps = append(steps, StepResult{
-    Description: "Database",
-    Detail:      dbDetail,
-  })
-
-  fmt.Println()
-  printSummary(steps)
+// registryPath returns the location of the registry of known project roots,
+// $XDG_CONFIG_HOME/workspace/projects.json (~/.config by default).
+func registryPath() (string, error) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not determine home directory: %w", err)
+		}
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configHome, "workspace", "projects.json"), nil
 }
 
-// findDDEVProjectName reads the DDEV project name from the main/master
-// worktree, which always has the original (un-prefixed) name.
-// detectProjectType reads the DDEV project type from the first existing worktree.
-func detectProjectType(projectRoot string) ProjectType {
-	spacesDir := filepath.Join(projectRoot, "spaces")
+// projectRegistry is the on-disk format of the project registry.
+type projectRegistry struct {
+	Projects []string `json:"projects"`
+}
 
-	entries, err := os.ReadDir(spacesDir)
+// loadRegistry returns the registered project roots. A missing registry is
+// not an error.
+func loadRegistry() ([]string, error) {
+	path, err := registryPath()
 	if err != nil {
-		return ProjectUnsupported
+		return nil, err
 	}
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			return getDDEVProjectType(filepath.Join(spacesDir, entry.Name()))
-		}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
 	}
-
-	return ProjectUnsupported
+	if err != nil {
+		return nil, err
+	}
+	var registry projectRegistry
+	if err := json.Unmarshal(data, &registry); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	return registry.Projects, nil
 }
 
-func cmdRemove(args []string) {
-	projectRoot, err := findProjectRoot()
+// registerProject adds projectRoot to the registry if it isn't there yet.
+func registerProject(projectRoot string) error {
+	roots, err := loadRegistry()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return err
 	}
-
-	// Determine target directory
-	var targetPath string
-	if len(args) > 0 && args[0] != "" {
-		targetPath = filepath.Join(projectRoot, "spaces", args[0])
-	} else {
-		targetPath, err = os.Getwd()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error getting current directory: %v\n", err)
-			os.Exit(1)
-		}
+	if containsString(roots, projectRoot) {
+		return nil
 	}
+	roots = append(roots, projectRoot)
+	sort.Strings(roots)
 
-	targetPath, err = filepath.Abs(targetPath)
+	path, err := registryPath()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error resolving path: %v\n", err)
-		os.Exit(1)
+		return err
 	}
-	targetPath, err = filepath.EvalSymlinks(targetPath)
+	data, err := json.MarshalIndent(projectRegistry{Projects: roots}, "", "  ")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error resolving path: %v\n", err)
-		os.Exit(1)
+		return err
 	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0644)
+}
 
-	// Validate it's a git worktree
-	branchName, err := validateWorktree(targetPath, projectRoot)
+// checkResumableInitDir allows init --force to continue in projectDir only
+// when it is empty or holds nothing but the bare clone and .git pointer of an
+// earlier, interrupted init.
+func checkResumableInitDir(projectDir, bareDir string) error {
+	entries, err := os.ReadDir(projectDir)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("could not read %s: %w", projectDir, err)
+	}
+	var unrelated []string
+	for _, entry := range entries {
+		if entry.Name() != bareDir && entry.Name() != ".git" {
+			unrelated = append(unrelated, entry.Name())
+		}
+	}
+	if len(unrelated) > 0 {
+		return fmt.Errorf("%s contains unrelated files (%s); refusing to overwrite it", projectDir, strings.Join(unrelated, ", "))
 	}
+	return nil
+}
 
-	// Detect project type from DDEV config
-	projectType := getDDEVProjectType(targetPath)
-	_ = projectType
+// bareRepoOrigin returns the origin URL of the bare repository at path, which
+// init --from-bare adopts instead of cloning.
+func bareRepoOrigin(path string) (string, error) {
+	gitDir := "--git-dir=" + path
+	isBare, err := gitOutput(filepath.Dir(path), gitDir, "rev-parse", "--is-bare-repository")
+	if err != nil || isBare != "true" {
+		return "", fmt.Errorf("%s is not a bare git repository", path)
+	}
+	origin, err := gitOutput(filepath.Dir(path), gitDir, "config", "--get", "remote.origin.url")
+	if err != nil || origin == "" {
+		return "", withHints(fmt.Errorf("%s has no origin remote", path),
+			fmt.Sprintf("Add one with: git --git-dir=%s remote add origin <url>", path))
+	}
+	return origin, nil
+}
 
-	// Confirmation prompt
-	fmt.Println("The following will be destroyed:")
-	fmt.Printf("  Worktree:  %s\n", targetPath)
-	fmt.Printf("  Branch:    %s\n", branchName)
-	fmt.Printf("  DDEV project in that worktree (if any)\n")
-	fmt.Print("\nAre you sure? (y/N) ")
+// adoptBareRepo puts the bare repository at src in place at barePath for
+// init --from-bare. It is moved, or with link (across filesystems, where it
+// can't be) symlinked, recording the project in it under projectRootKey.
+// restore undoes it for a failed init.
+func adoptBareRepo(src, barePath, projectDir string, link bool) (detail string, restore func(), err error) {
+	if !link {
+		if err := os.Rename(src, barePath); err != nil {
+			return "", nil, fmt.Errorf("moving %s to %s: %w", src, barePath, err)
+		}
+		return barePath + " (moved from " + src + ")", func() {
+			if err := os.Rename(barePath, src); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: could not move %s back to %s: %v\n", barePath, src, err)
+			}
+		}, nil
+	}
+
+	if err := os.Symlink(src, barePath); err != nil {
+		return "", nil, withHints(fmt.Errorf("symlinking %s to %s: %w", barePath, src, err),
+			"The bare repository is on another filesystem, so it can't be moved; use --output-dir to create the project next to it.")
+	}
+	gitDir := "--git-dir=" + src
+	if _, err := gitOutput(projectDir, gitDir, "config", projectRootKey, projectDir); err != nil {
+		os.Remove(barePath)
+		return "", nil, fmt.Errorf("recording the project in %s: %w", src, err)
+	}
+	return barePath + " (symlinked to " + src + ")", func() {
+		_, _ = gitOutput(projectDir, gitDir, "config", "--unset", projectRootKey)
+	}, nil
+}
+
+// usableBareClone reports whether barePath is a bare repository whose origin
+// is one of the given URLs, i.e. the clone step of an earlier init finished.
+func usableBareClone(barePath string, urls ...string) bool {
+	// --git-dir stops git from discovering an enclosing repository when
+	// barePath is only a partial clone.
+	gitDir := "--git-dir=" + barePath
+	isBare, err := gitOutput(filepath.Dir(barePath), gitDir, "rev-parse", "--is-bare-repository")
+	if err != nil || isBare != "true" {
+		return false
+	}
+	origin, err := gitOutput(filepath.Dir(barePath), gitDir, "config", "--get", "remote.origin.url")
+	return err == nil && containsString(urls, origin)
+}
+
+// seedFromTemplate turns a bare clone of a template repository into the new
+// project: origin is repointed at originURL, every branch except the
+// template's default is dropped, and the default branch is pushed to origin.
+// It returns the default branch name.
+func seedFromTemplate(projectDir, originURL string) (string, error) {
+	branch, err := gitOutput(projectDir, "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("could not determine the template's default branch: %w", err)
+	}
+
+	if _, err := gitOutput(projectDir, "remote", "set-url", "origin", originURL); err != nil {
+		return "", fmt.Errorf("could not set origin to %s: %w", originURL, err)
+	}
+
+	heads, err := gitOutput(projectDir, "for-each-ref", "--format=%(refname:short)", "refs/heads")
+	if err != nil {
+		return "", fmt.Errorf("could not list template branches: %w", err)
+	}
+	for _, head := range strings.Fields(heads) {
+		if head != branch {
+			if _, err := gitOutput(projectDir, "branch", "-D", head); err != nil {
+				return "", fmt.Errorf("could not drop template branch %s: %w", head, err)
+			}
+		}
+	}
+
+	if err := runPhase("Pushing template to new origin", func() error {
+		return runCommandLive(projectDir, gitBin, "push", "origin", branch)
+	}); err != nil {
+		return "", fmt.Errorf("could not push %s to %s: %w", branch, originURL, err)
+	}
+	return branch, nil
+}
+
+// fetchBranchList returns the branches a narrowed init fetches: the
+// comma-separated list from --branches plus develop and main, which
+// detectDefaultBranch needs.
+func fetchBranchList(branches string) []string {
+	var list []string
+	for _, branch := range append(strings.Split(branches, ","), "develop", "main") {
+		branch = strings.TrimSpace(branch)
+		if branch != "" && !containsString(list, branch) {
+			list = append(list, branch)
+		}
+	}
+	return list
+}
+
+// existingRemoteBranches filters branches down to the ones that exist on
+// origin, since fetching a missing branch through a configured refspec
+// fails the whole fetch.
+func existingRemoteBranches(projectDir string, branches []string) ([]string, error) {
+	args := []string{"ls-remote", "--heads", "origin"}
+	for _, branch := range branches {
+		args = append(args, "refs/heads/"+branch)
+	}
+	out, err := gitOutput(projectDir, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not list remote branches: %w", err)
+	}
+
+	var existing []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			existing = append(existing, strings.TrimPrefix(fields[1], "refs/heads/"))
+		}
+	}
+	if len(existing) == 0 {
+		return nil, fmt.Errorf("none of the branches %s exist on the remote", strings.Join(branches, ", "))
+	}
+	return existing, nil
+}
+
+func detectDefaultBranch(projectDir string) string {
+	// Prefer develop, fall back to main
+	for _, branch := range []string{"develop", "main"} {
+		cmd := exec.Command(gitBin, "rev-parse", "--verify", "refs/remotes/origin/"+branch)
+		cmd.Dir = projectDir
+		if err := cmd.Run(); err == nil {
+			return branch
+		}
+	}
+
+	return ""
+}
+
+// setOriginHead points refs/remotes/origin/HEAD at origin/<branch>, or at
+// the remote's own HEAD when branch is empty, and returns the ref it now
+// names (e.g. "origin/main"). The target must be a fetched remote branch.
+func setOriginHead(projectDir, branch string) (string, error) {
+	args := []string{"remote", "set-head", "origin", "--auto"}
+	if branch != "" {
+		if _, err := resolveCommitish(projectDir, "refs/remotes/origin/"+branch); err != nil {
+			return "", fmt.Errorf("origin/%s does not exist (fetched branches only)", branch)
+		}
+		args = []string{"remote", "set-head", "origin", branch}
+	}
+	if out, err := exec.Command(gitBin, append([]string{"-C", projectDir}, args...)...).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git remote set-head: %s", strings.TrimSpace(string(out)))
+	}
+
+	head, err := gitOutput(projectDir, "symbolic-ref", "--short", "refs/remotes/origin/HEAD")
+	if err != nil {
+		return "", err
+	}
+	// --auto can name a branch outside a narrowed fetch refspec
+	if _, err := resolveCommitish(projectDir, "refs/remotes/origin/HEAD"); err != nil {
+		_, _ = gitOutput(projectDir, "remote", "set-head", "origin", "--delete")
+		return "", fmt.Errorf("%s has not been fetched", head)
+	}
+	return head, nil
+}
+
+func cmdSetHead(args []string) error {
+	usage := "Usage: workspace set-head [branch]"
+	if len(args) > 1 {
+		return usageError(fmt.Errorf("expected at most 1 argument, got %d", len(args)), usage)
+	}
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+	var branch string
+	if len(args) == 1 {
+		branch = strings.TrimPrefix(args[0], "origin/")
+	}
+	head, err := setOriginHead(projectRoot, branch)
+	if err != nil {
+		if branch == "" {
+			return withHints(err, "Name the branch instead: workspace set-head <branch>")
+		}
+		return err
+	}
+	fmt.Printf("origin/HEAD → %s\n", head)
+	return nil
+}
+
+// lsRemoteInfo summarizes `git ls-remote --symref` output.
+type lsRemoteInfo struct {
+	refs     int
+	branches []string
+	tags     int
+	head     string
+}
+
+func parseLsRemote(out string) lsRemoteInfo {
+	var info lsRemoteInfo
+	for _, line := range strings.Split(out, "\n") {
+		target, ref, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(target, "ref: ") {
+			if ref == "HEAD" {
+				info.head = strings.TrimPrefix(strings.TrimPrefix(target, "ref: "), "refs/heads/")
+			}
+			continue
+		}
+		if ref == "HEAD" {
+			continue
+		}
+		info.refs++
+		switch {
+		case strings.HasPrefix(ref, "refs/heads/"):
+			info.branches = append(info.branches, strings.TrimPrefix(ref, "refs/heads/"))
+		case strings.HasPrefix(ref, "refs/tags/") && !strings.HasSuffix(ref, "^{}"):
+			info.tags++
+		}
+	}
+	return info
+}
+
+// cmdTestConnection checks that a remote is reachable with the current
+// credentials, without cloning anything.
+func cmdTestConnection(args []string) error {
+	if len(args) != 1 {
+		return usageError(fmt.Errorf("expected 1 argument, got %d", len(args)), "Usage: workspace test-connection <git-remote-url|path>")
+	}
+	url := args[0]
+	if path, ok := localRepoPath(url); ok {
+		url = path
+	}
+
+	fmt.Printf("Contacting %s...\n", url)
+	cmd := exec.Command(gitBin, "ls-remote", "--symref", url)
+	// Fail instead of waiting for a password that will never be typed
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_SSH_COMMAND="+sshBatchCommand())
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return withHints(fmt.Errorf("could not reach %s: %s", url, strings.TrimSpace(stderr.String())),
+			"Check the URL for typos.",
+			"For SSH URLs, check that your key is loaded (ssh-add -l) and accepted: ssh -T git@<host>")
+	}
+
+	info := parseLsRemote(string(out))
+	steps := []StepResult{
+		{Description: "Remote", Detail: url},
+		{Description: "Refs", Detail: fmt.Sprintf("%d (%d branches, %d tags)", info.refs, len(info.branches), info.tags)},
+	}
+	if info.head != "" {
+		steps = append(steps, StepResult{Description: "Default branch", Detail: info.head})
+	} else {
+		steps = append(steps, StepResult{Description: "Default branch", Detail: "Not advertised"})
+	}
+	initBranch := ""
+	for _, branch := range []string{"develop", "main"} {
+		if containsString(info.branches, branch) {
+			initBranch = branch
+			break
+		}
+	}
+	if initBranch == "" {
+		steps = append(steps, StepResult{Description: "init worktree", Detail: "None: init needs a develop or main branch"})
+	} else {
+		steps = append(steps, StepResult{Description: "init worktree", Detail: "spaces/" + initBranch})
+	}
+	if name := extractProjectName(url); name != "" {
+		steps = append(steps, StepResult{Description: "init folder", Detail: name})
+	}
+
+	renderSummary("Connection Test", steps)
+	if initBranch == "" {
+		return fmt.Errorf("the remote has neither a develop nor a main branch")
+	}
+	return nil
+}
+
+// sshBatchCommand is the ssh command git uses for test-connection: the
+// user's GIT_SSH_COMMAND (or ssh) in batch mode, so a missing key fails
+// rather than prompting.
+func sshBatchCommand() string {
+	command := os.Getenv("GIT_SSH_COMMAND")
+	if command == "" {
+		command = "ssh"
+	}
+	return command + " -o BatchMode=yes"
+}
+
+func cleanupInit(projectDir string) {
+	fmt.Fprintf(os.Stderr, "\n--- Cleaning up ---\n")
+	fmt.Fprintf(os.Stderr, "Removing project directory %s...\n", projectDir)
+	if err := os.RemoveAll(projectDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to remove project directory: %v\n", err)
+	}
+	fmt.Fprintf(os.Stderr, "Cleanup complete.\n")
+}
+
+type worktreeEntry struct {
+	path   string
+	branch string
+	isBare bool
+}
+
+// parseWorktreeList parses the output of `git worktree list --porcelain`
+// into a slice of worktreeEntry structs.
+func parseWorktreeList(output string) []worktreeEntry {
+	var entries []worktreeEntry
+	var current worktreeEntry
+	inEntry := false
+
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "worktree ") {
+			if inEntry {
+				entries = append(entries, current)
+			}
+			// git prints forward slashes on every platform
+			current = worktreeEntry{path: filepath.FromSlash(strings.TrimPrefix(line, "worktree "))}
+			inEntry = true
+		} else if line == "bare" {
+			current.isBare = true
+		} else if strings.HasPrefix(line, "branch ") {
+			ref := strings.TrimPrefix(line, "branch ")
+			current.branch = strings.TrimPrefix(ref, "refs/heads/")
+		} else if line == "" {
+			if inEntry {
+				entries = append(entries, current)
+				current = worktreeEntry{}
+				inEntry = false
+			}
+		}
+	}
+	// Handle last entry if output doesn't end with a blank line
+	if inEntry {
+		entries = append(entries, current)
+	}
+
+	return entries
+}
+
+func cmdProjects() error {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("could not determine home directory: %w", err)
+	}
+
+	projectsDir := filepath.Join(homeDir, "Projects")
+	entries, err := os.ReadDir(projectsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Println("No ~/Projects directory found.")
+			return nil
+		}
+		return fmt.Errorf("reading ~/Projects: %w", err)
+	}
+
+	type worktreeInfo struct {
+		name   string
+		branch string
+	}
+
+	type projectInfo struct {
+		name       string
+		path       string
+		worktrees  []worktreeInfo
+	}
+
+	var projects []projectInfo
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		dirPath := filepath.Join(projectsDir, entry.Name())
+		spacesDir := filepath.Join(dirPath, "spaces")
+
+		if info, err := os.Stat(spacesDir); err != nil || !info.IsDir() {
+			continue
+		}
+
+		// Run git worktree list --porcelain
+		cmd := exec.Command(gitBin, "worktree", "list", "--porcelain")
+		cmd.Dir = dirPath
+		out, err := cmd.Output()
+		if err != nil {
+			continue
+		}
+
+		var worktrees []worktreeInfo
+		for _, entry := range parseWorktreeList(string(out)) {
+			if !entry.isBare && strings.HasPrefix(entry.path, spacesDir+string(filepath.Separator)) {
+				name := strings.TrimPrefix(entry.path, spacesDir+string(filepath.Separator))
+				worktrees = append(worktrees, worktreeInfo{name: name, branch: entry.branch})
+			}
+		}
+
+		projects = append(projects, projectInfo{
+			name:      entry.Name(),
+			path:      dirPath,
+			worktrees: worktrees,
+		})
+	}
+
+	if len(projects) == 0 {
+		fmt.Println("No workspace projects found in ~/Projects.")
+		return nil
+	}
+
+	for i, proj := range projects {
+		fmt.Printf("%s (~/Projects/%s)\n", proj.name, proj.name)
+
+		if len(proj.worktrees) == 0 {
+			fmt.Println("  (no worktrees)")
+		} else {
+			maxName := 0
+			for _, wt := range proj.worktrees {
+				if len(wt.name) > maxName {
+					maxName = len(wt.name)
+				}
+			}
+			for _, wt := range proj.worktrees {
+				if wt.branch != "" {
+					fmt.Printf("  %-*s  (%s)\n", maxName, wt.name, wt.branch)
+				} else {
+					fmt.Printf("  %-*s  (detached)\n", maxName, wt.name)
+				}
+			}
+		}
+
+		if i < len(projects)-1 {
+			fmt.Println()
+		}
+	}
+	return nil
+}
+
+// workspace is a worktree under spaces/ as shown by the list command.
+type workspace struct {
+	name    string
+	branch  string
+	path    string
+	modTime time.Time
+	stray   bool
+	frozen  bool
+
+	// Filled in by addWorkspaceDetails for list --details
+	ddevName   string
+	identifier string
+	headSHA    string
+
+	// Filled in by filterStale for list --stale
+	staleReasons []string
+}
+
+// collectWorkspaces returns the worktrees under spaces/ with their
+// directory modification times.
+func collectWorkspaces(projectRoot string) ([]workspace, error) {
+	worktrees, err := spaceWorktrees(projectRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	spacesDir := filepath.Join(projectRoot, "spaces")
+	locations, _ := loadWorktreeLocations(projectRoot)
+	frozen, err := loadFrozen(projectRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	var workspaces []workspace
+	for _, entry := range worktrees {
+		ws := workspace{
+			name:   strings.TrimPrefix(entry.path, spacesDir+string(filepath.Separator)),
+			branch: entry.branch,
+			path:   entry.path,
+		}
+		if name := movedWorktreeName(locations, entry.path); name != "" {
+			ws.name = name
+		}
+		_, ws.frozen = frozen[ws.name]
+		if info, err := os.Stat(entry.path); err == nil {
+			ws.modTime = info.ModTime()
+		}
+		workspaces = append(workspaces, ws)
+	}
+	return workspaces, nil
+}
+
+// parseAge parses an age such as "14d", "2w", or any time.ParseDuration
+// value ("36h").
+func parseAge(value string) (time.Duration, error) {
+	units := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	if len(value) > 1 {
+		if unit, ok := units[value[len(value)-1]]; ok {
+			n, err := strconv.Atoi(value[:len(value)-1])
+			if err == nil && n > 0 {
+				return time.Duration(n) * unit, nil
+			}
+		}
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age <= 0 {
+		return 0, fmt.Errorf("invalid age %q (expected e.g. 14d, 2w, or 36h)", value)
+	}
+	return age, nil
+}
+
+// filterOlderThan returns the workspaces whose directories were last modified
+// more than age before now.
+func filterOlderThan(workspaces []workspace, age time.Duration, now time.Time) []workspace {
+	cutoff := now.Add(-age)
+	var old []workspace
+	for _, ws := range workspaces {
+		if ws.modTime.Before(cutoff) {
+			old = append(old, ws)
+		}
+	}
+	return old
+}
+
+type listArgs struct {
+	sortBy      string
+	reverse     bool
+	all         bool
+	olderThan   time.Duration
+	allProjects bool
+	json        bool
+	details     bool
+	stale       bool
+}
+
+// parseListArgs parses the arguments for the "list" subcommand.
+func parseListArgs(args []string) (listArgs, error) {
+	parsed := listArgs{sortBy: "name"}
+
+	for i := 0; i < len(args); i++ {
+		if value, n, err := parseValueFlag(args, i, "--sort"); err != nil {
+			return listArgs{}, err
+		} else if n > 0 {
+			parsed.sortBy = value
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--older-than"); err != nil {
+			return listArgs{}, err
+		} else if n > 0 {
+			age, err := parseAge(value)
+			if err != nil {
+				return listArgs{}, err
+			}
+			parsed.olderThan = age
+			i += n - 1
+		} else if args[i] == "--reverse" {
+			parsed.reverse = true
+		} else if args[i] == "--all" {
+			parsed.all = true
+		} else if args[i] == "--all-projects" {
+			parsed.allProjects = true
+		} else if args[i] == "--json" {
+			parsed.json = true
+		} else if args[i] == "--details" {
+			parsed.details = true
+		} else if args[i] == "--stale" {
+			parsed.stale = true
+		} else {
+			return listArgs{}, fmt.Errorf("unexpected argument: %s", args[i])
+		}
+	}
+
+	switch parsed.sortBy {
+	case "name", "branch", "mtime":
+	default:
+		return listArgs{}, fmt.Errorf("invalid --sort value %q (expected name, branch, or mtime)", parsed.sortBy)
+	}
+
+	return parsed, nil
+}
+
+// sortWorkspaces sorts workspaces in place by name, branch, or directory
+// modification time (most recent first). Ties are broken by name.
+func sortWorkspaces(workspaces []workspace, sortBy string, reverse bool) {
+	less := func(a, b workspace) bool {
+		switch sortBy {
+		case "branch":
+			if a.branch != b.branch {
+				return a.branch < b.branch
+			}
+		case "mtime":
+			if !a.modTime.Equal(b.modTime) {
+				return a.modTime.After(b.modTime)
+			}
+		}
+		return a.name < b.name
+	}
+
+	sort.SliceStable(workspaces, func(i, j int) bool {
+		if reverse {
+			return less(workspaces[j], workspaces[i])
+		}
+		return less(workspaces[i], workspaces[j])
+	})
+}
+
+func cmdList(args []string) error {
+	parsed, err := parseListArgs(args)
+	if err != nil {
+		return usageError(err, "Usage: workspace list [--sort name|branch|mtime] [--reverse] [--all] [--older-than <age>] [--all-projects] [--json] [--details] [--stale]")
+	}
+
+	if parsed.allProjects {
+		return listAllProjects(parsed)
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	if parsed.json {
+		workspaces, err := selectWorkspaces(projectRoot, parsed)
+		if err != nil {
+			return fmt.Errorf("listing worktrees: %w", err)
+		}
+		return writeJSON(os.Stdout, projectListing(projectRoot, workspaces))
+	}
+	if err := printWorkspaceList(projectRoot, parsed); err != nil {
+		return fmt.Errorf("listing worktrees: %w", err)
+	}
+	return nil
+}
+
+// workspaceJSON is one workspace in list --json output; the DDEV and HEAD
+// fields are only filled in with --details.
+type workspaceJSON struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Branch     string    `json:"branch"`
+	Modified   time.Time `json:"modified"`
+	Stray      bool      `json:"stray,omitempty"`
+	Frozen     bool      `json:"frozen,omitempty"`
+	DDEVName   string    `json:"ddev_name,omitempty"`
+	Identifier string    `json:"identifier,omitempty"`
+	HeadSHA    string    `json:"head_sha,omitempty"`
+	Stale      []string  `json:"stale,omitempty"`
+}
+
+// projectListingJSON groups a project's workspaces in list --json output.
+type projectListingJSON struct {
+	Project    string          `json:"project"`
+	Error      string          `json:"error,omitempty"`
+	Workspaces []workspaceJSON `json:"workspaces"`
+}
+
+func projectListing(projectRoot string, workspaces []workspace) projectListingJSON {
+	listing := projectListingJSON{Project: projectRoot, Workspaces: []workspaceJSON{}}
+	for _, ws := range workspaces {
+		listing.Workspaces = append(listing.Workspaces, workspaceJSON{
+			Name:       ws.name,
+			Path:       ws.path,
+			Branch:     ws.branch,
+			Modified:   ws.modTime,
+			Stray:      ws.stray,
+			Frozen:     ws.frozen,
+			DDEVName:   ws.ddevName,
+			Identifier: ws.identifier,
+			HeadSHA:    ws.headSHA,
+			Stale:      ws.staleReasons,
+		})
+	}
+	return listing
+}
+
+func writeJSON(w io.Writer, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// addWorkspaceDetails reads each worktree's DDEV project name and HEAD,
+// and infers the identifier new used from the name in .ddev/config.yaml.
+// With a ddev_name_template the name can be laid out any way, so the
+// identifier is left unknown rather than guessed.
+func addWorkspaceDetails(projectRoot string, workspaces []workspace) {
+	config, err := loadConfig(projectRoot)
+	inferable := err == nil && config.DDEVNameTemplate == ""
+	for i := range workspaces {
+		ws := &workspaces[i]
+		if ws.stray {
+			continue
+		}
+		if name, err := getDDEVProjectName(ws.path); err == nil {
+			ws.ddevName = name
+			if original, err := readDDEVName(filepath.Join(ddevRoot(ws.path), ".ddev", "config.yaml")); err == nil && inferable {
+				ws.identifier = inferIdentifier(name, original)
+			}
+		}
+		if sha, err := resolveCommitish(ws.path, "HEAD"); err == nil {
+			ws.headSHA = sha
+		}
+	}
+}
+
+// inferIdentifier recovers the identifier from a workspace's DDEV name and
+// the project's original name, for either naming scheme. It is empty when
+// the workspace kept the original name.
+func inferIdentifier(ddevName, originalName string) string {
+	original := normalizeDDEVName(originalName)
+	switch {
+	case ddevName == original:
+		return ""
+	case strings.HasSuffix(ddevName, "-"+original):
+		return strings.TrimSuffix(ddevName, "-"+original)
+	case strings.HasPrefix(ddevName, original+"-"):
+		return strings.TrimPrefix(ddevName, original+"-")
+	}
+	return ""
+}
+
+// Reasons filterStale gives for a worktree being stale.
+const (
+	staleGone       = "gone"
+	staleMerged     = "merged"
+	staleNoUpstream = "no-upstream"
+)
+
+// filterStale returns the worktrees whose branch looks finished, with the
+// reasons why: its upstream was deleted on the remote (gone, as of the last
+// fetch --prune), it is merged into the base branch, or it never had an
+// upstream. Worktrees on develop, main, or master, detached ones, and stray
+// directories are never stale.
+func filterStale(projectRoot string, workspaces []workspace) []workspace {
+	upstreams := branchUpstreams(projectRoot)
+	base := defaultBaseRef(projectRoot)
+
+	var stale []workspace
+	for _, ws := range workspaces {
+		if ws.stray || ws.branch == "" || ws.branch == "develop" || ws.branch == "main" || ws.branch == "master" {
+			continue
+		}
+		var reasons []string
+		switch upstream, ok := upstreams[ws.branch]; {
+		case !ok || upstream.ref == "":
+			reasons = append(reasons, staleNoUpstream)
+		case upstream.gone:
+			reasons = append(reasons, staleGone)
+		}
+		if base != "" && branchMerged(projectRoot, ws.branch, base) {
+			reasons = append(reasons, staleMerged)
+		}
+		if len(reasons) > 0 {
+			ws.staleReasons = reasons
+			stale = append(stale, ws)
+		}
+	}
+	return stale
+}
+
+// branchUpstream is a local branch's configured upstream; gone means the
+// remote-tracking ref no longer exists.
+type branchUpstream struct {
+	ref  string
+	gone bool
+}
+
+// branchUpstreams returns the upstream of every local branch, read with a
+// single git for-each-ref.
+func branchUpstreams(projectRoot string) map[string]branchUpstream {
+	out, err := gitOutput(projectRoot, "for-each-ref", "--format=%(refname:short)%00%(upstream)%00%(upstream:track)", "refs/heads")
+	if err != nil {
+		return nil
+	}
+	return parseBranchUpstreams(out)
+}
+
+func parseBranchUpstreams(out string) map[string]branchUpstream {
+	upstreams := make(map[string]branchUpstream)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 3 || fields[0] == "" {
+			continue
+		}
+		upstreams[fields[0]] = branchUpstream{ref: fields[1], gone: fields[2] == "[gone]"}
+	}
+	return upstreams
+}
+
+// listAllProjects lists the workspaces of every registered project, grouped
+// by project root.
+func listAllProjects(parsed listArgs) error {
+	roots, err := loadRegistry()
+	if err != nil {
+		return fmt.Errorf("reading project registry: %w", err)
+	}
+	if len(roots) == 0 {
+		fmt.Println("No registered projects. Projects are registered by workspace init.")
+		return nil
+	}
+
+	if parsed.json {
+		listings := []projectListingJSON{}
+		for _, root := range roots {
+			if !isProjectRoot(root) {
+				listings = append(listings, projectListingJSON{Project: root, Error: "missing or not a workspace project", Workspaces: []workspaceJSON{}})
+				continue
+			}
+			workspaces, err := selectWorkspaces(root, parsed)
+			if err != nil {
+				listings = append(listings, projectListingJSON{Project: root, Error: err.Error(), Workspaces: []workspaceJSON{}})
+				continue
+			}
+			listings = append(listings, projectListing(root, workspaces))
+		}
+		return writeJSON(os.Stdout, listings)
+	}
+
+	for i, root := range roots {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s\n", root)
+		if !isProjectRoot(root) {
+			fmt.Println("  (missing or not a workspace project)")
+			continue
+		}
+		if err := printWorkspaceList(root, parsed); err != nil {
+			fmt.Printf("  (error: %v)\n", err)
+		}
+	}
+	return nil
+}
+
+// selectWorkspaces returns the workspaces of one project (plus stray
+// directories with --all) filtered and sorted according to the list options.
+func selectWorkspaces(projectRoot string, parsed listArgs) ([]workspace, error) {
+	workspaces, err := collectWorkspaces(projectRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	spacesDir := filepath.Join(projectRoot, "spaces")
+
+	if parsed.olderThan > 0 {
+		workspaces = filterOlderThan(workspaces, parsed.olderThan, time.Now())
+	}
+
+	var strays []string
+	if parsed.all && parsed.olderThan == 0 {
+		var names []string
+		for _, ws := range workspaces {
+			names = append(names, ws.name)
+		}
+		strays, err = findStrayDirs(spacesDir, names)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not read %s: %v\n", spacesDir, err)
+		}
+	}
+
+	for _, name := range strays {
+		ws := workspace{name: name, path: filepath.Join(spacesDir, name), stray: true}
+		if info, err := os.Stat(ws.path); err == nil {
+			ws.modTime = info.ModTime()
+		}
+		workspaces = append(workspaces, ws)
+	}
+
+	if parsed.stale {
+		workspaces = filterStale(projectRoot, workspaces)
+	}
+
+	sortWorkspaces(workspaces, parsed.sortBy, parsed.reverse)
+	if parsed.details {
+		addWorkspaceDetails(projectRoot, workspaces)
+	}
+	return workspaces, nil
+}
+
+// printWorkspaceList prints the workspaces of one project according to the
+// list options.
+func printWorkspaceList(projectRoot string, parsed listArgs) error {
+	workspaces, err := selectWorkspaces(projectRoot, parsed)
+	if err != nil {
+		return err
+	}
+	if len(workspaces) == 0 {
+		fmt.Println("No workspaces found.")
+		return nil
+	}
+
+	// Find the longest name and branch label for alignment
+	labels := make([]string, len(workspaces))
+	maxName, maxLabel := 0, 0
+	for i, ws := range workspaces {
+		if ws.stray {
+			labels[i] = "(not a worktree)"
+		} else if ws.branch != "" {
+			labels[i] = "(" + ws.branch + ")"
+		} else {
+			labels[i] = "(detached)"
+		}
+		if ws.frozen {
+			labels[i] += " [frozen]"
+		}
+		maxName = max(maxName, len(ws.name))
+		maxLabel = max(maxLabel, len(labels[i]))
+	}
+
+	// Stale reasons form a column of their own after the branch
+	if parsed.stale {
+		width := maxLabel
+		for i, ws := range workspaces {
+			labels[i] = fmt.Sprintf("%-*s  %s", width, labels[i], strings.Join(ws.staleReasons, ", "))
+			maxLabel = max(maxLabel, len(labels[i]))
+		}
+	}
+
+	for i, ws := range workspaces {
+		if !parsed.details || ws.stray {
+			fmt.Printf("  %-*s  %s\n", maxName, ws.name, labels[i])
+			continue
+		}
+		ddevName, identifier := ws.ddevName, ws.identifier
+		if ddevName == "" {
+			ddevName = "-"
+		}
+		if identifier == "" {
+			identifier = "-"
+		}
+		fmt.Printf("  %-*s  %-*s  %s  ddev: %s  id: %s\n", maxName, ws.name, maxLabel, labels[i], shortSHA(ws.headSHA), ddevName, identifier)
+	}
+	return nil
+}
+
+type newArgs struct {
+	worktreeName       string
+	identifier         string
+	baseBranch         string
+	identifierExplicit bool
+	postImportCmd      string
+	quiet              bool
+	assignPorts        bool
+	env                []string
+	reuseDB            string
+	checkout           bool
+	logFile            string
+	log                bool
+	dirScheme          string
+	runHooks           bool
+	namingScheme       string
+	waitHealthy        bool
+	waitTimeout        time.Duration
+	only               map[string]bool
+	branchPrefix       string
+	dbImport           dbImportOptions
+	duplicateOf        string
+	autoIdentifier     bool
+	openEditor         bool
+	printPath          bool
+	pr                 int
+	progressJSON       string
+	fetch              bool
+	trace              bool
+	detach             bool
+	copyFrom           string
+	pauseOnError       bool
+	hotfix             bool
+}
+
+// fetchBase brings the base up to date for new --fetch. A remote branch is
+// fetched straight into its remote-tracking ref, which also works when the
+// fetch refspec leaves it out (init --no-fetch-all); any other base gets a
+// plain fetch of origin. Unlike new's usual fetch, a failure is an error.
+func fetchBase(projectRoot, base string) (string, error) {
+	branch, ok := remoteBaseBranch(base)
+	args := []string{"fetch", "origin"}
+	if ok {
+		args = append(args, "+refs/heads/"+branch+":refs/remotes/origin/"+branch)
+	}
+	if err := runPhase("Fetching latest changes", func() error {
+		return runCommandLive(projectRoot, gitBin, args...)
+	}); err != nil {
+		return "", withHints(fmt.Errorf("--fetch: fetching from origin: %w", err), "Drop --fetch to branch from the refs already fetched.")
+	}
+	if !ok {
+		return "origin", nil
+	}
+	sha, err := resolveCommitish(projectRoot, "origin/"+branch)
+	if err != nil {
+		return "origin/" + branch, nil
+	}
+	return fmt.Sprintf("origin/%s (%s)", branch, shortSHA(sha)), nil
+}
+
+const (
+	// staleBaseCommits is how many commits behind origin a defaulted base
+	// has to be before new warns; a few are normal between fetches.
+	staleBaseCommits = 10
+	// staleBaseTimeout bounds the ls-remote behind the check, so new isn't
+	// held up when offline or origin is slow; it just goes unreported.
+	staleBaseTimeout = 5 * time.Second
+)
+
+// baseStaleness compares the remote-tracking base (e.g. origin/develop), at
+// sha, with the branch on origin as git ls-remote reports it now. It returns
+// how far behind the local ref is, e.g. "12 commits behind origin", or ""
+// when it is current or less than staleBaseCommits behind, isn't a remote
+// branch, or origin can't be reached.
+func baseStaleness(projectRoot, base, sha string) string {
+	branch, ok := remoteBaseBranch(base)
+	if !ok {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), staleBaseTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, gitBin, "ls-remote", "origin", "refs/heads/"+branch)
+	cmd.Dir = projectRoot
+	// Fail instead of waiting for a password that will never be typed
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_SSH_COMMAND="+sshBatchCommand())
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 || fields[0] == sha {
+		return ""
+	}
+	remoteSHA := fields[0]
+
+	// The commit is only here to count from if some fetch brought it in
+	if _, err := gitOutput(projectRoot, "cat-file", "-e", remoteSHA+"^{commit}"); err != nil {
+		return describeStaleness(-1, remoteSHA)
+	}
+	count, err := gitOutput(projectRoot, "rev-list", "--count", sha+".."+remoteSHA)
+	if err != nil {
+		return ""
+	}
+	behind, _ := strconv.Atoi(count)
+	return describeStaleness(behind, remoteSHA)
+}
+
+// describeStaleness words how far a base is behind origin, whose branch is
+// at remoteSHA: behind commits, or -1 when that commit hasn't been fetched.
+// Zero commits behind means origin's branch was rewritten. Fewer than
+// staleBaseCommits commits aren't worth mentioning and return "".
+func describeStaleness(behind int, remoteSHA string) string {
+	switch {
+	case behind < 0:
+		return "behind origin (its " + shortSHA(remoteSHA) + " isn't fetched)"
+	case behind == 0:
+		return "out of date (origin's branch was rewritten to " + shortSHA(remoteSHA) + ")"
+	case behind < staleBaseCommits:
+		return ""
+	}
+	return fmt.Sprintf("%d commits behind origin", behind)
+}
+
+// staleDetail appends a staleness note to the summary's base line.
+func staleDetail(staleness string) string {
+	if staleness == "" {
+		return ""
+	}
+	return ", " + staleness
+}
+
+// remoteBaseBranch returns the branch on origin that base names, if it is
+// a remote-tracking ref like origin/develop.
+func remoteBaseBranch(base string) (string, bool) {
+	base = strings.TrimPrefix(base, "refs/remotes/")
+	branch, ok := strings.CutPrefix(base, "origin/")
+	if !ok || branch == "" || branch == "HEAD" {
+		return "", false
+	}
+	return branch, true
+}
+
+// cmdDuplicate forks a workspace: a new branch from the source worktree's
+// HEAD, set up like new with its own DDEV identifier, and a copy of the
+// source's database.
+func cmdDuplicate(args []string) error {
+	usage := "Usage: workspace duplicate [--identifier <id>] <source> <new-name>"
+	var positional []string
+	identifier := ""
+	for i := 0; i < len(args); i++ {
+		if value, n, err := parseValueFlag(args, i, "--identifier"); err != nil {
+			return usageError(err, usage)
+		} else if n > 0 {
+			identifier = value
+			i += n - 1
+		} else {
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 2 {
+		return usageError(fmt.Errorf("expected 2 arguments, got %d", len(positional)), usage)
+	}
+	source, newName := positional[0], positional[1]
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+	sourcePath, sourceBranch, err := resolveWorktree(projectRoot, source)
+	if err != nil {
+		return err
+	}
+	headSHA, err := resolveCommitish(sourcePath, "HEAD")
+	if err != nil {
+		return fmt.Errorf("could not resolve HEAD of %s: %w", source, err)
+	}
+	if status, err := gitOutput(sourcePath, "status", "--porcelain"); err == nil && status != "" {
+		fmt.Fprintf(os.Stderr, "Warning: uncommitted changes in %s are not copied\n", source)
+	}
+
+	// The identifier derived from a forked name usually matches the
+	// source's (0001-foo-b -> 0001), so the whole name is used instead.
+	if identifier == "" {
+		identifier = newName
+	}
+	base, lineage := headSHA, fmt.Sprintf("%s (detached @ %s)", filepath.Base(sourcePath), shortSHA(headSHA))
+	if sourceBranch != "" {
+		base, lineage = sourceBranch, fmt.Sprintf("%s (branch %s @ %s)", filepath.Base(sourcePath), sourceBranch, shortSHA(headSHA))
+	}
+	opts := newArgs{
+		worktreeName:       newName,
+		identifier:         identifier,
+		identifierExplicit: true,
+		baseBranch:         base,
+		duplicateOf:        lineage,
+	}
+	if _, err := getDDEVProjectName(sourcePath); err == nil {
+		opts.reuseDB = source
+	}
+	return cmdNew(opts)
+}
+
+// prefixedBranchName prepends prefix to name unless name already starts
+// with it or is one of the long-lived default branches.
+func prefixedBranchName(name, prefix string) string {
+	if prefix == "" || strings.HasPrefix(name, prefix) || name == "develop" || name == "main" {
+		return name
+	}
+	return prefix + name
+}
+
+// Phases of new that --only can select, in the order they run.
+var newPhases = []string{"worktree", "rename", "settings", "start", "db"}
+
+// parseOnlyPhases parses the comma-separated --only list. "ddev" is
+// shorthand for rename, settings, and start.
+func parseOnlyPhases(value string) (map[string]bool, error) {
+	only := map[string]bool{}
+	for _, phase := range strings.Split(value, ",") {
+		phase = strings.TrimSpace(phase)
+		switch {
+		case phase == "ddev":
+			only["rename"], only["settings"], only["start"] = true, true, true
+		case containsString(newPhases, phase):
+			only[phase] = true
+		default:
+			return nil, fmt.Errorf("unknown --only phase %q (expected %s, or ddev)", phase, strings.Join(newPhases, ", "))
+		}
+	}
+	return only, nil
+}
+
+// runsPhase reports whether new should run phase; every phase runs unless
+// --only narrowed the set.
+func runsPhase(only map[string]bool, phase string) bool {
+	return only == nil || only[phase]
+}
+
+// skippedPhase is the summary line for a phase left out by --only.
+func skippedPhase(description string) StepResult {
+	return StepResult{Description: description, Detail: "Skipped (not in --only)"}
+}
+
+// defaultWaitTimeout is how long new --wait-healthy waits for the database.
+const defaultWaitTimeout = 2 * time.Minute
+
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseEnvAssignment validates a KEY=VALUE pair given to --env.
+func parseEnvAssignment(value string) (string, error) {
+	key, _, ok := strings.Cut(value, "=")
+	if !ok || !envNameRe.MatchString(key) {
+		return "", fmt.Errorf("--env expects KEY=VALUE, got %q", value)
+	}
+	return value, nil
+}
+
+// parseValueFlag checks whether args[i] is the flag name, given either as
+// "name value" or "name=value". It returns the flag's value and the number of
+// arguments consumed, which is 0 when args[i] is not the flag.
+func parseValueFlag(args []string, i int, name string) (value string, consumed int, err error) {
+	if args[i] == name {
+		if i+1 >= len(args) {
+			return "", 0, fmt.Errorf("%s requires a value", name)
+		}
+		return args[i+1], 2, nil
+	}
+	if strings.HasPrefix(args[i], name+"=") {
+		return strings.TrimPrefix(args[i], name+"="), 1, nil
+	}
+	return "", 0, nil
+}
+
+// parseNewArgs parses the arguments for the "new" subcommand.
+func parseNewArgs(args []string) (newArgs, error) {
+	parsed := newArgs{waitTimeout: defaultWaitTimeout}
+	var positional []string
+	identifierFlag := ""
+
+	for i := 0; i < len(args); i++ {
+		if value, n, err := parseValueFlag(args, i, "--post-import-cmd"); err != nil {
+			return newArgs{}, err
+		} else if n > 0 {
+			parsed.postImportCmd = value
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--env"); err != nil {
+			return newArgs{}, err
+		} else if n > 0 {
+			assignment, err := parseEnvAssignment(value)
+			if err != nil {
+				return newArgs{}, err
+			}
+			parsed.env = append(parsed.env, assignment)
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--reuse-db"); err != nil {
+			return newArgs{}, err
+		} else if n > 0 {
+			parsed.reuseDB = value
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--copy-from"); err != nil {
+			return newArgs{}, err
+		} else if n > 0 {
+			if value == "" {
+				return newArgs{}, fmt.Errorf("--copy-from needs a workspace name")
+			}
+			parsed.copyFrom = value
+			i += n - 1
+		} else if args[i] == "--base" {
+			if i+1 >= len(args) {
+				return newArgs{}, fmt.Errorf("--base requires a branch name")
+			}
+			parsed.baseBranch = args[i+1]
+			i++
+		} else if strings.HasPrefix(args[i], "--base=") {
+			parsed.baseBranch = strings.TrimPrefix(args[i], "--base=")
+		} else if args[i] == "--quiet" {
+			parsed.quiet = true
+		} else if args[i] == "--assign-ports" {
+			parsed.assignPorts = true
+		} else if args[i] == "--auto-identifier" {
+			parsed.autoIdentifier = true
+		} else if value, n, err := parseValueFlag(args, i, "--pr"); err != nil {
+			return newArgs{}, err
+		} else if n > 0 {
+			number, err := strconv.Atoi(strings.TrimPrefix(value, "#"))
+			if err != nil || number <= 0 {
+				return newArgs{}, fmt.Errorf("invalid --pr %q (expected a pull request number)", value)
+			}
+			parsed.pr = number
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--progress-json"); err != nil {
+			return newArgs{}, err
+		} else if n > 0 {
+			parsed.progressJSON = value
+			i += n - 1
+		} else if args[i] == "--open" {
+			parsed.openEditor = true
+		} else if args[i] == "--print-path" {
+			parsed.printPath = true
+		} else if args[i] == "--checkout" {
+			parsed.checkout = true
+		} else if args[i] == "--fetch" {
+			parsed.fetch = true
+		} else if args[i] == "--trace" {
+			parsed.trace = true
+		} else if args[i] == "--detach" {
+			parsed.detach = true
+		} else if args[i] == "--pause-on-error" {
+			parsed.pauseOnError = true
+		} else if args[i] == "--hotfix" {
+			parsed.hotfix = true
+		} else if value, n, err := parseValueFlag(args, i, "--log-file"); err != nil {
+			return newArgs{}, err
+		} else if n > 0 {
+			parsed.logFile = value
+			parsed.log = true
+			i += n - 1
+		} else if args[i] == "--log" {
+			parsed.log = true
+		} else if args[i] == "--run-hooks" {
+			parsed.runHooks = true
+		} else if args[i] == "--wait-healthy" {
+			parsed.waitHealthy = true
+		} else if value, n, err := parseValueFlag(args, i, "--wait-timeout"); err != nil {
+			return newArgs{}, err
+		} else if n > 0 {
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return newArgs{}, fmt.Errorf("invalid --wait-timeout %q (expected a duration like 90s or 5m)", value)
+			}
+			parsed.waitTimeout = timeout
+			parsed.waitHealthy = true
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--naming-scheme"); err != nil {
+			return newArgs{}, err
+		} else if n > 0 {
+			if !validNamingScheme(value) {
+				return newArgs{}, fmt.Errorf("invalid --naming-scheme %q (expected prefix or suffix)", value)
+			}
+			parsed.namingScheme = value
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--dir-scheme"); err != nil {
+			return newArgs{}, err
+		} else if n > 0 {
+			if !validDirScheme(value) {
+				return newArgs{}, fmt.Errorf("invalid --dir-scheme %q (expected name or identifier)", value)
+			}
+			parsed.dirScheme = value
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--identifier"); err != nil {
+			return newArgs{}, err
+		} else if n > 0 {
+			if value == "" {
+				return newArgs{}, fmt.Errorf("--identifier cannot be empty")
+			}
+			identifierFlag = value
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--db-file"); err != nil {
+			return newArgs{}, err
+		} else if n > 0 {
+			parsed.dbImport.file = value
+			i += n - 1
+		} else if args[i] == "--db-prompt" {
+			parsed.dbImport.prompt = true
+		} else if args[i] == "--no-prompt-db" {
+			parsed.dbImport.noPrompt = true
+		} else if args[i] == "--dry-run-db" {
+			parsed.dbImport.dryRun = true
+		} else if value, n, err := parseValueFlag(args, i, "--db-exclude-tables"); err != nil {
+			return newArgs{}, err
+		} else if n > 0 {
+			tables, err := parseExcludeTables(value)
+			if err != nil {
+				return newArgs{}, err
+			}
+			parsed.dbImport.excludeTables = tables
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--branch-prefix"); err != nil {
+			return newArgs{}, err
+		} else if n > 0 {
+			parsed.branchPrefix = value
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--only"); err != nil {
+			return newArgs{}, err
+		} else if n > 0 {
+			only, err := parseOnlyPhases(value)
+			if err != nil {
+				return newArgs{}, err
+			}
+			parsed.only = only
+			i += n - 1
+		} else {
+			positional = append(positional, args[i])
+		}
+	}
+
+	// A pull request names its own workspace unless one is given
+	if parsed.pr > 0 && len(positional) == 0 {
+		positional = []string{fmt.Sprintf("pr-%d", parsed.pr)}
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		return newArgs{}, fmt.Errorf("expected 1 or 2 positional arguments, got %d", len(positional))
+	}
+
+	parsed.worktreeName = positional[0]
+	if parsed.worktreeName == "" {
+		return newArgs{}, fmt.Errorf("worktree name cannot be empty")
+	}
+	if parsed.checkout && parsed.baseBranch != "" {
+		return newArgs{}, fmt.Errorf("--checkout uses the existing branch and cannot be combined with --base")
+	}
+	if parsed.pr > 0 && (parsed.checkout || parsed.baseBranch != "") {
+		return newArgs{}, fmt.Errorf("--pr checks out the pull request and cannot be combined with --base or --checkout")
+	}
+	if parsed.hotfix {
+		if parsed.baseBranch != "" || parsed.checkout || parsed.pr > 0 || parsed.detach {
+			return newArgs{}, fmt.Errorf("--hotfix picks the base itself and cannot be combined with --base, --checkout, --pr, or --detach")
+		}
+		if parsed.branchPrefix == "" {
+			parsed.branchPrefix = hotfixBranchPrefix
+		}
+	}
+	if parsed.detach {
+		if parsed.checkout || parsed.pr > 0 {
+			return newArgs{}, fmt.Errorf("--detach creates no branch and cannot be combined with --checkout or --pr")
+		}
+		// The name is what to check out unless --base says otherwise
+		if parsed.baseBranch == "" {
+			parsed.baseBranch = parsed.worktreeName
+		}
+	}
+	if parsed.reuseDB != "" && (parsed.dbImport.file != "" || parsed.dbImport.prompt || parsed.dbImport.excludeTables != nil || parsed.dbImport.dryRun) {
+		return newArgs{}, fmt.Errorf("--reuse-db cannot be combined with --db-file, --db-prompt, --db-exclude-tables, or --dry-run-db")
+	}
+	if parsed.dbImport.file != "" && parsed.dbImport.prompt {
+		return newArgs{}, fmt.Errorf("--db-file and --db-prompt cannot be combined")
+	}
+	if parsed.dbImport.prompt && parsed.dbImport.noPrompt {
+		return newArgs{}, fmt.Errorf("--db-prompt and --no-prompt-db cannot be combined")
+	}
+	// A database can only be imported into a project that is running, and
+	// one created in this run can't be running unless start runs too.
+	if parsed.only != nil && parsed.only["db"] && parsed.only["worktree"] && !parsed.only["start"] {
+		return newArgs{}, fmt.Errorf("--only db needs start when worktree is also selected")
+	}
+
+	// The second positional is the older spelling of --identifier
+	parsed.identifierExplicit = len(positional) == 2 || identifierFlag != ""
+	if parsed.autoIdentifier && parsed.identifierExplicit {
+		return newArgs{}, fmt.Errorf("--auto-identifier cannot be combined with an explicit identifier")
+	}
+	if len(positional) == 2 {
+		fmt.Fprintf(os.Stderr, "Warning: the positional identifier is deprecated; use --identifier %s\n", positional[1])
+	}
+	switch {
+	case parsed.autoIdentifier:
+		parsed.identifier = hashIdentifier(parsed.worktreeName, 0)
+		parsed.identifierExplicit = true
+	case identifierFlag != "":
+		if len(positional) == 2 && positional[1] != identifierFlag {
+			fmt.Fprintf(os.Stderr, "Warning: both --identifier %s and positional identifier %s given; using %s\n", identifierFlag, positional[1], identifierFlag)
+		}
+		parsed.identifier = identifierFlag
+	case len(positional) == 2:
+		parsed.identifier = positional[1]
+	case parsed.pr > 0:
+		parsed.identifier = fmt.Sprintf("pr%d", parsed.pr)
+	default:
+		parsed.identifier = deriveIdentifier(parsed.worktreeName)
+	}
+
+	return parsed, nil
+}
+
+func cmdNewFromArgs(args []string) error {
+	parsed, err := parseNewArgs(args)
+	if err != nil {
+		return usageError(err, "Usage: workspace new [--base <branch>] [--post-import-cmd <cmd>] [--quiet] [--assign-ports] [--env KEY=VALUE]... [--reuse-db <workspace>] [--copy-from <workspace>] [--checkout] [--fetch] [--log | --log-file <path>] [--dir-scheme name|identifier] [--run-hooks] [--naming-scheme prefix|suffix] [--wait-healthy] [--wait-timeout <duration>] [--only <phases>] [--branch-prefix <prefix>] [--db-file <path> | --db-prompt | --no-prompt-db] [--db-exclude-tables <tables>] [--dry-run-db] [--identifier <id> | --auto-identifier] [--open] [--print-path] [--progress-json <path>] [--trace] [--detach] [--pause-on-error] [--hotfix] <worktree-name | --pr <number> [worktree-name]>")
+	}
+	return cmdNew(parsed)
+}
+
+func cmdNew(opts newArgs) (err error) {
+	worktreeName := opts.worktreeName
+	identifier := opts.identifier
+	baseBranch := opts.baseBranch
+	identifierExplicit := opts.identifierExplicit
+
+	// The identifier becomes part of the DDEV project name, so it must only
+	// contain characters DDEV accepts.
+	identifier = normalizeDDEVName(identifier)
+	if identifier == "" {
+		return fmt.Errorf("identifier %q has no characters usable in a DDEV project name", opts.identifier)
+	}
+
+	start := time.Now()
+	pathOut := os.Stdout
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	var logPath string
+	if opts.log {
+		var closeLog func(error)
+		var logErr error
+		logPath, closeLog, logErr = openOperationLog(projectRoot, "new", opts.logFile)
+		if logErr != nil {
+			return logErr
+		}
+		defer func() { closeLog(err) }()
+	}
+
+	// With --print-path, stdout carries only the final path so a shell can
+	// cd into it; everything else, subprocess output included, goes to out,
+	// stderr. It is picked once the log tees the streams, so it's logged too.
+	var out io.Writer = os.Stdout
+	if opts.printPath {
+		out = os.Stderr
+	}
+	stopProgress, err := startProgress("new", opts.progressJSON, out)
+	if err != nil {
+		return err
+	}
+	defer stopProgress()
+	if logPath != "" {
+		fmt.Fprintf(out, "Logging to %s\n", logPath)
+	}
+
+	config, err := loadConfig(projectRoot)
+	if err != nil {
+		return err
+	}
+	postImportCmd := opts.postImportCmd
+	if postImportCmd == "" {
+		postImportCmd = config.PostImportCommand
+	}
+
+	// A hashed identifier is regenerated until no DDEV project uses it
+	if opts.autoIdentifier {
+		taken := knownDDEVNames(projectRoot)
+		for attempt := 1; identifierTaken(identifier, taken); attempt++ {
+			identifier = hashIdentifier(worktreeName, attempt)
+		}
+	}
+
+	// The directory under spaces/ is the branch name unless the identifier
+	// scheme is chosen; the DDEV name below doesn't depend on it. Default
+	// branches without an explicit identifier always keep their name.
+	dirScheme := opts.dirScheme
+	if dirScheme == "" {
+		dirScheme = config.DirScheme
+	}
+	worktreeDir := worktreeName
+	keepsDefaultName := (worktreeName == "develop" || worktreeName == "main") && !identifierExplicit
+	if dirScheme == dirSchemeIdentifier && !keepsDefaultName {
+		worktreeDir = identifier
+	}
+
+	// The branch may carry a prefix (feature/, bugfix/) that the directory
+	// and identifier, both derived from the name as given, leave out.
+	branchPrefix := opts.branchPrefix
+	if branchPrefix == "" {
+		branchPrefix = config.BranchPrefix
+	}
+	branchName := prefixedBranchName(worktreeName, branchPrefix)
+	if opts.pr > 0 {
+		// The local branch mirrors the pull request, not a feature of ours
+		branchName = worktreeName
+	}
+	if opts.detach {
+		branchName = ""
+	}
+
+	// A named dump has to exist before anything is created for it, and so
+	// does the default one when there will be no prompt to ask for another
+	if opts.dbImport.file != "" {
+		if _, err := os.Stat(opts.dbImport.file); err != nil {
+			return fmt.Errorf("--db-file: %w", err)
+		}
+	} else if opts.dbImport.noPrompt && opts.reuseDB == "" && runsPhase(opts.only, "db") {
+		dumpDir, err := dbDir(projectRoot)
+		if err != nil {
+			return err
+		}
+		defaultPath := filepath.Join(dumpDir, "db.sql.gz")
+		if _, err := os.Stat(defaultPath); err != nil {
+			return withHints(fmt.Errorf("--no-prompt-db: no database dump found at %s", defaultPath),
+				"Put the dump there or pass --db-file <path>.")
+		}
+	}
+
+	// Validate the --reuse-db source before creating anything
+	var reuseDBPath string
+	if opts.reuseDB != "" {
+		if opts.reuseDB == worktreeName || opts.reuseDB == worktreeDir {
+			return fmt.Errorf("--reuse-db cannot copy the database from the workspace being created")
+		}
+		reuseDBPath, _, err = resolveWorktree(projectRoot, opts.reuseDB)
+		if err != nil {
+			return fmt.Errorf("--reuse-db %s: %w", opts.reuseDB, err)
+		}
+		if _, err := getDDEVProjectName(reuseDBPath); err != nil {
+			return fmt.Errorf("--reuse-db %s has no DDEV project", opts.reuseDB)
+		}
+	}
+
+	// Likewise the --copy-from source
+	var copyFromPath string
+	if opts.copyFrom != "" {
+		if opts.copyFrom == worktreeName || opts.copyFrom == worktreeDir {
+			return fmt.Errorf("--copy-from cannot copy files from the workspace being created")
+		}
+		copyFromPath, _, err = resolveWorktree(projectRoot, opts.copyFrom)
+		if err != nil {
+			return fmt.Errorf("--copy-from %s: %w", opts.copyFrom, err)
+		}
+	}
+
+	worktreePath := filepath.Join(projectRoot, "spaces", worktreeDir)
+	state := &cleanupState{worktreePath: worktreePath, projectRoot: projectRoot, pauseOnError: opts.pauseOnError}
+	var steps []StepResult
+	if opts.duplicateOf != "" {
+		steps = append(steps, StepResult{
+			Description: "Duplicated from",
+			Detail:      opts.duplicateOf,
+		})
+	}
+
+	// Without the worktree phase the later phases work on an existing
+	// worktree, so it has to be there already.
+	createsWorktree := runsPhase(opts.only, "worktree")
+	if !createsWorktree {
+		if _, err := os.Stat(worktreePath); err != nil {
+			return fmt.Errorf("--only without worktree needs an existing worktree at %s", worktreePath)
+		}
+		if runsPhase(opts.only, "db") && !runsPhase(opts.only, "start") {
+			if desc, err := ddevDescribe(worktreePath); err != nil || desc.Status != "running" {
+				return fmt.Errorf("--only db needs DDEV running in %s; add start to --only", worktreePath)
+			}
+		}
+	}
+
+	// Fetch latest refs from origin. --fetch does it after the base is
+	// known instead, so that it can't be skipped over.
+	fetched := false
+	if createsWorktree && !opts.fetch {
+		fetchCmd := exec.Command(gitBin, "fetch", "origin")
+		fetchCmd.Dir = projectRoot
+		fetchCmd.Stdout, fetchCmd.Stderr = outputWriters()
+		if err := runPhase("Fetching latest changes", fetchCmd.Run); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to fetch from origin: %v\n", err)
+		} else {
+			fetched = true
+		}
+	}
+
+	// A hotfix branches from the production branch instead
+	if opts.hotfix && createsWorktree {
+		baseBranch, err = hotfixBase(projectRoot)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Default to default_base (origin/develop unless configured) if it
+	// exists and no base was specified. A configured base that is missing
+	// falls back to the remote's default branch.
+	defaultedBase := baseBranch == "" && createsWorktree && opts.pr == 0
+	if defaultedBase {
+		if _, err := resolveCommitish(projectRoot, preferredBase(config)); err == nil {
+			baseBranch = preferredBase(config)
+		} else if config.DefaultBase != "" {
+			baseBranch = remoteDefaultRef(projectRoot)
+			fallback := baseBranch
+			if fallback == "" {
+				fallback = "HEAD"
+			}
+			fmt.Fprintf(os.Stderr, "Warning: default_base %s does not exist; using %s\n", config.DefaultBase, fallback)
+		}
+	}
+
+	if opts.fetch && createsWorktree {
+		fetchStart := time.Now()
+		detail, err := fetchBase(projectRoot, baseBranch)
+		if err != nil {
+			return err
+		}
+		steps = append(steps, StepResult{Description: "Fetched", Detail: detail, Duration: stepDuration(opts.trace, fetchStart)})
+		fetched = true
+	}
+
+	// Resolve the base (branch, tag, SHA, or HEAD) to a commit. This runs
+	// from the current directory so HEAD means the worktree the user is in.
+	var baseSHA string
+	if baseBranch != "" && createsWorktree {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("getting current directory: %w", err)
+		}
+		baseSHA, err = resolveCommitish(cwd, baseBranch)
+		if err != nil {
+			return fmt.Errorf("base %q does not resolve to a commit", baseBranch)
+		}
+	}
+
+	// A base nobody chose may be an old fetch of the remote branch when the
+	// fetch above failed; compare it with the remote itself. After a
+	// successful fetch it is as current as ls-remote would say.
+	var staleness string
+	if defaultedBase && !fetched && baseSHA != "" {
+		staleness = baseStaleness(projectRoot, baseBranch, baseSHA)
+		if staleness != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s is %s; pass --fetch to branch from the latest\n", baseBranch, staleness)
+		}
+	}
+
+	// The pull request's head is fetched into the local branch, replacing an
+	// earlier fetch of it, unless a worktree holds the branch; that case is
+	// reported below.
+	if opts.pr > 0 && createsWorktree {
+		var held bool
+		if out, err := gitOutput(projectRoot, "worktree", "list", "--porcelain"); err == nil {
+			_, held = findWorktreeByBranch(parseWorktreeList(out), branchName)
+		}
+		if !held {
+			ref, err := fetchPullRequest(projectRoot, opts.pr, branchName)
+			if err != nil {
+				return err
+			}
+			steps = append(steps, StepResult{
+				Description: "Pull request",
+				Detail:      fmt.Sprintf("#%d (%s)", opts.pr, ref),
+			})
+		}
+	}
+
+	// A branch can only be checked out in one worktree at a time; catch that
+	// before git half-creates the new worktree directory.
+	existingBranch := !opts.detach && localBranchExists(projectRoot, branchName)
+	if opts.checkout && !existingBranch {
+		return fmt.Errorf("branch %s does not exist; omit --checkout to create it", branchName)
+	}
+	if createsWorktree {
+		if existingBranch {
+			if out, err := gitOutput(projectRoot, "worktree", "list", "--porcelain"); err == nil {
+				if holder, ok := findWorktreeByBranch(parseWorktreeList(out), branchName); ok {
+					return withKind(ErrWorktreeExists, fmt.Errorf("branch %q is already checked out in %s", branchName, holder.path),
+						fmt.Sprintf("Switch to that worktree instead: cd %s", holder.path))
+				}
+			}
+		}
+
+		if _, err := os.Stat(worktreePath); err == nil {
+			return withKind(ErrWorktreeExists, fmt.Errorf("workspace already exists: %s", worktreePath))
+		}
+
+		// Step 1: Create git worktree
+		worktreeStart := time.Now()
+		err = runPhase("Creating worktree", func() error {
+			if opts.detach {
+				return createDetachedWorktree(projectRoot, worktreeDir, baseSHA)
+			}
+			return createWorktree(projectRoot, worktreeDir, branchName, baseSHA)
+		})
+		if err != nil {
+			cleanup(state)
+			return fmt.Errorf("creating worktree: %w", err)
+		}
+		state.worktreeCreated = true
+		worktreeDetail := branchName
+		if opts.detach {
+			worktreeDetail = "spaces/" + worktreeDir + " (detached HEAD)"
+		} else if worktreeDir != branchName {
+			worktreeDetail = "spaces/" + worktreeDir + " (branch " + branchName + ")"
+		}
+		steps = append(steps, StepResult{
+			Description: "Created git worktree",
+			Detail:      worktreeDetail,
+			Duration:    stepDuration(opts.trace, worktreeStart),
+		})
+		if existingBranch {
+			steps = append(steps, StepResult{
+				Description: "Base",
+				Detail:      "Checked out existing branch " + branchName,
+			})
+		} else if baseSHA != "" {
+			steps = append(steps, StepResult{
+				Description: "Base",
+				Detail:      fmt.Sprintf("%s (%s)", baseBranch, shortSHA(baseSHA)) + staleDetail(staleness),
+			})
+		}
+
+		// Step 2: Push branch and set up tracking if it doesn't exist on the
+		// remote. A pull request's branch is someone else's and stays local.
+		remoteBranchCheck := exec.Command(gitBin, "rev-parse", "--verify", "refs/remotes/origin/"+branchName)
+		remoteBranchCheck.Dir = projectRoot
+		if opts.pr > 0 {
+			steps = append(steps, StepResult{
+				Description: "Remote branch",
+				Detail:      fmt.Sprintf("Not pushed (pull request #%d)", opts.pr),
+			})
+		} else if opts.detach {
+			steps = append(steps, StepResult{
+				Description: "Remote branch",
+				Detail:      "None (detached HEAD)",
+			})
+		} else if remoteBranchCheck.Run() != nil {
+			pushCmd := exec.Command(gitBin, "push", "-u", "origin", branchName)
+			pushCmd.Dir = worktreePath
+			pushCmd.Stdout, pushCmd.Stderr = outputWriters()
+			pushStart := time.Now()
+			if err := runPhase("Pushing branch to remote", pushCmd.Run); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to push branch to remote: %v\n", err)
+				steps = append(steps, StepResult{
+					Description: "Push branch to remote",
+					Detail:      "Failed (can be pushed manually later)",
+					Duration:    stepDuration(opts.trace, pushStart),
+				})
+			} else {
+				steps = append(steps, StepResult{
+					Description: "Pushed branch to remote",
+					Detail:      branchName + " → origin/" + branchName,
+					Duration:    stepDuration(opts.trace, pushStart),
+				})
+			}
+		} else {
+			steps = append(steps, StepResult{
+				Description: "Remote branch",
+				Detail:      "Already exists, skipped push",
+			})
+		}
+	} else {
+		steps = append(steps, skippedPhase("Create git worktree"))
+	}
+
+	// Repo-defined hooks (git itself already ran the configured post-checkout)
+	if opts.runHooks {
+		hooksDir := config.HooksDir
+		if hooksDir == "" {
+			hooksDir = defaultHooksDir
+		}
+		steps = append(steps, runRepoHooks(worktreePath, hooksDir)...)
+	}
+
+	// Local-only files come over before DDEV starts, which may read them
+	if copyFromPath != "" {
+		patterns := config.CopyFiles
+		if patterns == nil {
+			patterns = defaultCopyFiles
+		}
+		steps = append(steps, copyLocalFiles(copyFromPath, worktreePath, opts.copyFrom, patterns)...)
+	}
+
+	// Step 3: Detect DDEV from the new worktree
+	originalName, err := getDDEVProjectName(worktreePath)
+	hasDDEV := err == nil
+	projectType := getDDEVProjectType(worktreePath)
+
+	// Link Claude Code memory to share with project root (before potential early return)
+	memDetail, memErr := linkClaudeMemory(worktreePath, projectRoot)
+	if memErr != nil {
+		fmt.Fprintf(os.Stderr, "\nWarning: failed to link Claude memory: %v\n", memErr)
+		steps = append(steps, StepResult{
+			Description: "Claude memory",
+			Detail:      "Failed: " + memErr.Error(),
+		})
+	} else {
+		steps = append(steps, StepResult{
+			Description: "Claude memory",
+			Detail:      memDetail,
+		})
+	}
+
+	if !hasDDEV {
+		steps = append(steps, StepResult{
+			Description: "DDEV",
+			Detail:      "Skipped (no .ddev/config.yaml found)",
+		})
+		fmt.Fprintln(out)
+		renderSummary("Workspace Setup", withTotal(opts.trace, steps, start))
+		if !opts.quiet {
+			printNextSteps(out, worktreePath, "")
+		}
+		finishNew(opts, worktreePath, pathOut, out)
+		return nil
+	}
+
+	steps = append(steps, StepResult{
+		Description: "Read DDEV project name",
+		Detail:      originalName,
+	})
+
+	// Step 4: Rename DDEV project (skip for develop/main — keep default name,
+	// unless the user explicitly provided an identifier to override it)
+	isDefaultBranch := (worktreeName == "develop" || worktreeName == "main") && !identifierExplicit
+	ddevName := originalName
+	if !isDefaultBranch {
+		ddevName, err = buildDDEVName(ddevNameData{
+			Identifier:   identifier,
+			OriginalName: originalName,
+			WorktreeName: worktreeName,
+			Branch:       branchName,
+		}, opts.namingScheme, config)
+		if err != nil {
+			cleanup(state)
+			return err
+		}
+	}
+
+	// Refuse to reuse a DDEV name another worktree already has; DDEV would
+	// refuse to start the second project anyway.
+	renames := runsPhase(opts.only, "rename")
+	if others, err := spaceWorktrees(projectRoot); err == nil && renames {
+		var paths []string
+		for _, wt := range others {
+			if wt.path != worktreePath {
+				paths = append(paths, wt.path)
+			}
+		}
+		if owners := ddevNamesByWorktree(paths)[ddevName]; len(owners) > 0 {
+			cleanup(state)
+			return withHints(fmt.Errorf("DDEV project name %q is already used by %s", ddevName, strings.Join(owners, ", ")), fmt.Sprintf("Pass an explicit identifier, e.g. workspace new %s --identifier <id>", worktreeName))
+		}
+	}
+
+	if isDefaultBranch {
+		steps = append(steps, StepResult{
+			Description: "DDEV project name",
+			Detail:      originalName + " (kept default)",
+		})
+	} else {
+		if renames {
+			renameStart := time.Now()
+			if err := createDDEVLocalConfig(worktreePath, ddevName); err != nil {
+				cleanup(state)
+				return fmt.Errorf("creating DDEV local config: %w", err)
+			}
+			steps = append(steps, StepResult{
+				Description: "Created DDEV local config",
+				Detail:      ddevName,
+				Duration:    stepDuration(opts.trace, renameStart),
+			})
+		} else {
+			steps = append(steps, skippedPhase("DDEV rename"))
+		}
+		if runsPhase(opts.only, "settings") {
+			settingsStart := time.Now()
+			settingsSteps, err := rewriteDDEVSettings(worktreePath, ddevName, projectType)
+			if len(settingsSteps) > 0 {
+				settingsSteps[0].Duration = stepDuration(opts.trace, settingsStart)
+			}
+			steps = append(steps, settingsSteps...)
+			if err != nil {
+				cleanup(state)
+				return err
+			}
+		} else {
+			steps = append(steps, skippedPhase("Settings rewrite"))
+		}
+	}
+
+	if opts.assignPorts && renames {
+		ports := portsFor(ddevName)
+		if err := writeDDEVPortsConfig(worktreePath, ports); err != nil {
+			cleanup(state)
+			return fmt.Errorf("assigning ports: %w", err)
+		}
+		steps = append(steps, StepResult{
+			Description: "Assigned ports",
+			Detail:      fmt.Sprintf("HTTP %d, HTTPS %d, Mailpit %d", ports.HTTP, ports.HTTPS, ports.Mailpit),
+		})
+	}
+
+	if runsPhase(opts.only, "start") {
+		// Remove .ddev/traefik so DDEV regenerates it for the new project
+		traefikPath := filepath.Join(ddevRoot(worktreePath), ".ddev", "traefik")
+		if err := os.RemoveAll(traefikPath); err != nil {
+			cleanup(state)
+			return fmt.Errorf("removing .ddev/traefik: %w", err)
+		}
+
+		// Link project files (before DDEV start so files are available immediately)
+		filesDetail, err := linkProjectFiles(worktreePath, projectRoot, projectType)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nWarning: failed to link project files: %v\n", err)
+			steps = append(steps, StepResult{
+				Description: "Project files",
+				Detail:      "Failed: " + err.Error(),
+			})
+		} else {
+			steps = append(steps, StepResult{
+				Description: "Project files",
+				Detail:      filesDetail,
+			})
+		}
+
+		// Step 4: Start DDEV
+		state.ddevName = ddevName
+		ddevStart := time.Now()
+		err = runPhase("Starting DDEV", func() error {
+			return runDDEVLocked(ddevRoot(worktreePath), opts.env, "start")
+		})
+		if err != nil {
+			cleanup(state)
+			return withKind(ErrDDEVFailed, fmt.Errorf("starting DDEV: %w", err))
+		}
+		// Only a project this run created is deleted on a later failure;
+		// --only on an existing worktree leaves its DDEV project alone.
+		state.ddevStarted = createsWorktree
+		steps = append(steps, StepResult{
+			Description: "Started DDEV",
+			Detail:      ddevName,
+			Duration:    stepDuration(opts.trace, ddevStart),
+		})
+
+		// Step 5: Composer install for Drupal projects
+		if projectType == ProjectDrupal {
+			composerStart := time.Now()
+			if err := runPhase("Running composer install", func() error {
+				return runCommandLive(ddevRoot(worktreePath), ddevBin, "composer", "install")
+			}); err != nil {
+				fmt.Fprintf(os.Stderr, "\nWarning: failed to run composer install: %v\n", err)
+				steps = append(steps, StepResult{
+					Description: "Composer install",
+					Detail:      fmt.Sprintf("Failed: %v", err),
+					Duration:    stepDuration(opts.trace, composerStart),
+				})
+			} else {
+				steps = append(steps, StepResult{
+					Description: "Composer install",
+					Detail:      "Complete",
+					Duration:    stepDuration(opts.trace, composerStart),
+				})
+			}
+		}
+
+		// Wait for the database to accept connections before importing into it
+		if opts.waitHealthy {
+			var waited time.Duration
+			waitStart := time.Now()
+			err := runPhase("Waiting for the database", func() (err error) {
+				waited, err = pollUntil(func() bool { return databaseReady(worktreePath) }, opts.waitTimeout, 2*time.Second)
+				return err
+			})
+			if err != nil {
+				cleanup(state)
+				return err
+			}
+			steps = append(steps, StepResult{
+				Description: "Database healthy",
+				Detail:      fmt.Sprintf("after %s", waited.Round(time.Second)),
+				Duration:    stepDuration(opts.trace, waitStart),
+			})
+		}
+	} else {
+		steps = append(steps, skippedPhase("Start DDEV"))
+	}
+
+	if runsPhase(opts.only, "db") {
+		// Step 6: Handle DB import, copying from a sibling workspace if asked
+		var dbDetail string
+		dbStart := time.Now()
+		if reuseDBPath != "" {
+			dbDetail, err = copyDatabase(reuseDBPath, worktreePath)
+		} else {
+			dbImport := opts.dbImport
+			dbImport.env = opts.env
+			dbDetail, err = handleDBImport(worktreePath, projectRoot, dbImport)
+		}
+		if err != nil {
+			cleanup(state)
+			return fmt.Errorf("importing database: %w", err)
+		}
+		steps = append(steps, StepResult{
+			Description: "Database",
+			Detail:      dbDetail,
+			Duration:    stepDuration(opts.trace, dbStart),
+		})
+
+		// Step 7: Post-import command (only when something was imported)
+		if postImportCmd != "" && strings.HasPrefix(dbDetail, "Imported") {
+			postImportStart := time.Now()
+			step := runPostImportCommand(worktreePath, postImportCmd, opts.env)
+			step.Duration = stepDuration(opts.trace, postImportStart)
+			steps = append(steps, step)
+		}
+	} else {
+		steps = append(steps, skippedPhase("Database"))
+	}
+
+	// Done
+	fmt.Fprintln(out)
+	renderSummary("Workspace Setup", withTotal(opts.trace, steps, start))
+	if !opts.quiet {
+		printNextSteps(out, worktreePath, ddevName)
+	}
+	finishNew(opts, worktreePath, pathOut, out)
+	return nil
+}
+
+// finishNew hands a newly created workspace over to the user: its path on
+// pathOut (--print-path) and the worktree opened in their editor (--open),
+// whose output goes to out. The workspace exists by now, so a failing editor
+// is only a warning.
+func finishNew(opts newArgs, worktreePath string, pathOut, out io.Writer) {
+	if opts.printPath {
+		fmt.Fprintln(pathOut, worktreePath)
+	}
+	if opts.openEditor {
+		if err := openInEditor(worktreePath, out); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not open %s in an editor: %v\n", worktreePath, err)
+		}
+	}
+}
+
+// openInEditor opens path with $VISUAL or $EDITOR, which may include
+// arguments (e.g. "code -n"). Its output goes to out, which is stderr with
+// --print-path as stdout is being captured.
+func openInEditor(path string, out io.Writer) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		return fmt.Errorf("neither $VISUAL nor $EDITOR is set")
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		fields := strings.Fields(editor)
+		cmd = exec.Command(fields[0], append(fields[1:], path)...)
+	} else {
+		cmd = exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, out, os.Stderr
+	return cmd.Run()
+}
+
+// printNextSteps prints what to do after creating a workspace: how to get
+// into it and, for DDEV projects, the project name and site URL.
+func printNextSteps(w io.Writer, worktreePath, ddevName string) {
+	fmt.Fprintln(w, "Next steps:")
+	fmt.Fprintf(w, "  %-25s cd %s\n", "Go to the workspace:", worktreePath)
+	if ddevName != "" {
+		fmt.Fprintf(w, "  %-25s %s\n", "DDEV project:", ddevName)
+		if desc, err := ddevDescribe(worktreePath); err == nil && desc.Status == "running" && desc.PrimaryURL != "" {
+			fmt.Fprintf(w, "  %-25s %s\n", "Site URL:", desc.PrimaryURL)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+func cmdRefresh(args []string) error {
+  projectRoot, err := findProjectRoot()
+  if err != nil {
+    return err
+  }
+
+  config, err := loadConfig(projectRoot)
+  if err != nil {
+    return err
+  }
+  postImportCmd := config.PostImportCommand
+
+  var positional []string
+  var dbImport dbImportOptions
+  for i := 0; i < len(args); i++ {
+    if value, n, err := parseValueFlag(args, i, "--post-import-cmd"); err != nil {
+      return err
+    } else if n > 0 {
+      postImportCmd = value
+      i += n - 1
+    } else if value, n, err := parseValueFlag(args, i, "--db-file"); err != nil {
+      return err
+    } else if n > 0 {
+      dbImport.file = value
+      i += n - 1
+    } else if args[i] == "--db-prompt" {
+      dbImport.prompt = true
+    } else if args[i] == "--no-prompt-db" {
+      dbImport.noPrompt = true
+    } else if value, n, err := parseValueFlag(args, i, "--db-exclude-tables"); err != nil {
+      return err
+    } else if n > 0 {
+      tables, err := parseExcludeTables(value)
+      if err != nil {
+        return err
+      }
+      dbImport.excludeTables = tables
+      i += n - 1
+    } else {
+      positional = append(positional, args[i])
+    }
+  }
+  if dbImport.prompt && dbImport.noPrompt {
+    return fmt.Errorf("--db-prompt and --no-prompt-db cannot be combined")
+  }
+
+  var name string
+  if len(positional) > 0 {
+    name = positional[0]
+  }
+  targetPath, _, err := resolveWorktree(projectRoot, name)
+  if err != nil {
+    return err
+  }
+
+  var steps []StepResult
+
+  dbDetail, err := handleDBImport(targetPath, projectRoot, dbImport)
+  if err != nil {
+    return fmt.Errorf("importing database: %w", err)
+  }
+  steps = append(steps, StepResult{
+    Description: "Database",
+    Detail:      dbDetail,
+  })
+
+  if postImportCmd != "" && strings.HasPrefix(dbDetail, "Imported") {
+    steps = append(steps, runPostImportCommand(targetPath, postImportCmd, nil))
+  }
+
+  fmt.Println()
+  renderSummary("Workspace Setup", steps)
+  return nil
+}
+
+// splitPassthroughArgs splits args at the first "--", returning the
+// arguments before it and everything after it (to be passed through verbatim).
+func splitPassthroughArgs(args []string) (own, passthrough []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
+
+func cmdShare(args []string) error {
+	own, passthrough := splitPassthroughArgs(args)
+	if len(own) > 1 {
+		return usageError(fmt.Errorf("expected at most 1 argument, got %d", len(own)), "Usage: workspace share [name] [-- ddev share flags]")
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	var name string
+	if len(own) > 0 {
+		name = own[0]
+	}
+	targetPath, _, err := resolveWorktree(projectRoot, name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := getDDEVProjectName(targetPath); err != nil {
+		return fmt.Errorf("no DDEV project found in %s", targetPath)
+	}
+
+	// Make sure the project is running before opening a tunnel to it
+	if desc, err := ddevDescribe(targetPath); err != nil || desc.Status != "running" {
+		fmt.Println("--- Starting DDEV ---")
+		if err := runDDEVLocked(ddevRoot(targetPath), nil, "start"); err != nil {
+			return withKind(ErrDDEVFailed, fmt.Errorf("starting DDEV: %w", err))
+		}
+	}
+
+	fmt.Println("\n--- Sharing DDEV project ---")
+	shareArgs := append([]string{"share"}, passthrough...)
+	if err := runCommandLive(ddevRoot(targetPath), ddevBin, shareArgs...); err != nil {
+		return withKind(ErrDDEVFailed, fmt.Errorf("running ddev share: %w", err))
+	}
+	return nil
+}
+
+// ddevDescription holds the fields of `ddev describe -j` that the tool uses.
+type ddevDescription struct {
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	PrimaryURL string     `json:"primary_url"`
+	DBInfo     ddevDBInfo `json:"dbinfo"`
+}
+
+// ddevDBInfo is the database section of `ddev describe -j`. PublishedPort is
+// the host port the database is reachable on while the project runs.
+type ddevDBInfo struct {
+	Type          string `json:"database_type"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	DBName        string `json:"dbname"`
+	PublishedPort int    `json:"published_port"`
+}
+
+// dbConnectionURL builds a URL for connecting to the database from the
+// host, e.g. mysql://db:db@127.0.0.1:32768/db.
+func dbConnectionURL(info ddevDBInfo) (string, error) {
+	if info.PublishedPort == 0 {
+		return "", fmt.Errorf("the database has no published port")
+	}
+	scheme := "mysql"
+	if info.Type == "postgres" {
+		scheme = "postgresql"
+	}
+	u := url.URL{
+		Scheme: scheme,
+		User:   url.UserPassword(info.Username, info.Password),
+		Host:   fmt.Sprintf("127.0.0.1:%d", info.PublishedPort),
+		Path:   "/" + info.DBName,
+	}
+	return u.String(), nil
+}
+
+// openURL hands url to the desktop's default handler (TablePlus and most
+// other DB GUIs register for mysql:// and postgresql://).
+func openURL(target string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", target)
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "start", "", target)
+	default:
+		cmd = exec.Command("xdg-open", target)
+	}
+	return cmd.Run()
+}
+
+func cmdSSH(args []string) error {
+	var names []string
+	service := ""
+	for i := 0; i < len(args); i++ {
+		if value, n, err := parseValueFlag(args, i, "--service"); err != nil {
+			return usageError(err, "Usage: workspace ssh [name] [--service <name>]")
+		} else if n > 0 {
+			service = value
+			i += n - 1
+		} else {
+			names = append(names, args[i])
+		}
+	}
+	if len(names) > 1 {
+		return usageError(fmt.Errorf("expected at most 1 argument, got %d", len(names)), "Usage: workspace ssh [name] [--service <name>]")
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	var name string
+	if len(names) > 0 {
+		name = names[0]
+	}
+	targetPath, _, err := resolveWorktree(projectRoot, name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := getDDEVProjectName(targetPath); err != nil {
+		return fmt.Errorf("no DDEV project found in %s", targetPath)
+	}
+
+	sshArgs := []string{"ssh"}
+	if service != "" {
+		sshArgs = append(sshArgs, "--service", service)
+	}
+	cmd := exec.Command(ddevBin, sshArgs...)
+	cmd.Dir = ddevRoot(targetPath)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		// The shell's own exit status (e.g. from the last command run in it)
+		// is not a failure of this tool.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitStatusError{code: exitErr.ExitCode()}
+		}
+		return withKind(ErrDDEVFailed, fmt.Errorf("running ddev ssh: %w", err))
+	}
+	return nil
+}
+
+type branchArgs struct {
+	worktree string
+	branch   string
+	base     string
+}
+
+// parseBranchArgs parses the arguments for the "branch" subcommand.
+func parseBranchArgs(args []string) (branchArgs, error) {
+	var parsed branchArgs
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		if value, n, err := parseValueFlag(args, i, "--base"); err != nil {
+			return branchArgs{}, err
+		} else if n > 0 {
+			parsed.base = value
+			i += n - 1
+		} else {
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 2 {
+		return branchArgs{}, fmt.Errorf("expected 2 arguments, got %d", len(positional))
+	}
+	parsed.worktree, parsed.branch = positional[0], positional[1]
+	return parsed, nil
+}
+
+// cmdBranch checks out another branch in an existing worktree, creating it
+// from the base (or tracking origin) when it doesn't exist locally. The
+// directory and DDEV project stay as they are.
+func cmdBranch(args []string) error {
+	parsed, err := parseBranchArgs(args)
+	if err != nil {
+		return usageError(err, "Usage: workspace branch [--base <branch>] <worktree-name> <new-branch>")
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+	targetPath, oldBranch, err := resolveWorktree(projectRoot, parsed.worktree)
+	if err != nil {
+		return err
+	}
+	if parsed.branch == oldBranch {
+		fmt.Printf("%s is already on %s\n", filepath.Base(targetPath), oldBranch)
+		return nil
+	}
+
+	status, err := gitOutput(targetPath, "status", "--porcelain")
+	if err != nil {
+		return fmt.Errorf("checking for local changes: %w", err)
+	}
+	if status != "" {
+		return withHints(fmt.Errorf("%s has uncommitted changes", targetPath), "Commit or stash them first.")
+	}
+
+	var steps []StepResult
+	var switchArgs []string
+	if localBranchExists(projectRoot, parsed.branch) {
+		if parsed.base != "" {
+			return fmt.Errorf("branch %s already exists; omit --base to check it out", parsed.branch)
+		}
+		if out, err := gitOutput(projectRoot, "worktree", "list", "--porcelain"); err == nil {
+			if holder, ok := findWorktreeByBranch(parseWorktreeList(out), parsed.branch); ok {
+				return withKind(ErrWorktreeExists, fmt.Errorf("branch %q is already checked out in %s", parsed.branch, holder.path))
+			}
+		}
+		switchArgs = []string{"switch", parsed.branch}
+	} else if _, err := resolveCommitish(projectRoot, "refs/remotes/origin/"+parsed.branch); err == nil && parsed.base == "" {
+		switchArgs = []string{"switch", "--track", "-c", parsed.branch, "origin/" + parsed.branch}
+		steps = append(steps, StepResult{Description: "Base", Detail: "Tracking origin/" + parsed.branch})
+	} else {
+		base := parsed.base
+		if base == "" {
+			base = defaultBaseRef(projectRoot)
+		}
+		if base == "" {
+			return usageError(fmt.Errorf("could not determine a base for the new branch"), "Pass --base <branch>.")
+		}
+		baseSHA, err := resolveCommitish(targetPath, base)
+		if err != nil {
+			return fmt.Errorf("base %q does not resolve to a commit", base)
+		}
+		switchArgs = []string{"switch", "--no-track", "-c", parsed.branch, baseSHA}
+		steps = append(steps, StepResult{Description: "Base", Detail: fmt.Sprintf("%s (%s)", base, shortSHA(baseSHA))})
+	}
+
+	fmt.Printf("--- Switching %s to %s ---\n", filepath.Base(targetPath), parsed.branch)
+	if err := runCommandLive(targetPath, gitBin, switchArgs...); err != nil {
+		return fmt.Errorf("switching branch: %w", err)
+	}
+	steps = append([]StepResult{{Description: "Branch", Detail: oldBranch + " → " + parsed.branch}}, steps...)
+	if _, err := getDDEVProjectName(targetPath); err == nil {
+		steps = append(steps, StepResult{Description: "DDEV", Detail: "Unchanged (same directory and project name)"})
+	}
+
+	renderSummary("Branch Switch", steps)
+	return nil
+}
+
+type rebaseArgs struct {
+	name string
+	onto string
+}
+
+// parseRebaseArgs parses the arguments for the "rebase" subcommand.
+func parseRebaseArgs(args []string) (rebaseArgs, error) {
+	var parsed rebaseArgs
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		if value, n, err := parseValueFlag(args, i, "--onto"); err != nil {
+			return rebaseArgs{}, err
+		} else if n > 0 {
+			parsed.onto = value
+			i += n - 1
+		} else {
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) > 1 {
+		return rebaseArgs{}, fmt.Errorf("expected at most 1 argument, got %d", len(positional))
+	}
+	if len(positional) == 1 {
+		parsed.name = positional[0]
+	}
+	return parsed, nil
+}
+
+// rebaseTarget resolves a --onto value to the ref to rebase onto, preferring
+// the freshly fetched origin/<base> over a local branch of the same name.
+func rebaseTarget(projectRoot, onto string) string {
+	if onto == "" {
+		return defaultBaseRef(projectRoot)
+	}
+	if !strings.HasPrefix(onto, "origin/") {
+		if _, err := resolveCommitish(projectRoot, "refs/remotes/origin/"+onto); err == nil {
+			return "origin/" + onto
+		}
+	}
+	return onto
+}
+
+func cmdRebase(args []string) error {
+	parsed, err := parseRebaseArgs(args)
+	if err != nil {
+		return usageError(err, "Usage: workspace rebase [name] [--onto <base>]")
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+	targetPath, branch, err := resolveWorktree(projectRoot, parsed.name)
+	if err != nil {
+		return err
+	}
+
+	status, err := gitOutput(targetPath, "status", "--porcelain")
+	if err != nil {
+		return fmt.Errorf("checking for local changes: %w", err)
+	}
+	if status != "" {
+		return withHints(fmt.Errorf("%s has uncommitted changes", targetPath), "Commit or stash them first.")
+	}
+
+	fmt.Println("--- Fetching latest changes ---")
+	if err := runCommandLive(projectRoot, gitBin, "fetch", "origin"); err != nil {
+		return fmt.Errorf("fetching from origin: %w", err)
+	}
+
+	base := rebaseTarget(projectRoot, parsed.onto)
+	if base == "" {
+		return usageError(fmt.Errorf("could not determine the base branch"), "Pass --onto <base>.")
+	}
+	baseSHA, err := resolveCommitish(targetPath, base)
+	if err != nil {
+		return fmt.Errorf("base %q does not resolve to a commit", base)
+	}
+
+	fmt.Printf("\n--- Rebasing %s onto %s ---\n", branch, base)
+	if err := runCommandLive(targetPath, gitBin, "rebase", base); err != nil {
+		if _, statErr := gitOutput(targetPath, "rev-parse", "--verify", "--quiet", "REBASE_HEAD"); statErr == nil {
+			return withHints(fmt.Errorf("rebase of %s onto %s stopped on conflicts", branch, base),
+				"cd "+targetPath,
+				"Fix the conflicted files, git add them, then run: git rebase --continue",
+				"Or give up and restore the branch with: git rebase --abort")
+		}
+		return fmt.Errorf("rebasing onto %s: %w", base, err)
+	}
+
+	renderSummary("Rebase", []StepResult{
+		{Description: "Branch", Detail: branch},
+		{Description: "Rebased onto", Detail: fmt.Sprintf("%s (%s)", base, shortSHA(baseSHA))},
+	})
+	return nil
+}
+
+// cmdStash moves the uncommitted changes (including untracked files) of one
+// worktree into another. Stashes are shared by all worktrees of the
+// repository, so the entry is pushed in the source, applied by commit in
+// the destination, and only dropped once it applied cleanly; a conflicting
+// apply is an error, with the stash kept.
+func cmdStash(args []string) error {
+	usage := "Usage: workspace stash <source> <destination>"
+	if len(args) != 2 {
+		return usageError(fmt.Errorf("expected 2 arguments, got %d", len(args)), usage)
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+	srcPath, _, err := resolveWorktree(projectRoot, args[0])
+	if err != nil {
+		return err
+	}
+	dstPath, _, err := resolveWorktree(projectRoot, args[1])
+	if err != nil {
+		return err
+	}
+	if samePath(srcPath, dstPath) {
+		return usageError(fmt.Errorf("source and destination are the same worktree"), usage)
+	}
+	srcName, dstName := filepath.Base(srcPath), filepath.Base(dstPath)
+
+	status, err := gitOutput(srcPath, "status", "--porcelain")
+	if err != nil {
+		return fmt.Errorf("checking for local changes: %w", err)
+	}
+	if status == "" {
+		return fmt.Errorf("%s has no uncommitted changes to move", srcName)
+	}
+
+	fmt.Printf("--- Stashing changes in %s ---\n", srcName)
+	message := fmt.Sprintf("workspace stash: %s -> %s", srcName, dstName)
+	if err := runCommandLive(srcPath, gitBin, "stash", "push", "--include-untracked", "-m", message); err != nil {
+		return fmt.Errorf("stashing changes: %w", err)
+	}
+	stash, err := gitOutput(srcPath, "rev-parse", "--verify", "refs/stash")
+	if err != nil {
+		return fmt.Errorf("finding the new stash: %w", err)
+	}
+	steps := []StepResult{{Description: "Stashed", Detail: srcName + " (" + shortSHA(stash) + ")"}}
+
+	fmt.Printf("--- Applying changes in %s ---\n", dstName)
+	if err := runCommandLive(dstPath, gitBin, "stash", "apply", stash); err != nil {
+		steps = append(steps, StepResult{Description: "Applied", Detail: dstName + " (with conflicts; stash kept)"})
+		renderSummary("Stash Move", steps)
+		return withHints(fmt.Errorf("applying the stash in %s did not go cleanly: %w", dstName, err),
+			fmt.Sprintf("Resolve the conflicts there; the stash is kept (git stash list shows %q).", message),
+			fmt.Sprintf("To put the changes back in %s instead: git -C %s stash apply %s", srcName, srcPath, shortSHA(stash)))
+	}
+	steps = append(steps, StepResult{Description: "Applied", Detail: dstName})
+
+	// Other stash commands may have run in the meantime, so drop by commit
+	// rather than assuming stash@{0}.
+	if out, err := gitOutput(srcPath, "stash", "list", "--format=%H"); err == nil {
+		for i, sha := range strings.Split(out, "\n") {
+			if sha == stash {
+				if _, err := gitOutput(srcPath, "stash", "drop", fmt.Sprintf("stash@{%d}", i)); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: could not drop the applied stash: %v\n", err)
+				}
+				break
+			}
+		}
+	}
+
+	renderSummary("Stash Move", steps)
+	return nil
+}
+
+func cmdOpenDB(args []string) error {
+	var names []string
+	open := false
+	for _, arg := range args {
+		if arg == "--open" {
+			open = true
+		} else {
+			names = append(names, arg)
+		}
+	}
+	if len(names) > 1 {
+		return usageError(fmt.Errorf("expected at most 1 argument, got %d", len(names)), "Usage: workspace open-db [name] [--open]")
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	var name string
+	if len(names) > 0 {
+		name = names[0]
+	}
+	targetPath, _, err := resolveWorktree(projectRoot, name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := getDDEVProjectName(targetPath); err != nil {
+		return fmt.Errorf("no DDEV project found in %s", targetPath)
+	}
+
+	// The database only has a host port while the project is running. DDEV's
+	// output goes to stderr so stdout is just the URL.
+	desc, err := ddevDescribe(targetPath)
+	if err != nil || desc.Status != "running" {
+		fmt.Fprintln(os.Stderr, "--- Starting DDEV ---")
+		startCmd := exec.Command(ddevBin, "start")
+		startCmd.Dir = ddevRoot(targetPath)
+		startCmd.Stdout, startCmd.Stderr = os.Stderr, os.Stderr
+		if err := withDDEVLock(startCmd.Run); err != nil {
+			return withKind(ErrDDEVFailed, fmt.Errorf("starting DDEV: %w", err))
+		}
+		if desc, err = ddevDescribe(targetPath); err != nil {
+			return withKind(ErrDDEVFailed, err)
+		}
+	}
+
+	connURL, err := dbConnectionURL(desc.DBInfo)
+	if err != nil {
+		return err
+	}
+	if !open {
+		fmt.Println(connURL)
+		return nil
+	}
+	if err := openURL(connURL); err != nil {
+		return withHints(fmt.Errorf("opening %s: %w", connURL, err), "Is a database GUI registered for this URL scheme?")
+	}
+	fmt.Printf("Opened %s\n", connURL)
+	return nil
+}
+
+// ddevDescribe runs `ddev describe -j` in dir and returns the parsed project
+// description.
+func ddevDescribe(dir string) (*ddevDescription, error) {
+	cmd := exec.Command(ddevBin, "describe", "-j")
+	cmd.Dir = ddevRoot(dir)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ddev describe failed: %w", err)
+	}
+
+	var wrapper struct {
+		Raw ddevDescription `json:"raw"`
+	}
+	if err := json.Unmarshal(out, &wrapper); err != nil {
+		return nil, fmt.Errorf("could not parse ddev describe output: %w", err)
+	}
+	return &wrapper.Raw, nil
+}
+
+// doctorCheck is one doctor check. fix, when set, repairs what run found and
+// describes what it did; destructive fixes ask for confirmation first.
+type doctorCheck struct {
+	name        string
+	run         func(projectRoot string) []string
+	fix         func(projectRoot string) (string, error)
+	destructive bool
+}
+
+func cmdDoctor(args []string) error {
+	usage := "Usage: workspace doctor [--fix] [--yes]"
+	fix, yes := false, false
+	for _, arg := range args {
+		switch arg {
+		case "--fix":
+			fix = true
+		case "--yes":
+			yes = true
+		default:
+			return usageError(fmt.Errorf("unexpected argument: %s", arg), usage)
+		}
+	}
+
+	projectRoot, err := doctorProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	checks := []doctorCheck{
+		{name: "Git pointer file", run: checkGitPointer, fix: fixGitPointer},
+		{name: "Project directories", run: checkProjectDirs, fix: fixProjectDirs},
+		{name: "Worktree entries", run: checkStaleWorktrees, fix: fixStaleWorktrees, destructive: true},
+		{name: "Fetch refspec", run: checkFetchRefspec, fix: fixFetchRefspec},
+		{name: "Unique DDEV project names", run: checkDuplicateDDEVNames},
+	}
+
+	problems := 0
+	for _, check := range checks {
+		issues := check.run(projectRoot)
+		if len(issues) == 0 {
+			fmt.Printf("  [ok]  %s\n", check.name)
+			continue
+		}
+		fmt.Printf("  [!!]  %s\n", check.name)
+		for _, issue := range issues {
+			fmt.Printf("          %s\n", issue)
+		}
+		if fix && check.fix != nil {
+			fixed, detail := runDoctorFix(projectRoot, check, yes)
+			if fixed {
+				fmt.Printf("          Fixed: %s\n", detail)
+				continue
+			}
+			fmt.Printf("          Not fixed: %s\n", detail)
+		}
+		problems += len(issues)
+	}
+
+	fmt.Println()
+	if problems > 0 {
+		if !fix {
+			return withHints(fmt.Errorf("%d problem(s) found", problems), "Run workspace doctor --fix to repair what can be repaired automatically.")
+		}
+		return fmt.Errorf("%d problem(s) remain", problems)
+	}
+	if fix {
+		fmt.Println("No problems remain.")
+		return nil
+	}
+	fmt.Println("No problems found.")
+	return nil
+}
+
+// runDoctorFix applies check's fix, asking first when it is destructive, and
+// reports whether the problem is gone along with what was done or why not.
+func runDoctorFix(projectRoot string, check doctorCheck, yes bool) (bool, string) {
+	if check.destructive {
+		ok, err := confirmUnlessYes(fmt.Sprintf("Fix %q? (y/N) ", check.name), yes)
+		if err != nil {
+			return false, err.Error()
+		}
+		if !ok {
+			return false, "skipped"
+		}
+	}
+	detail, err := check.fix(projectRoot)
+	if err != nil {
+		return false, err.Error()
+	}
+	if remaining := check.run(projectRoot); len(remaining) > 0 {
+		return false, fmt.Sprintf("%s, but the check still fails", detail)
+	}
+	return true, detail
+}
+
+// doctorProjectRoot finds the project root like findProjectRoot, but still
+// succeeds when the layout doctor repairs is broken: without the .git
+// pointer or spaces/, the root is the nearest directory at or above cwd
+// holding the bare repository.
+func doctorProjectRoot() (string, error) {
+	projectRoot, err := findProjectRoot()
+	if err == nil {
+		return projectRoot, nil
+	}
+	cwd, cwdErr := os.Getwd()
+	if cwdErr != nil {
+		return "", err
+	}
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		if findBareRepo(dir) != "" {
+			return dir, nil
+		}
+		if dir == filepath.Dir(dir) {
+			return "", err
+		}
+	}
+}
+
+// findBareRepo returns the name of the bare repository directory in
+// projectRoot (.bare unless init was given --bare-dir), or "" when there is
+// none.
+func findBareRepo(projectRoot string) string {
+	entries, err := os.ReadDir(projectRoot)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		switch entry.Name() {
+		case "spaces", "db", "files":
+			continue
+		}
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(projectRoot, entry.Name(), "HEAD")); err != nil {
+			continue
+		}
+		out, err := gitOutput(filepath.Join(projectRoot, entry.Name()), "rev-parse", "--is-bare-repository")
+		if err == nil && out == "true" {
+			return entry.Name()
+		}
+	}
+	return ""
+}
+
+// bareGitOutput runs git inside the project's bare repository, which works
+// even when the .git pointer at the root is missing.
+func bareGitOutput(projectRoot string, args ...string) (string, error) {
+	bare := findBareRepo(projectRoot)
+	if bare == "" {
+		return "", fmt.Errorf("no bare repository found in %s", projectRoot)
+	}
+	return gitOutput(filepath.Join(projectRoot, bare), args...)
+}
+
+// checkGitPointer reports a missing .git file at the project root, or one
+// that doesn't point at the bare repository.
+func checkGitPointer(projectRoot string) []string {
+	bare := findBareRepo(projectRoot)
+	if bare == "" {
+		return []string{fmt.Sprintf("no bare repository found in %s", projectRoot)}
+	}
+	if bare == ".git" {
+		return nil
+	}
+	content, err := os.ReadFile(filepath.Join(projectRoot, ".git"))
+	if os.IsNotExist(err) {
+		return []string{fmt.Sprintf(".git is missing (should contain \"gitdir: %s\")", bare)}
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("reading .git: %v", err)}
+	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir:")
+	target = strings.TrimSpace(target)
+	if !ok || target == "" {
+		return []string{fmt.Sprintf(".git is not a gitdir pointer (should contain \"gitdir: %s\")", bare)}
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(projectRoot, target)
+	}
+	if !samePath(target, filepath.Join(projectRoot, bare)) {
+		return []string{fmt.Sprintf(".git points at %s instead of %s", target, bare)}
+	}
+	return nil
+}
+
+func fixGitPointer(projectRoot string) (string, error) {
+	bare := findBareRepo(projectRoot)
+	if bare == "" {
+		return "", fmt.Errorf("no bare repository to point at")
+	}
+	if err := writeFileAtomic(filepath.Join(projectRoot, ".git"), []byte("gitdir: "+bare+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("writing .git: %w", err)
+	}
+	return "wrote .git (gitdir: " + bare + ")", nil
+}
+
+// layoutDir is a directory init creates at the project root.
+type layoutDir struct {
+	label string
+	path  string
+	perm  os.FileMode
+}
+
+// projectDirs returns the directories init creates. files/ is shared with
+// the web containers, so it is world-writable as in init.
+func projectDirs(projectRoot string) ([]layoutDir, error) {
+	dumpDir, err := dbDir(projectRoot)
+	if err != nil {
+		return nil, err
+	}
+	return []layoutDir{
+		{"spaces/", filepath.Join(projectRoot, "spaces"), 0755},
+		{"db directory " + dumpDir, dumpDir, 0755},
+		{"files/", filepath.Join(projectRoot, "files"), 0777},
+	}, nil
+}
+
+// checkProjectDirs reports missing spaces/, db/, and files/ directories.
+func checkProjectDirs(projectRoot string) []string {
+	dirs, err := projectDirs(projectRoot)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var issues []string
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir.path); err != nil || !info.IsDir() {
+			issues = append(issues, dir.label+" is missing")
+		}
+	}
+	return issues
+}
+
+func fixProjectDirs(projectRoot string) (string, error) {
+	dirs, err := projectDirs(projectRoot)
+	if err != nil {
+		return "", err
+	}
+	var created []string
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir.path); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(dir.path, dir.perm); err != nil {
+			return "", fmt.Errorf("creating %s: %w", dir.label, err)
+		}
+		created = append(created, dir.label)
+	}
+	return "created " + strings.Join(created, ", "), nil
+}
+
+// checkStaleWorktrees reports worktree entries git would prune because their
+// directories are gone.
+func checkStaleWorktrees(projectRoot string) []string {
+	bare := findBareRepo(projectRoot)
+	if bare == "" {
+		return []string{fmt.Sprintf("no bare repository found in %s", projectRoot)}
+	}
+	// The would-be removals are reported on stderr
+	cmd := exec.Command(gitBin, "worktree", "prune", "--dry-run", "--verbose")
+	cmd.Dir = filepath.Join(projectRoot, bare)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return []string{fmt.Sprintf("git worktree prune --dry-run failed: %v", err)}
+	}
+	var issues []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			issues = append(issues, "stale entry "+strings.TrimPrefix(line, "Removing "))
+		}
+	}
+	return issues
+}
+
+func fixStaleWorktrees(projectRoot string) (string, error) {
+	if _, err := bareGitOutput(projectRoot, "worktree", "prune"); err != nil {
+		return "", fmt.Errorf("git worktree prune: %w", err)
+	}
+	return "ran git worktree prune", nil
+}
+
+// defaultFetchRefspec is the refspec init configures for a full clone.
+const defaultFetchRefspec = "+refs/heads/*:refs/remotes/origin/*"
+
+// checkFetchRefspec reports an origin without fetch refspecs, or refspecs
+// that don't fetch into refs/remotes/origin/ (a bare clone's default
+// writes straight into the local branches).
+func checkFetchRefspec(projectRoot string) []string {
+	good, bad := fetchRefspecs(projectRoot)
+	var issues []string
+	for _, refspec := range bad {
+		issues = append(issues, fmt.Sprintf("remote.origin.fetch %s doesn't fetch into refs/remotes/origin/", refspec))
+	}
+	if len(good) == 0 && len(bad) == 0 {
+		issues = append(issues, "remote.origin.fetch is not set")
+	}
+	return issues
+}
+
+// fixFetchRefspec keeps the refspecs that are fine (e.g. those narrowed by
+// init --branches) and replaces the rest; with none left, origin fetches
+// every branch.
+func fixFetchRefspec(projectRoot string) (string, error) {
+	good, _ := fetchRefspecs(projectRoot)
+	if len(good) == 0 {
+		good = []string{defaultFetchRefspec}
+	}
+	for i, refspec := range good {
+		args := []string{"config", "--add", "remote.origin.fetch", refspec}
+		if i == 0 {
+			args = []string{"config", "--replace-all", "remote.origin.fetch", refspec}
+		}
+		if _, err := bareGitOutput(projectRoot, args...); err != nil {
+			return "", fmt.Errorf("setting remote.origin.fetch: %w", err)
+		}
+	}
+	return "set remote.origin.fetch to " + strings.Join(good, ", "), nil
+}
+
+// fetchRefspecs splits origin's fetch refspecs into those that map branches
+// to refs/remotes/origin/ and those that don't.
+func fetchRefspecs(projectRoot string) (good, bad []string) {
+	out, _ := bareGitOutput(projectRoot, "config", "--get-all", "remote.origin.fetch")
+	for _, refspec := range strings.Split(out, "\n") {
+		if refspec = strings.TrimSpace(refspec); refspec == "" {
+			continue
+		}
+		_, dst, _ := strings.Cut(refspec, ":")
+		if strings.HasPrefix(dst, "refs/remotes/origin/") {
+			good = append(good, refspec)
+		} else {
+			bad = append(bad, refspec)
+		}
+	}
+	return good, bad
+}
+
+// checkDuplicateDDEVNames reports DDEV project names shared by more than one
+// worktree.
+func checkDuplicateDDEVNames(projectRoot string) []string {
+	worktrees, err := spaceWorktrees(projectRoot)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var paths []string
+	for _, wt := range worktrees {
+		paths = append(paths, wt.path)
+	}
+
+	var issues []string
+	for name, owners := range ddevNamesByWorktree(paths) {
+		if len(owners) > 1 {
+			issues = append(issues, fmt.Sprintf("DDEV name %q is used by %s", name, strings.Join(owners, ", ")))
+		}
+	}
+	sort.Strings(issues)
+	return issues
+}
+
+type exportArgs struct {
+	name        string
+	outPath     string
+	base        string
+	compression string
+}
+
+// parseExportArgs parses the arguments for the "export" subcommand.
+func parseExportArgs(args []string) (exportArgs, error) {
+	var parsed exportArgs
+	var positional []string
+
+	for i := 0; i < len(args); i++ {
+		if value, n, err := parseValueFlag(args, i, "--out"); err != nil {
+			return exportArgs{}, err
+		} else if n > 0 {
+			parsed.outPath = value
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--base"); err != nil {
+			return exportArgs{}, err
+		} else if n > 0 {
+			parsed.base = value
+			i += n - 1
+		} else if value, n, err := parseValueFlag(args, i, "--compression"); err != nil {
+			return exportArgs{}, err
+		} else if n > 0 {
+			parsed.compression = value
+			i += n - 1
+		} else if args[i] == "--no-compress" {
+			parsed.compression = compressionNone
+		} else {
+			positional = append(positional, args[i])
+		}
+	}
+
+	if len(positional) != 1 {
+		return exportArgs{}, fmt.Errorf("expected 1 argument, got %d", len(positional))
+	}
+	if parsed.compression != "" && !validCompression(parsed.compression) {
+		return exportArgs{}, fmt.Errorf("invalid --compression value %q (expected none, fast, or best)", parsed.compression)
+	}
+	parsed.name = positional[0]
+	return parsed, nil
+}
+
+// exportManifest describes the contents of an export bundle.
+type exportManifest struct {
+	Workspace string    `json:"workspace"`
+	Branch    string    `json:"branch"`
+	Base      string    `json:"base"`
+	BaseSHA   string    `json:"base_sha"`
+	HeadSHA   string    `json:"head_sha"`
+	Created   time.Time `json:"created"`
+	Patches   []string  `json:"patches"`
+	Database  string    `json:"database,omitempty"`
+}
+
+func cmdExport(args []string) error {
+	parsed, err := parseExportArgs(args)
+	if err != nil {
+		return usageError(err, "Usage: workspace export <name> [--out <file.tar.gz>] [--base <branch>] [--compression none|fast|best]")
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	config, err := loadConfig(projectRoot)
+	if err != nil {
+		return err
+	}
+	compression := parsed.compression
+	if compression == "" {
+		compression = config.DBCompression
+	}
+
+	targetPath, branchName, err := resolveWorktree(projectRoot, parsed.name)
+	if err != nil {
+		return err
+	}
+
+	base := parsed.base
+	if base == "" {
+		base = defaultBaseRef(projectRoot)
+	}
+	if base == "" {
+		return fmt.Errorf("could not determine a base branch; pass --base <branch>")
+	}
+
+	outPath := parsed.outPath
+	if outPath == "" {
+		outPath = fmt.Sprintf("%s-%s.tar.gz", filepath.Base(targetPath), time.Now().Format("20060102-150405"))
+	}
+	outPath, err = filepath.Abs(outPath)
+	if err != nil {
+		return fmt.Errorf("resolving path: %w", err)
+	}
+
+	bundleDir, err := os.MkdirTemp("", "workspace-export-")
+	if err != nil {
+		return fmt.Errorf("creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(bundleDir)
+
+	var steps []StepResult
+	manifest := exportManifest{
+		Workspace: filepath.Base(targetPath),
+		Branch:    branchName,
+		Base:      base,
+		Created:   time.Now().UTC(),
+	}
+	manifest.BaseSHA, _ = gitOutput(targetPath, "merge-base", base, "HEAD")
+	manifest.HeadSHA, _ = gitOutput(targetPath, "rev-parse", "HEAD")
+
+	// Step 1: Patches for the commits on the branch, plus uncommitted changes
+	fmt.Println("--- Generating patches ---")
+	patchDir := filepath.Join(bundleDir, "patches")
+	patchCmd := exec.Command(gitBin, "format-patch", "--quiet", "-o", patchDir, base+"..HEAD")
+	patchCmd.Dir = targetPath
+	patchCmd.Stderr = os.Stderr
+	if err := patchCmd.Run(); err != nil {
+		return fmt.Errorf("generating patches against %s: %w", base, err)
+	}
+	if entries, err := os.ReadDir(patchDir); err == nil {
+		for _, entry := range entries {
+			manifest.Patches = append(manifest.Patches, filepath.Join("patches", entry.Name()))
+		}
+	}
+
+	diff, err := uncommittedDiff(targetPath)
+	if err != nil {
+		return fmt.Errorf("collecting uncommitted changes: %w", err)
+	}
+	if diff != "" {
+		if err := os.WriteFile(filepath.Join(bundleDir, "uncommitted.diff"), []byte(diff+"\n"), 0644); err != nil {
+			return fmt.Errorf("writing uncommitted changes: %w", err)
+		}
+		manifest.Patches = append(manifest.Patches, "uncommitted.diff")
+	}
+	steps = append(steps, StepResult{
+		Description: "Patches",
+		Detail:      fmt.Sprintf("%d file(s) against %s", len(manifest.Patches), base),
+	})
+
+	// Step 2: Database dump (if the worktree has DDEV)
+	if _, err := getDDEVProjectName(targetPath); err == nil {
+		fmt.Println("\n--- Exporting database ---")
+		dbFile, err := exportDatabase(targetPath, filepath.Join(bundleDir, "db.sql"), compression)
+		if err != nil {
+			return fmt.Errorf("exporting database: %w", err)
+		}
+		manifest.Database = filepath.Base(dbFile)
+		steps = append(steps, StepResult{
+			Description: "Database",
+			Detail:      "Exported (" + compressionLabel(compression) + ")",
+		})
+	} else {
+		steps = append(steps, StepResult{
+			Description: "Database",
+			Detail:      "Skipped (no .ddev/config.yaml)",
+		})
+	}
+
+	// Step 3: Manifest and tarball
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(bundleDir, "manifest.json"), append(manifestData, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+
+	if err := writeTarGz(outPath, bundleDir, nil); err != nil {
+		os.Remove(outPath)
+		return fmt.Errorf("writing bundle: %w", err)
+	}
+	steps = append(steps, StepResult{
+		Description: "Bundle",
+		Detail:      outPath,
+	})
+
+	fmt.Println()
+	renderSummary("Workspace Export", steps)
+	return nil
+}
+
+// Compression settings for database dumps produced by the tool. The empty
+// value leaves compression to ddev's default gzip.
+const (
+	compressionNone = "none"
+	compressionFast = "fast"
+	compressionBest = "best"
+)
+
+func validCompression(value string) bool {
+	return value == compressionNone || value == compressionFast || value == compressionBest
+}
+
+func compressionLabel(compression string) string {
+	if compression == "" {
+		return "gzip"
+	}
+	if compression == compressionNone {
+		return "uncompressed"
+	}
+	return "gzip " + compression
+}
+
+// exportDatabase dumps the worktree's DDEV database next to basePath (a path
+// ending in ".sql") and returns the file written. With no compression setting
+// ddev writes basePath.gz itself; "none" keeps raw SQL, and "fast"/"best"
+// compress ddev's raw output at the matching gzip level.
+func exportDatabase(worktreePath, basePath, compression string) (string, error) {
+	switch compression {
+	case "":
+		dest := basePath + ".gz"
+		return dest, runCommandLive(ddevRoot(worktreePath), ddevBin, "export-db", "--file="+dest)
+	case compressionNone:
+		return basePath, runCommandLive(ddevRoot(worktreePath), ddevBin, "export-db", "--gzip=false", "--file="+basePath)
+	}
+
+	level := gzip.BestSpeed
+	if compression == compressionBest {
+		level = gzip.BestCompression
+	}
+
+	dest := basePath + ".gz"
+	f, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewWriterLevel(f, level)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(ddevBin, "export-db", "--gzip=false")
+	cmd.Dir = ddevRoot(worktreePath)
+	cmd.Stdout = gz
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	return dest, f.Close()
+}
+
+// defaultBaseRef picks the ref workspaces are compared against when no base
+// is given: default_base (origin/develop unless configured) if it exists,
+// otherwise the remote's default branch.
+func defaultBaseRef(projectRoot string) string {
+	config, _ := loadConfig(projectRoot)
+	if _, err := resolveCommitish(projectRoot, preferredBase(config)); err == nil {
+		return preferredBase(config)
+	}
+	return remoteDefaultRef(projectRoot)
+}
+
+// preferredBase is the configured default_base, or origin/develop.
+func preferredBase(config workspaceConfig) string {
+	if config.DefaultBase != "" {
+		return config.DefaultBase
+	}
+	return "origin/develop"
+}
+
+// hotfixBranchPrefix is the branch prefix new --hotfix uses unless
+// --branch-prefix gives another.
+const hotfixBranchPrefix = "hotfix/"
+
+// hotfixBase returns what new --hotfix branches from: origin/main or
+// origin/master, or where origin/HEAD points when it names neither develop
+// nor a missing branch.
+func hotfixBase(projectRoot string) (string, error) {
+	for _, ref := range []string{"origin/main", "origin/master"} {
+		if _, err := resolveCommitish(projectRoot, "refs/remotes/"+ref); err == nil {
+			return ref, nil
+		}
+	}
+	if head, err := gitOutput(projectRoot, "symbolic-ref", "--short", "refs/remotes/origin/HEAD"); err == nil && head != "origin/develop" {
+		if _, err := resolveCommitish(projectRoot, head); err == nil {
+			return head, nil
+		}
+	}
+	return "", withHints(fmt.Errorf("--hotfix: no origin/main or origin/master to branch from"),
+		"Pass --base <branch> instead of --hotfix to pick the base yourself.")
+}
+
+// remoteDefaultRef returns the remote's default branch as origin/<branch>:
+// where origin/HEAD points, or else origin/develop or origin/main.
+func remoteDefaultRef(projectRoot string) string {
+	if head, err := gitOutput(projectRoot, "symbolic-ref", "--short", "refs/remotes/origin/HEAD"); err == nil {
+		if _, err := resolveCommitish(projectRoot, head); err == nil {
+			return head
+		}
+	}
+	if branch := detectDefaultBranch(projectRoot); branch != "" {
+		return "origin/" + branch
+	}
+	return ""
+}
+
+// gitOutput runs a git command in dir and returns its trimmed stdout.
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command(gitBin, args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// uncommittedDiff returns the changes in the worktree at path against HEAD,
+// untracked (but not ignored) files included, as a binary-safe diff. They are
+// staged in a throwaway index so the worktree's own index is left alone.
+func uncommittedDiff(path string) (string, error) {
+	tmp, err := os.MkdirTemp("", "workspace-index-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	git := func(args ...string) (string, error) {
+		cmd := exec.Command(gitBin, args...)
+		cmd.Dir = path
+		cmd.Env = append(os.Environ(), "GIT_INDEX_FILE="+filepath.Join(tmp, "index"))
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	if _, err := git("read-tree", "HEAD"); err != nil {
+		return "", err
+	}
+	if _, err := git("add", "-A"); err != nil {
+		return "", err
+	}
+	return git("diff", "--cached", "--binary", "HEAD")
+}
+
+// writeTarGz writes the contents of srcDir to a gzip-compressed tarball at
+// outPath, with entry names relative to srcDir. Paths for which exclude
+// returns true are left out, along with everything under them.
+func writeTarGz(outPath, srcDir string, exclude func(rel string, info os.FileInfo) bool) error {
+	f, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	err = filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if exclude != nil && exclude(filepath.ToSlash(rel), info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// defaultArchiveExclude is what archive leaves out when archive_exclude
+// isn't set: dependencies that can be reinstalled.
+var defaultArchiveExclude = []string{"node_modules/", "vendor/"}
+
+// archiveExcluded reports whether archive leaves out the path rel (slash
+// separated, relative to the worktree). A pattern without a / matches a
+// file or directory of that name at any depth; one with a / matches the
+// whole path. A trailing / matches only directories. The worktree's .git
+// file is always left out, since it only points into this project's
+// repository.
+func archiveExcluded(rel string, isDir bool, patterns []string) bool {
+	if rel == ".git" {
+		return true
+	}
+	for _, pattern := range patterns {
+		dirsOnly := strings.HasSuffix(pattern, "/")
+		pattern = strings.TrimSuffix(pattern, "/")
+		if dirsOnly && !isDir {
+			continue
+		}
+		target := rel
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// cmdArchive saves a worktree's working tree, untracked files included, as
+// a tar.gz under db/archives/ (or --out), and with --remove then removes
+// the workspace as remove would.
+func cmdArchive(args []string) error {
+	usage := "Usage: workspace archive <name> [--out <file.tar.gz>] [--remove [--force] [--yes]]"
+	var positional, removeFlags []string
+	outPath := ""
+	remove := false
+	for i := 0; i < len(args); i++ {
+		if value, n, err := parseValueFlag(args, i, "--out"); err != nil {
+			return usageError(err, usage)
+		} else if n > 0 {
+			outPath = value
+			i += n - 1
+		} else if args[i] == "--remove" {
+			remove = true
+		} else if args[i] == "--force" || args[i] == "--yes" || args[i] == "-y" {
+			removeFlags = append(removeFlags, args[i])
+		} else {
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 1 {
+		return usageError(fmt.Errorf("expected 1 argument, got %d", len(positional)), usage)
+	}
+	if len(removeFlags) > 0 && !remove {
+		return usageError(fmt.Errorf("%s only applies with --remove", removeFlags[0]), usage)
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+	config, err := loadConfig(projectRoot)
+	if err != nil {
+		return err
+	}
+	excludes := config.ArchiveExclude
+	if excludes == nil {
+		excludes = defaultArchiveExclude
+	}
+
+	targetPath, branchName, err := resolveWorktree(projectRoot, positional[0])
+	if err != nil {
+		return err
+	}
+	name := workspaceName(projectRoot, targetPath)
+
+	if outPath == "" {
+		dumpDir, err := dbDir(projectRoot)
+		if err != nil {
+			return err
+		}
+		outPath = filepath.Join(dumpDir, "archives", fmt.Sprintf("%s-%s.tar.gz", strings.ReplaceAll(name, string(filepath.Separator), "-"), time.Now().Format("20060102-150405")))
+	}
+	outPath, err = filepath.Abs(outPath)
+	if err != nil {
+		return fmt.Errorf("resolving path: %w", err)
+	}
+	if pathWithin(targetPath, outPath) {
+		return fmt.Errorf("--out %s is inside the worktree being archived", outPath)
+	}
+	if _, err := os.Stat(outPath); err == nil {
+		return fmt.Errorf("%s already exists", outPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return fmt.Errorf("creating %s: %w", filepath.Dir(outPath), err)
+	}
+
+	err = runPhase("Archiving "+name, func() error {
+		return writeTarGz(outPath, targetPath, func(rel string, info os.FileInfo) bool {
+			return archiveExcluded(rel, info.IsDir(), excludes)
+		})
+	})
+	if err != nil {
+		os.Remove(outPath)
+		return fmt.Errorf("writing archive: %w", err)
+	}
+	info, err := os.Stat(outPath)
+	if err != nil {
+		return err
+	}
+
+	branchDetail := branchName
+	if branchDetail == "" {
+		branchDetail = "(detached HEAD)"
+	}
+	steps := []StepResult{
+		{Description: "Workspace", Detail: name + " on " + branchDetail},
+		{Description: "Excluded", Detail: strings.Join(excludes, ", ")},
+		{Description: "Archive", Detail: outPath},
+		{Description: "Size", Detail: formatBytes(info.Size())},
+	}
+	fmt.Println()
+	renderSummary("Workspace Archive", steps)
+
+	if !remove {
+		return nil
+	}
+	return cmdRemove(append(removeFlags, name))
+}
+
+// findWorktreeByPath returns the worktree registered at path.
+func findWorktreeByPath(entries []worktreeEntry, path string) (worktreeEntry, bool) {
+	for _, entry := range entries {
+		if !entry.isBare && samePath(entry.path, path) {
+			return entry, true
+		}
+	}
+	return worktreeEntry{}, false
+}
+
+func cmdAdopt(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError(fmt.Errorf("expected 1 or 2 arguments, got %d", len(args)), "Usage: workspace adopt <path|branch> [identifier]")
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+	config, err := loadConfig(projectRoot)
+	if err != nil {
+		return err
+	}
+
+	out, err := gitOutput(projectRoot, "worktree", "list", "--porcelain")
+	if err != nil {
+		return fmt.Errorf("listing worktrees: %w", err)
+	}
+	worktrees := parseWorktreeList(out)
+
+	// Accept a path to the worktree or the branch checked out in it
+	var entry worktreeEntry
+	found := false
+	if abs, err := filepath.Abs(args[0]); err == nil {
+		entry, found = findWorktreeByPath(worktrees, resolveSymlinks(abs))
+	}
+	if !found {
+		entry, found = findWorktreeByBranch(worktrees, args[0])
+	}
+	if !found {
+		return withHints(fmt.Errorf("%s is not a worktree of %s", args[0], projectRoot), "Run 'git worktree list' from the project to see registered worktrees.")
+	}
+
+	var steps []StepResult
+	spacesDir := filepath.Join(projectRoot, "spaces")
+	worktreePath := entry.path
+
+	// Step 1: Move the worktree under spaces/ (git keeps its registration)
+	if filepath.Dir(worktreePath) != spacesDir {
+		dest := filepath.Join(spacesDir, filepath.Base(worktreePath))
+		if _, err := os.Stat(dest); err == nil {
+			return withKind(ErrWorktreeExists, fmt.Errorf("%s already exists", dest))
+		}
+		if err := os.MkdirAll(spacesDir, 0755); err != nil {
+			return fmt.Errorf("creating spaces directory: %w", err)
+		}
+		if err := runCommandLive(projectRoot, gitBin, "worktree", "move", worktreePath, dest); err != nil {
+			return fmt.Errorf("moving worktree: %w", err)
+		}
+		steps = append(steps, StepResult{
+			Description: "Moved worktree",
+			Detail:      worktreePath + " → " + dest,
+		})
+		worktreePath = dest
+	} else {
+		steps = append(steps, StepResult{
+			Description: "Worktree",
+			Detail:      "Already under spaces/",
+		})
+	}
+
+	// Step 2: Rename the DDEV project the way new would
+	originalName, err := readDDEVName(filepath.Join(ddevRoot(worktreePath), ".ddev", "config.yaml"))
+	if err != nil {
+		steps = append(steps, StepResult{
+			Description: "DDEV",
+			Detail:      "Skipped (no .ddev/config.yaml found)",
+		})
+		fmt.Println()
+		renderSummary("Workspace Setup", steps)
+		return nil
+	}
+
+	identifier := deriveIdentifier(filepath.Base(worktreePath))
+	if len(args) == 2 {
+		identifier = args[1]
+	}
+	ddevName, err := buildDDEVName(ddevNameData{
+		Identifier:   normalizeDDEVName(identifier),
+		OriginalName: originalName,
+		WorktreeName: filepath.Base(worktreePath),
+		Branch:       entry.branch,
+	}, "", config)
+	if err != nil {
+		return err
+	}
+	if others, err := spaceWorktrees(projectRoot); err == nil {
+		var paths []string
+		for _, wt := range others {
+			if wt.path != worktreePath {
+				paths = append(paths, wt.path)
+			}
+		}
+		if owners := ddevNamesByWorktree(paths)[ddevName]; len(owners) > 0 {
+			return withHints(fmt.Errorf("DDEV project name %q is already used by %s", ddevName, strings.Join(owners, ", ")), fmt.Sprintf("Pass an explicit identifier, e.g. workspace adopt %s <identifier>", args[0]))
+		}
+	}
+
+	renameSteps, err := applyDDEVName(worktreePath, ddevName, getDDEVProjectType(worktreePath))
+	steps = append(steps, renameSteps...)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(ddevRoot(worktreePath), ".ddev", "traefik")); err != nil {
+		return fmt.Errorf("removing .ddev/traefik: %w", err)
+	}
+
+	// Step 3: Start DDEV
+	fmt.Println("\n--- Starting DDEV ---")
+	if err := runDDEVLocked(ddevRoot(worktreePath), nil, "start"); err != nil {
+		return withKind(ErrDDEVFailed, fmt.Errorf("starting DDEV: %w", err))
+	}
+	steps = append(steps, StepResult{
+		Description: "Started DDEV",
+		Detail:      ddevName,
+	})
+
+	fmt.Println()
+	renderSummary("Workspace Setup", steps)
+	return nil
+}
+
+// cmdMove relocates a workspace's worktree, e.g. to another volume. Outside
+// spaces/ it stays known by its name through .workspace/locations.json.
+func cmdMove(args []string) error {
+	usage := "Usage: workspace mv <name> <new-location>"
+	if len(args) != 2 {
+		return usageError(fmt.Errorf("expected 2 arguments, got %d", len(args)), usage)
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+	srcPath, _, err := resolveWorktree(projectRoot, args[0])
+	if err != nil {
+		return err
+	}
+	dest, err := filepath.Abs(expandHome(args[1]))
+	if err != nil {
+		return fmt.Errorf("resolving path: %w", err)
+	}
+	if samePath(srcPath, dest) {
+		return fmt.Errorf("%s is already at %s", args[0], dest)
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return withKind(ErrWorktreeExists, fmt.Errorf("%s already exists", dest))
+	}
+	if pathWithin(srcPath, dest) {
+		return fmt.Errorf("cannot move %s into itself", args[0])
+	}
+
+	locations, err := loadWorktreeLocations(projectRoot)
+	if err != nil {
+		return err
+	}
+	spacesDir := filepath.Join(projectRoot, "spaces")
+	name := workspaceName(projectRoot, srcPath)
+	intoSpaces := pathWithin(spacesDir, dest)
+	if !intoSpaces {
+		if other := locations[name]; other != "" && !samePath(other, srcPath) {
+			return fmt.Errorf("another workspace named %s is already recorded at %s", name, other)
+		}
+	}
+
+	var steps []StepResult
+
+	// DDEV knows the project by its directory; stop it before the move and
+	// start it from the new location afterwards.
+	ddevRunning := false
+	if hasDDEVConfig(ddevRoot(srcPath)) {
+		if desc, err := ddevDescribe(srcPath); err == nil && desc.Status == "running" {
+			ddevRunning = true
+			if err := runPhase("Stopping DDEV", func() error {
+				return runCommandLive(ddevRoot(srcPath), ddevBin, "stop")
+			}); err != nil {
+				return withKind(ErrDDEVFailed, fmt.Errorf("stopping DDEV: %w", err))
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("creating %s: %w", filepath.Dir(dest), err)
+	}
+	moveDetail, err := moveWorktree(projectRoot, srcPath, dest)
+	if err != nil {
+		return err
+	}
+	steps = append(steps, StepResult{
+		Description: "Moved worktree",
+		Detail:      srcPath + " → " + dest + moveDetail,
+	})
+
+	if intoSpaces {
+		delete(locations, name)
+	} else {
+		locations[name] = dest
+	}
+	if err := saveWorktreeLocations(projectRoot, locations); err != nil {
+		return fmt.Errorf("recording the new location: %w", err)
+	}
+	if !intoSpaces {
+		steps = append(steps, StepResult{
+			Description: "Recorded location",
+			Detail:      name + " → " + dest + " (.workspace/locations.json)",
+		})
+	}
+
+	// The shared files and Claude memory links are relative to the worktree
+	if detail, err := linkProjectFiles(dest, projectRoot, getDDEVProjectType(dest)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to link project files: %v\n", err)
+	} else {
+		steps = append(steps, StepResult{Description: "Project files", Detail: detail})
+	}
+	if detail, err := linkClaudeMemory(dest, projectRoot); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to link Claude memory: %v\n", err)
+	} else {
+		steps = append(steps, StepResult{Description: "Claude memory", Detail: detail})
+	}
+
+	if ddevRunning {
+		if err := runPhase("Starting DDEV", func() error {
+			return runDDEVLocked(ddevRoot(dest), nil, "start")
+		}); err != nil {
+			return withKind(ErrDDEVFailed, fmt.Errorf("starting DDEV at %s: %w", dest, err))
+		}
+		steps = append(steps, StepResult{Description: "DDEV", Detail: "Restarted from the new location"})
+	} else if hasDDEVConfig(ddevRoot(dest)) {
+		steps = append(steps, StepResult{Description: "DDEV", Detail: "Not running; uses the new location on its next start"})
+	}
+
+	fmt.Println()
+	renderSummary("Workspace Move", steps)
+	if !intoSpaces {
+		fmt.Fprintf(os.Stderr, "Warning: %s now lives outside spaces/; list, switch, and remove find it by name through .workspace/locations.json, but tools that scan spaces/ won't see it.\n", name)
+	}
+	return nil
+}
+
+// moveWorktree moves the worktree at src to dest. Within a filesystem this
+// is git worktree move; across filesystems, where git's rename fails, the
+// tree is copied, the original removed, and git's links fixed with git
+// worktree repair. The returned detail notes a copy.
+func moveWorktree(projectRoot, src, dest string) (string, error) {
+	if sameFilesystem(src, filepath.Dir(dest)) {
+		if err := runPhase("Moving worktree", func() error {
+			return runCommandLive(projectRoot, gitBin, "worktree", "move", src, dest)
+		}); err != nil {
+			return "", fmt.Errorf("moving worktree: %w", err)
+		}
+		return "", nil
+	}
+
+	if err := runPhase("Copying worktree to "+filepath.Dir(dest), func() error {
+		return copyTree(src, dest)
+	}); err != nil {
+		os.RemoveAll(dest)
+		return "", fmt.Errorf("copying worktree: %w", err)
+	}
+	if err := runCommandLive(projectRoot, gitBin, "worktree", "repair", dest); err != nil {
+		os.RemoveAll(dest)
+		return "", fmt.Errorf("repairing worktree links: %w", err)
+	}
+	if err := os.RemoveAll(src); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not remove the old copy at %s: %v\n", src, err)
+	}
+	return " (copied across filesystems)", nil
+}
+
+// copyTree copies the directory src to dest, which must not exist,
+// keeping file modes and recreating symlinks as they are.
+func copyTree(src, dest string) error {
+	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.IsDir():
+			return os.Mkdir(target, info.Mode().Perm())
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		// Sockets, pipes, and devices have no place in a worktree
+		return nil
+	})
+}
+
+func copyFile(src, dest string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// cmdFreeze stops a workspace's DDEV project and marks it frozen, so that
+// prune, stop-all, and start-all leave it alone until it is thawed.
+func cmdFreeze(args []string) error {
+	usage := "Usage: workspace freeze <name>"
+	if len(args) != 1 {
+		return usageError(fmt.Errorf("expected 1 argument, got %d", len(args)), usage)
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+	path, _, err := resolveWorktree(projectRoot, args[0])
+	if err != nil {
+		return err
+	}
+	name := workspaceName(projectRoot, path)
+	frozen, err := loadFrozen(projectRoot)
+	if err != nil {
+		return err
+	}
+
+	var steps []StepResult
+	if ddevName, err := getDDEVProjectName(path); err != nil {
+		steps = append(steps, StepResult{Description: "DDEV", Detail: "Skipped (no .ddev/config.yaml)"})
+	} else if desc, err := ddevDescribe(path); err == nil && desc.Status != "running" {
+		steps = append(steps, StepResult{Description: "DDEV", Detail: "Not running (" + ddevName + ")"})
+	} else {
+		if err := runPhase("Stopping DDEV", func() error {
+			return runCommandLive(ddevRoot(path), ddevBin, "stop")
+		}); err != nil {
+			return withKind(ErrDDEVFailed, fmt.Errorf("stopping DDEV for %s: %w", name, err))
+		}
+		steps = append(steps, StepResult{Description: "DDEV", Detail: "Stopped (" + ddevName + ")"})
+	}
+
+	if since, ok := frozen[name]; ok {
+		steps = append(steps, StepResult{Description: "Frozen", Detail: "Already frozen since " + since.Format("2006-01-02")})
+	} else {
+		frozen[name] = time.Now().UTC()
+		if err := saveFrozen(projectRoot, frozen); err != nil {
+			return fmt.Errorf("recording the freeze: %w", err)
+		}
+		steps = append(steps, StepResult{Description: "Frozen", Detail: name + " (skipped by prune, stop-all, and start-all)"})
+	}
+
+	fmt.Println()
+	renderSummary("Workspace Freeze", steps)
+	return nil
+}
+
+// cmdThaw reverses freeze: the workspace is unmarked and, unless
+// --no-start is given, its DDEV project started again.
+func cmdThaw(args []string) error {
+	usage := "Usage: workspace thaw <name> [--no-start]"
+	var positional []string
+	start := true
+	for _, arg := range args {
+		if arg == "--no-start" {
+			start = false
+		} else if strings.HasPrefix(arg, "-") {
+			return usageError(fmt.Errorf("unknown flag: %s", arg), usage)
+		} else {
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) != 1 {
+		return usageError(fmt.Errorf("expected 1 argument, got %d", len(positional)), usage)
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+	path, _, err := resolveWorktree(projectRoot, positional[0])
+	if err != nil {
+		return err
+	}
+	name := workspaceName(projectRoot, path)
+	frozen, err := loadFrozen(projectRoot)
+	if err != nil {
+		return err
+	}
+	if _, ok := frozen[name]; !ok {
+		return fmt.Errorf("%s is not frozen", name)
+	}
+
+	delete(frozen, name)
+	if err := saveFrozen(projectRoot, frozen); err != nil {
+		return fmt.Errorf("recording the thaw: %w", err)
+	}
+	steps := []StepResult{{Description: "Thawed", Detail: name}}
+
+	if ddevName, err := getDDEVProjectName(path); err != nil {
+		steps = append(steps, StepResult{Description: "DDEV", Detail: "Skipped (no .ddev/config.yaml)"})
+	} else if !start {
+		steps = append(steps, StepResult{Description: "DDEV", Detail: "Not started (--no-start)"})
+	} else {
+		if err := runPhase("Starting DDEV", func() error {
+			return runDDEVLocked(ddevRoot(path), nil, "start")
+		}); err != nil {
+			return withKind(ErrDDEVFailed, fmt.Errorf("starting DDEV for %s: %w", name, err))
+		}
+		steps = append(steps, StepResult{Description: "DDEV", Detail: "Started (" + ddevName + ")"})
+	}
+
+	fmt.Println()
+	renderSummary("Workspace Thaw", steps)
+	return nil
+}
+
+type cleanArgs struct {
+	db             bool
+	logs           bool
+	olderThan      time.Duration
+	includeDefault bool
+	dryRun         bool
+	yes            bool
+}
+
+func parseCleanArgs(args []string) (cleanArgs, error) {
+	var parsed cleanArgs
+
+	for i := 0; i < len(args); i++ {
+		if value, n, err := parseValueFlag(args, i, "--older-than"); err != nil {
+			return cleanArgs{}, err
+		} else if n > 0 {
+			age, err := parseAge(value)
+			if err != nil {
+				return cleanArgs{}, err
+			}
+			parsed.olderThan = age
+			i += n - 1
+		} else if args[i] == "--db" {
+			parsed.db = true
+		} else if args[i] == "--logs" {
+			parsed.logs = true
+		} else if args[i] == "--include-default" {
+			parsed.includeDefault = true
+		} else if args[i] == "--dry-run" {
+			parsed.dryRun = true
+		} else if args[i] == "--yes" || args[i] == "-y" {
+			parsed.yes = true
+		} else {
+			return cleanArgs{}, fmt.Errorf("unexpected argument: %s", args[i])
+		}
+	}
+
+	// Neither scope given means both
+	if !parsed.db && !parsed.logs {
+		parsed.db, parsed.logs = true, true
+	}
+	return parsed, nil
+}
+
+// cleanFile is a file clean would delete.
+type cleanFile struct {
+	path string
+	size int64
+}
+
+// findCleanFiles lists the files under db/ and .workspace/logs/ that clean
+// should delete. db/db.sql.gz (and its checksum) is kept unless
+// includeDefault, as is db/snapshots.json, and nothing inside db/archives/ or
+// the protected directories is ever returned.
+func findCleanFiles(projectRoot string, parsed cleanArgs, protected []string, now time.Time) ([]cleanFile, error) {
+	dumpDir, err := dbDir(projectRoot)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	if parsed.db {
+		dirs = append(dirs, dumpDir)
+	}
+	if parsed.logs {
+		dirs = append(dirs, filepath.Join(projectRoot, ".workspace", "logs"))
+	}
+
+	// Worktree archives are backups of work, not regenerable artifacts.
+	protected = append(protected[:len(protected):len(protected)], filepath.Join(dumpDir, "archives"))
+	keep := []string{filepath.Join(dumpDir, snapshotsFile)}
+	if !parsed.includeDefault {
+		defaultDump := filepath.Join(dumpDir, "db.sql.gz")
+		keep = append(keep, defaultDump, defaultDump+".sha256")
+	}
+
+	var files []cleanFile
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			for _, p := range protected {
+				if pathWithin(p, path) {
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+			}
+			if d.IsDir() || containsString(keep, path) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if parsed.olderThan > 0 && now.Sub(info.ModTime()) < parsed.olderThan {
+				return nil
+			}
+			files = append(files, cleanFile{path: path, size: info.Size()})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// formatBytes renders a byte count for humans, e.g. "12.3 MB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func cmdClean(args []string) error {
+	parsed, err := parseCleanArgs(args)
+	if err != nil {
+		return usageError(err, "Usage: workspace clean [--db] [--logs] [--older-than <age>] [--include-default] [--dry-run] [--yes]")
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	// Never touch worktrees or the repository, even through a symlink
+	protected := []string{filepath.Join(projectRoot, "spaces"), filepath.Join(projectRoot, ".git")}
+	if commonDir, err := gitOutput(projectRoot, "rev-parse", "--path-format=absolute", "--git-common-dir"); err == nil {
+		protected = append(protected, commonDir)
+	}
+
+	files, err := findCleanFiles(projectRoot, parsed, protected, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Println("Nothing to clean.")
+		return nil
+	}
+
+	var total int64
+	fmt.Println("Files to delete:")
+	for _, f := range files {
+		rel, _ := filepath.Rel(projectRoot, f.path)
+		fmt.Printf("  %-50s %s\n", rel, formatBytes(f.size))
+		total += f.size
+	}
+
+	if parsed.dryRun {
+		fmt.Printf("\nDry run: would reclaim %s.\n", formatBytes(total))
+		return nil
+	}
+
+	ok, err := confirmUnlessYes(fmt.Sprintf("\nDelete %d files (%s)? (y/N) ", len(files), formatBytes(total)), parsed.yes)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("Aborted.")
+		return nil
+	}
+
+	var reclaimed int64
+	failed := false
+	for _, f := range files {
+		if err := os.Remove(f.path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not delete %s: %v\n", f.path, err)
+			failed = true
+			continue
+		}
+		reclaimed += f.size
+	}
+	fmt.Printf("\nReclaimed %s.\n", formatBytes(reclaimed))
+	if failed {
+		return fmt.Errorf("some files could not be deleted")
+	}
+	return nil
+}
+
+// workspaceInfo is everything info reports about one workspace.
+type workspaceInfo struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	Branch      string `json:"branch"`
+	Upstream    string `json:"upstream,omitempty"`
+	Ahead       int    `json:"ahead"`
+	Behind      int    `json:"behind"`
+	HeadSHA     string `json:"head_sha"`
+	HeadSubject string `json:"head_subject"`
+	Dirty       bool   `json:"dirty"`
+	DDEVName    string `json:"ddev_name,omitempty"`
+	DDEVStatus  string `json:"ddev_status,omitempty"`
+	DDEVURL     string `json:"ddev_url,omitempty"`
+}
+
+// parseAheadBehind parses `git rev-list --left-right --count HEAD...@{u}`.
+func parseAheadBehind(out string) (ahead, behind int, err error) {
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rev-list output %q", out)
+	}
+	if ahead, err = strconv.Atoi(fields[0]); err != nil {
+		return 0, 0, err
+	}
+	if behind, err = strconv.Atoi(fields[1]); err != nil {
+		return 0, 0, err
+	}
+	return ahead, behind, nil
+}
+
+// gatherWorkspaceInfo runs the git and ddev lookups for the worktree at path.
+// Lookups that fail (no upstream, no DDEV) leave their fields empty.
+func gatherWorkspaceInfo(path, branch string) workspaceInfo {
+	info := workspaceInfo{Name: filepath.Base(path), Path: path, Branch: branch}
+
+	if upstream, err := gitOutput(path, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}"); err == nil {
+		info.Upstream = upstream
+		if out, err := gitOutput(path, "rev-list", "--left-right", "--count", "HEAD...@{u}"); err == nil {
+			info.Ahead, info.Behind, _ = parseAheadBehind(out)
+		}
+	}
+	if out, err := gitOutput(path, "log", "-1", "--format=%H%x00%s"); err == nil {
+		info.HeadSHA, info.HeadSubject, _ = strings.Cut(out, "\x00")
+	}
+	if out, err := gitOutput(path, "status", "--porcelain"); err == nil {
+		info.Dirty = out != ""
+	}
+
+	if name, err := getDDEVProjectName(path); err == nil {
+		info.DDEVName = name
+		if desc, err := ddevDescribe(path); err == nil {
+			info.DDEVStatus = desc.Status
+			info.DDEVURL = desc.PrimaryURL
+		}
+	}
+	return info
+}
+
+func cmdInfo(args []string) error {
+	asJSON := false
+	var names []string
+	for _, arg := range args {
+		if arg == "--json" {
+			asJSON = true
+		} else {
+			names = append(names, arg)
+		}
+	}
+	if len(names) > 1 {
+		return usageError(fmt.Errorf("expected at most 1 argument, got %d", len(names)), "Usage: workspace info [name] [--json]")
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	var path, branch string
+	if len(names) == 1 {
+		path, branch, err = resolveWorktree(projectRoot, names[0])
+		if err != nil {
+			return err
+		}
+	} else {
+		// Without a name, use the worktree containing the current directory
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("getting current directory: %w", err)
+		}
+		cwd = resolveSymlinks(cwd)
+		worktrees, err := spaceWorktrees(projectRoot)
+		if err != nil {
+			return err
+		}
+		entry, ok := findContainingWorktree(worktrees, cwd)
+		if !ok {
+			return fmt.Errorf("%s is not inside a workspace under %s", cwd, filepath.Join(projectRoot, "spaces"))
+		}
+		path, branch = entry.path, entry.branch
+	}
+
+	info := gatherWorkspaceInfo(path, branch)
+
+	if asJSON {
+		out, _ := json.MarshalIndent(info, "", "  ")
+		fmt.Println(string(out))
+		return nil
+	}
+
+	orNone := func(value, none string) string {
+		if value == "" {
+			return none
+		}
+		return value
+	}
+	upstream := "(none)"
+	if info.Upstream != "" {
+		upstream = fmt.Sprintf("%s (ahead %d, behind %d)", info.Upstream, info.Ahead, info.Behind)
+	}
+	status := "clean"
+	if info.Dirty {
+		status = "uncommitted changes"
+	}
+
+	fmt.Printf("  %-14s %s\n", "Workspace:", info.Name)
+	fmt.Printf("  %-14s %s\n", "Path:", info.Path)
+	fmt.Printf("  %-14s %s\n", "Branch:", orNone(info.Branch, "(detached)"))
+	fmt.Printf("  %-14s %s\n", "Upstream:", upstream)
+	fmt.Printf("  %-14s %s %s\n", "HEAD:", shortSHA(info.HeadSHA), info.HeadSubject)
+	fmt.Printf("  %-14s %s\n", "Status:", status)
+	fmt.Printf("  %-14s %s\n", "DDEV project:", orNone(info.DDEVName, "(none)"))
+	if info.DDEVName != "" {
+		fmt.Printf("  %-14s %s\n", "DDEV status:", orNone(info.DDEVStatus, "unknown"))
+		fmt.Printf("  %-14s %s\n", "URL:", orNone(info.DDEVURL, "(not running)"))
+	}
+	return nil
+}
+
+func cmdSwitch(args []string) error {
+	if len(args) > 1 {
+		return usageError(fmt.Errorf("expected at most 1 argument, got %d", len(args)), "Usage: workspace switch [name]")
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		fmt.Println(projectRoot)
+		return nil
+	}
+
+	targetPath, _, err := resolveWorktree(projectRoot, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println(targetPath)
+	return nil
+}
+
+// shellInitScript returns the "ws" wrapper function for shell, which cd's
+// into the directory printed by workspace switch.
+func shellInitScript(shell string) (string, error) {
+	switch shell {
+	case "bash", "zsh":
+		return `ws() {
+  local dir
+  dir="$(workspace switch "$@")" && cd "$dir"
+}
+`, nil
+	case "fish":
+		return `function ws
+    set -l dir (workspace switch $argv); and cd $dir
+end
+`, nil
+	}
+	return "", fmt.Errorf("unsupported shell %q (expected bash, zsh, or fish)", shell)
+}
+
+func cmdShellInit(args []string) error {
+	if len(args) > 1 {
+		return usageError(fmt.Errorf("expected at most 1 argument, got %d", len(args)), "Usage: workspace shell-init [bash|zsh|fish]")
+	}
+
+	shell := "bash"
+	if len(args) == 1 {
+		shell = args[0]
+	} else if env := filepath.Base(os.Getenv("SHELL")); env == "zsh" || env == "fish" {
+		shell = env
+	}
+
+	script, err := shellInitScript(shell)
+	if err != nil {
+		return err
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// completionCommands are the subcommands offered by tab completion.
+var completionCommands = []string{
+	"adopt", "archive", "branch", "clean", "completion", "config-ddev", "doctor", "duplicate",
+	"export", "fetch", "freeze", "info", "init", "list", "ls-remote-branches", "mv",
+	"new", "open-db", "projects", "prune", "prune-docker", "rebase", "refresh",
+	"remove", "restore", "self-update", "set-head", "share", "shell-init", "snapshot",
+	"ssh", "start-all", "stash", "stop-all", "switch", "test-connection", "thaw",
+	"version", "which",
+}
+
+// workspaceArgCommands take workspace names as positional arguments.
+var workspaceArgCommands = map[string]bool{
+	"branch": true, "config-ddev": true, "duplicate": true, "export": true,
+	"freeze": true, "info": true, "mv": true, "open-db": true, "rebase": true,
+	"refresh": true, "remove": true, "restore": true, "share": true,
+	"snapshot": true, "ssh": true, "stash": true, "switch": true, "thaw": true,
+}
+
+// Kinds of value completionKind can ask for
+const (
+	completeNothing    = ""
+	completeCommand    = "command"
+	completeWorkspace  = "workspace"
+	completeBranch     = "branch"
+	completeShellNames = "shell"
+)
+
+// completionKind decides what to offer for the last of words, the command
+// line after "workspace" up to the word being completed. It returns the
+// kind and the part of the word to match, and a prefix to put back on each
+// candidate (for --base=<branch>).
+func completionKind(words []string) (kind, partial, keep string) {
+	if len(words) == 0 {
+		return completeCommand, "", ""
+	}
+	partial = words[len(words)-1]
+	if len(words) == 1 {
+		return completeCommand, partial, ""
+	}
+
+	command := words[0]
+	prev := words[len(words)-2]
+	// bash splits --base=x into --base, =, and x
+	if prev == "=" && len(words) >= 3 {
+		prev = words[len(words)-3]
+	}
+	if isBaseFlag(command, prev) {
+		return completeBranch, partial, ""
+	}
+	if flag, value, ok := strings.Cut(partial, "="); ok && isBaseFlag(command, flag) {
+		return completeBranch, value, flag + "="
+	}
+	if strings.HasPrefix(partial, "-") {
+		return completeNothing, partial, ""
+	}
+
+	switch {
+	case command == "shell-init" || command == "completion":
+		return completeShellNames, partial, ""
+	case workspaceArgCommands[command]:
+		return completeWorkspace, partial, ""
+	}
+	return completeNothing, partial, ""
+}
+
+// isBaseFlag reports whether flag takes a base branch for command.
+func isBaseFlag(command, flag string) bool {
+	switch flag {
+	case "--base":
+		return command == "new" || command == "branch" || command == "export"
+	case "--onto":
+		return command == "rebase"
+	}
+	return false
+}
+
+// completionBranches returns the local branches and origin's
+// remote-tracking branches, as --base accepts them.
+func completionBranches(projectRoot string) []string {
+	out, err := gitOutput(projectRoot, "for-each-ref", "--format=%(refname:short)", "refs/heads", "refs/remotes/origin")
+	if err != nil {
+		return nil
+	}
+	var branches []string
+	for _, name := range strings.Fields(out) {
+		if name != "origin/HEAD" && name != "origin" {
+			branches = append(branches, name)
+		}
+	}
+	return branches
+}
+
+// cmdComplete is the backend of the completion scripts: it prints the
+// candidates for the last argument, one per line. Outside a project it
+// prints what it can without one.
+func cmdComplete(args []string) error {
+	kind, partial, keep := completionKind(args)
+
+	var candidates []string
+	switch kind {
+	case completeCommand:
+		candidates = completionCommands
+	case completeShellNames:
+		candidates = []string{"bash", "fish", "zsh"}
+	case completeWorkspace, completeBranch:
+		projectRoot, err := findProjectRoot()
+		if err != nil {
+			return nil
+		}
+		if kind == completeBranch {
+			candidates = completionBranches(projectRoot)
+			break
+		}
+		workspaces, err := collectWorkspaces(projectRoot)
+		if err != nil {
+			return nil
+		}
+		for _, ws := range workspaces {
+			candidates = append(candidates, ws.name)
+		}
+	}
+
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, partial) {
+			fmt.Println(keep + candidate)
+		}
+	}
+	return nil
+}
+
+// completionScript returns the tab-completion script for shell, which asks
+// workspace __complete for the candidates.
+func completionScript(shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return `_workspace_complete() {
+  local IFS=$'\n'
+  COMPREPLY=($(workspace __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _workspace_complete workspace
+`, nil
+	case "zsh":
+		return `_workspace() {
+  local -a candidates
+  candidates=("${(@f)$(workspace __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+  compadd -- "${candidates[@]}"
+}
+compdef _workspace workspace
+`, nil
+	case "fish":
+		return `complete -c workspace -f -a '(workspace __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)'
+`, nil
+	}
+	return "", fmt.Errorf("unsupported shell %q (expected bash, zsh, or fish)", shell)
+}
+
+func cmdCompletion(args []string) error {
+	if len(args) > 1 {
+		return usageError(fmt.Errorf("expected at most 1 argument, got %d", len(args)), "Usage: workspace completion [bash|zsh|fish]")
+	}
+
+	shell := "bash"
+	if len(args) == 1 {
+		shell = args[0]
+	} else if env := filepath.Base(os.Getenv("SHELL")); env == "zsh" || env == "fish" {
+		shell = env
+	}
+
+	script, err := completionScript(shell)
+	if err != nil {
+		return err
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// currentVersion is the version of the running binary: buildVersion, or
+// for a go install build without -ldflags, the module version Go recorded.
+func currentVersion() string {
+	if buildVersion != "dev" {
+		return buildVersion
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return buildVersion
+}
+
+// releaseSource is where self-update gets new versions: the GitHub releases
+// of a repository (owner/repo), or a Go module built with go install.
+type releaseSource struct {
+	kind   string
+	target string
+}
+
+const (
+	sourceGitHub = "github"
+	sourceGo     = "go"
+)
+
+// parseReleaseSource parses github:owner/repo, a https://github.com/owner/repo
+// URL, or go:<module path>.
+func parseReleaseSource(value string) (releaseSource, error) {
+	if module, ok := strings.CutPrefix(value, "go:"); ok {
+		module, _, _ = strings.Cut(module, "@")
+		if module == "" {
+			return releaseSource{}, fmt.Errorf("update source %q names no module", value)
+		}
+		return releaseSource{sourceGo, module}, nil
+	}
+
+	repo, ok := strings.CutPrefix(value, "github:")
+	if !ok {
+		if repo, ok = strings.CutPrefix(value, "https://github.com/"); ok {
+			repo = strings.TrimSuffix(strings.TrimSuffix(repo, "/"), ".git")
+		}
+	}
+	owner, name, found := strings.Cut(repo, "/")
+	if !ok || !found || owner == "" || name == "" || strings.Contains(name, "/") {
+		return releaseSource{}, fmt.Errorf("invalid update source %q (expected github:owner/repo, a GitHub repository URL, or go:<module>)", value)
+	}
+	return releaseSource{sourceGitHub, repo}, nil
+}
+
+// compareVersions compares two versions like v1.4.2, returning -1, 0, or 1.
+// A pre-release (v1.5.0-rc1) sorts before its release. A version that isn't
+// numeric, such as dev, sorts before everything else.
+func compareVersions(a, b string) int {
+	parse := func(v string) ([]int, string, bool) {
+		core, pre, _ := strings.Cut(strings.TrimPrefix(v, "v"), "-")
+		var parts []int
+		for _, field := range strings.Split(core, ".") {
+			n, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, "", false
+			}
+			parts = append(parts, n)
+		}
+		return parts, pre, true
+	}
+	pa, preA, okA := parse(a)
+	pb, preB, okB := parse(b)
+	switch {
+	case !okA && !okB:
+		return strings.Compare(a, b)
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	return strings.Compare(preA, preB)
+}
+
+// githubAPI is the GitHub API base URL, replaced in tests.
+var githubAPI = "https://api.github.com"
+
+// releaseAssetName is the name of this platform's binary among a GitHub
+// release's assets, e.g. workspace_darwin_arm64.
+func releaseAssetName() string {
+	name := "workspace_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// githubRequest builds a GitHub API request, authenticated with GITHUB_TOKEN
+// when it is set so private repositories work.
+func githubRequest(url, accept string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+var updateClient = &http.Client{Timeout: 5 * time.Minute}
+
+// latestGitHubRelease returns the tag of repo's latest release, the API URL
+// of this platform's binary in it, and the API URL of the asset publishing
+// that binary's SHA-256 ("" when the release has none).
+func latestGitHubRelease(repo string) (version, assetURL, checksumURL string, err error) {
+	req, err := githubRequest(githubAPI+"/repos/"+repo+"/releases/latest", "application/vnd.github+json")
+	if err != nil {
+		return "", "", "", err
+	}
+	resp, err := updateClient.Do(req)
+	if err != nil {
+		return "", "", "", fmt.Errorf("checking the latest release of %s: %w", repo, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", "", withHints(fmt.Errorf("checking the latest release of %s: %s", repo, resp.Status),
+			"For a private repository, set GITHUB_TOKEN to a token that can read it.")
+	}
+
+	var latest struct {
+		TagName string `json:"tag_name"`
+		Assets  []struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"assets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&latest); err != nil {
+		return "", "", "", fmt.Errorf("reading the latest release of %s: %w", repo, err)
+	}
+	var names []string
+	for _, asset := range latest.Assets {
+		switch asset.Name {
+		case releaseAssetName():
+			assetURL = asset.URL
+		case releaseAssetName() + ".sha256":
+			checksumURL = asset.URL
+		case "checksums.txt":
+			if checksumURL == "" {
+				checksumURL = asset.URL
+			}
+		}
+		names = append(names, asset.Name)
+	}
+	if assetURL == "" {
+		return latest.TagName, "", "", fmt.Errorf("release %s of %s has no %s binary (assets: %s)", latest.TagName, repo, releaseAssetName(), strings.Join(names, ", "))
+	}
+	return latest.TagName, assetURL, checksumURL, nil
+}
+
+// releaseChecksum downloads a release's checksum asset and returns the
+// SHA-256 it lists for this platform's binary. Both a sidecar holding just
+// the hash and a sha256sum-style list of "<hash>  <name>" lines are accepted.
+func releaseChecksum(checksumURL string) (string, error) {
+	req, err := githubRequest(checksumURL, "application/octet-stream")
+	if err != nil {
+		return "", err
+	}
+	resp, err := updateClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloading %s: %s", checksumURL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %w", checksumURL, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 1 || (len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == releaseAssetName()) {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s lists no checksum for %s", checksumURL, releaseAssetName())
+}
+
+// downloadAsset saves a GitHub release asset to dest.
+func downloadAsset(assetURL, dest string) error {
+	req, err := githubRequest(assetURL, "application/octet-stream")
+	if err != nil {
+		return err
+	}
+	resp, err := updateClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading %s: %s", assetURL, resp.Status)
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return fmt.Errorf("downloading %s: %w", assetURL, err)
+	}
+	return f.Close()
+}
+
+// latestModuleVersion asks the Go toolchain for a module's latest version.
+func latestModuleVersion(module string) (string, error) {
+	out, err := exec.Command("go", "list", "-m", "-json", module+"@latest").Output()
+	if err != nil {
+		return "", fmt.Errorf("go list -m %s@latest: %w", module, err)
+	}
+	var info struct {
+		Version string `json:"Version"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return "", fmt.Errorf("reading go list output: %w", err)
+	}
+	return info.Version, nil
+}
+
+// installModule builds module at version with go install and copies the
+// binary to dest.
+func installModule(module, version, dest string) error {
+	gobin, err := os.MkdirTemp("", "workspace-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(gobin)
+
+	if err := runPhase("Installing "+module+"@"+version, func() error {
+		return runCommandLiveEnv("", []string{"GOBIN=" + gobin}, "go", "install", module+"@"+version)
+	}); err != nil {
+		return fmt.Errorf("go install %s@%s: %w", module, version, err)
+	}
+	entries, err := os.ReadDir(gobin)
+	if err != nil {
+		return err
+	}
+	if len(entries) != 1 {
+		return fmt.Errorf("go install %s@%s produced %d files, expected one binary", module, version, len(entries))
+	}
+	os.Remove(dest)
+	return copyFile(filepath.Join(gobin, entries[0].Name()), dest, 0755)
+}
+
+// resolveUpdateSource picks the update source from --source,
+// WORKSPACE_UPDATE_SOURCE, update_source in the enclosing project's
+// .workspace.yaml, or the one built in.
+func resolveUpdateSource(flag string) (string, error) {
+	if flag != "" {
+		return flag, nil
+	}
+	if env := os.Getenv("WORKSPACE_UPDATE_SOURCE"); env != "" {
+		return env, nil
+	}
+	if root := enclosingProjectRoot(); root != "" {
+		if config, err := loadConfig(root); err == nil && config.UpdateSource != "" {
+			return config.UpdateSource, nil
+		}
+	}
+	if updateSource != "" {
+		return updateSource, nil
+	}
+	return "", usageError(fmt.Errorf("no update source configured"),
+		"Pass --source github:owner/repo (or go:<module>), or set WORKSPACE_UPDATE_SOURCE or update_source in .workspace.yaml.")
+}
+
+// verifyFileChecksum checks that the SHA-256 of the file at path is expected.
+func verifyFileChecksum(path, expected string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("could not read %s: %w", path, err)
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != expected {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s (corrupt or incomplete download?)", path, expected, actual)
+	}
+	return nil
+}
+
+// removeReplacedBinary deletes the binary a previous self-update moved aside
+// on Windows, where it couldn't be deleted while it was still running.
+func removeReplacedBinary() {
+	if runtime.GOOS != "windows" {
+		return
+	}
+	if exe, err := os.Executable(); err == nil {
+		if exe, err = filepath.EvalSymlinks(exe); err == nil {
+			os.Remove(exe + ".old")
+		}
+	}
+}
+
+// cmdSelfUpdate replaces the running binary with the latest release from
+// the update source, or with --check only reports whether there is one.
+func cmdSelfUpdate(args []string) error {
+	usage := "Usage: workspace self-update [--check] [--source <source>]"
+	check := false
+	sourceFlag := ""
+	for i := 0; i < len(args); i++ {
+		if value, n, err := parseValueFlag(args, i, "--source"); err != nil {
+			return usageError(err, usage)
+		} else if n > 0 {
+			sourceFlag = value
+			i += n - 1
+		} else if args[i] == "--check" {
+			check = true
+		} else {
+			return usageError(fmt.Errorf("unexpected argument: %s", args[i]), usage)
+		}
+	}
+
+	value, err := resolveUpdateSource(sourceFlag)
+	if err != nil {
+		return err
+	}
+	source, err := parseReleaseSource(value)
+	if err != nil {
+		return usageError(err, usage)
+	}
+
+	var latest, assetURL, checksumURL string
+	if source.kind == sourceGitHub {
+		latest, assetURL, checksumURL, err = latestGitHubRelease(source.target)
+	} else {
+		latest, err = latestModuleVersion(source.target)
+	}
+	if err != nil && (check || latest == "") {
+		return err
+	}
+
+	current := currentVersion()
+	if compareVersions(current, latest) >= 0 {
+		fmt.Printf("workspace %s is up to date (latest: %s)\n", current, latest)
+		return nil
+	}
+	if check {
+		fmt.Printf("Update available: %s → %s\n", current, latest)
+		fmt.Println("Run workspace self-update to install it.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		return fmt.Errorf("locating the running binary: %w", err)
+	}
+
+	// The new binary is staged next to the old one so the final rename
+	// stays on one filesystem, and is run once before it replaces anything.
+	staged := exe + ".new"
+	defer os.Remove(staged)
+	if source.kind == sourceGitHub {
+		if checksumURL == "" {
+			return withHints(fmt.Errorf("release %s publishes no checksum for %s", latest, releaseAssetName()),
+				"Attach checksums.txt (sha256sum output) or "+releaseAssetName()+".sha256 to the release.")
+		}
+		err = runPhase("Downloading "+releaseAssetName()+" "+latest, func() error {
+			expected, err := releaseChecksum(checksumURL)
+			if err != nil {
+				return err
+			}
+			if err := downloadAsset(assetURL, staged); err != nil {
+				return err
+			}
+			return verifyFileChecksum(staged, expected)
+		})
+	} else {
+		err = installModule(source.target, latest, staged)
+	}
+	if err != nil {
+		return err
+	}
+	if out, err := exec.Command(staged, "version").CombinedOutput(); err != nil {
+		return fmt.Errorf("the downloaded binary doesn't run (%v): %s", err, strings.TrimSpace(string(out)))
+	}
+
+	// Windows can't replace a running executable, but can rename it; the
+	// next start removes the .old copy
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return fmt.Errorf("moving the old binary aside: %w", err)
+		}
+	}
+	if err := os.Rename(staged, exe); err != nil {
+		return withHints(fmt.Errorf("replacing %s: %w", exe, err), "Check that you can write to "+filepath.Dir(exe)+".")
+	}
+
+	fmt.Printf("\nUpdated workspace %s → %s (%s)\n", current, latest, exe)
+	return nil
+}
+
+// remoteBranches returns the short names of the origin remote-tracking
+// branches, without origin/HEAD.
+func remoteBranches(projectRoot string) ([]string, error) {
+	out, err := gitOutput(projectRoot, "for-each-ref", "--format=%(refname)", "refs/remotes/origin")
+	if err != nil {
+		return nil, err
+	}
+	var branches []string
+	for _, ref := range strings.Fields(out) {
+		name := strings.TrimPrefix(ref, "refs/remotes/origin/")
+		if name != "HEAD" {
+			branches = append(branches, name)
+		}
+	}
+	sort.Strings(branches)
+	return branches, nil
+}
+
+// diffBranches returns the branches in after but not before, and the ones in
+// before but not after.
+func diffBranches(before, after []string) (added, removed []string) {
+	for _, b := range after {
+		if !containsString(before, b) {
+			added = append(added, b)
+		}
+	}
+	for _, b := range before {
+		if !containsString(after, b) {
+			removed = append(removed, b)
+		}
+	}
+	return added, removed
+}
+
+func cmdFetch(args []string) error {
+	prune := false
+	for _, arg := range args {
+		if arg == "--prune" {
+			prune = true
+		} else {
+			return usageError(fmt.Errorf("unexpected argument: %s", arg), "Usage: workspace fetch [--prune]")
+		}
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	// Compare against the branches seen by the last workspace fetch, or the
+	// current refs when there's no cache yet.
+	cachePath := filepath.Join(projectRoot, ".workspace", "remote-branches")
+	var before []string
+	if data, err := os.ReadFile(cachePath); err == nil {
+		before = strings.Fields(string(data))
+	} else if before, err = remoteBranches(projectRoot); err != nil {
+		return fmt.Errorf("listing remote branches: %w", err)
+	}
+
+	fetchArgs := []string{"fetch", "origin"}
+	if prune {
+		fetchArgs = append(fetchArgs, "--prune")
+	}
+	fmt.Println("--- Fetching latest changes ---")
+	if err := runCommandLive(projectRoot, gitBin, fetchArgs...); err != nil {
+		return fmt.Errorf("fetching from origin: %w", err)
+	}
+
+	after, err := remoteBranches(projectRoot)
+	if err != nil {
+		return fmt.Errorf("listing remote branches: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+		err = writeFileAtomic(cachePath, []byte(strings.Join(after, "\n")+"\n"), 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not save %s: %v\n", cachePath, err)
+		}
+	}
+
+	added, removed := diffBranches(before, after)
+	fmt.Println()
+	if len(added) == 0 && len(removed) == 0 {
+		fmt.Println("No new or removed remote branches.")
+		return nil
+	}
+	if len(added) > 0 {
+		fmt.Println("New remote branches:")
+		for _, b := range added {
+			fmt.Printf("  + %s\n", b)
+		}
+	}
+	if len(removed) > 0 {
+		fmt.Println("Removed remote branches:")
+		for _, b := range removed {
+			fmt.Printf("  - %s\n", b)
+		}
+	}
+	return nil
+}
+
+// remoteBranchEntry is an origin branch as listed by ls-remote-branches,
+// with the workspace that has it checked out, if any.
+type remoteBranchEntry struct {
+	name      string
+	workspace string
+}
+
+// matchRemoteBranches returns the branches matching pattern (all of them
+// when it is empty), each with the worktree in worktrees that has it
+// checked out shown relative to projectRoot when it lies inside.
+// A pattern may name the branch with or without origin/.
+func matchRemoteBranches(projectRoot string, branches []string, pattern string, worktrees []worktreeEntry) ([]remoteBranchEntry, error) {
+	pattern = strings.TrimPrefix(pattern, "origin/")
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid --pattern %q", pattern)
+	}
+	var entries []remoteBranchEntry
+	for _, branch := range branches {
+		if pattern != "" {
+			if ok, _ := path.Match(pattern, branch); !ok {
+				continue
+			}
+		}
+		entry := remoteBranchEntry{name: branch}
+		if wt, ok := findWorktreeByBranch(worktrees, branch); ok {
+			entry.workspace = wt.path
+			if rel, err := filepath.Rel(projectRoot, wt.path); err == nil && pathWithin(projectRoot, wt.path) {
+				entry.workspace = filepath.ToSlash(rel)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// cmdLsRemoteBranches lists the origin branches available to new, from the
+// refs already fetched, and which of them a workspace has checked out.
+func cmdLsRemoteBranches(args []string) error {
+	usage := "Usage: workspace ls-remote-branches [--pattern <glob>]"
+	pattern := ""
+	for i := 0; i < len(args); i++ {
+		if value, n, err := parseValueFlag(args, i, "--pattern"); err != nil {
+			return usageError(err, usage)
+		} else if n > 0 {
+			pattern = value
+			i += n - 1
+		} else {
+			return usageError(fmt.Errorf("unexpected argument: %s", args[i]), usage)
+		}
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+	branches, err := remoteBranches(projectRoot)
+	if err != nil {
+		return fmt.Errorf("listing remote branches: %w", err)
+	}
+	worktrees, err := spaceWorktrees(projectRoot)
+	if err != nil {
+		return err
+	}
+	entries, err := matchRemoteBranches(projectRoot, branches, pattern, worktrees)
+	if err != nil {
+		return usageError(err, usage)
+	}
+
+	if len(entries) == 0 {
+		if pattern != "" {
+			fmt.Printf("No remote branches match %s.\n", pattern)
+		} else {
+			fmt.Println("No remote branches found. Run workspace fetch to update them.")
+		}
+		return nil
+	}
+
+	width := 0
+	for _, entry := range entries {
+		width = max(width, len("origin/"+entry.name))
+	}
+	for _, entry := range entries {
+		if entry.workspace != "" {
+			fmt.Printf("  %-*s  → %s\n", width, "origin/"+entry.name, entry.workspace)
+		} else {
+			fmt.Printf("  origin/%s\n", entry.name)
+		}
+	}
+	fmt.Println()
+	fmt.Println("Branch from one with: workspace new --base origin/<branch> <name>")
+	return nil
+}
+
+// snapshotRecord is one entry in db/snapshots.json.
+type snapshotRecord struct {
+	Name    string    `json:"name"`
+	Label   string    `json:"label,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+type snapshotArgs struct {
+	name  string
+	label string
+	list  bool
+}
+
+func parseSnapshotArgs(args []string) (snapshotArgs, error) {
+	var parsed snapshotArgs
+	var positional []string
+
+	for i := 0; i < len(args); i++ {
+		if value, n, err := parseValueFlag(args, i, "--label"); err != nil {
+			return snapshotArgs{}, err
+		} else if n > 0 {
+			parsed.label = value
+			i += n - 1
+		} else if args[i] == "--list" {
+			parsed.list = true
+		} else {
+			positional = append(positional, args[i])
+		}
+	}
+
+	if len(positional) > 1 {
+		return snapshotArgs{}, fmt.Errorf("expected at most 1 argument, got %d", len(positional))
+	}
+	if parsed.list && parsed.label != "" {
+		return snapshotArgs{}, fmt.Errorf("--label cannot be used with --list")
+	}
+	if len(positional) == 1 {
+		parsed.name = positional[0]
+	}
+	return parsed, nil
+}
+
+// snapshotsFile is the snapshot index of a project, in its db directory.
+const snapshotsFile = "snapshots.json"
+
+// loadSnapshots reads the snapshot index, keyed by workspace name. A missing
+// index is not an error.
+func loadSnapshots(projectRoot string) (map[string][]snapshotRecord, error) {
+	dumpDir, err := dbDir(projectRoot)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dumpDir, snapshotsFile)
+	snapshots := map[string][]snapshotRecord{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return snapshots, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	return snapshots, nil
+}
+
+func saveSnapshots(projectRoot string, snapshots map[string][]snapshotRecord) error {
+	data, err := json.MarshalIndent(snapshots, "", "  ")
+	if err != nil {
+		return err
+	}
+	dumpDir, err := dbDir(projectRoot)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dumpDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dumpDir, snapshotsFile), append(data, '\n'), 0644)
+}
+
+func cmdSnapshot(args []string) error {
+	parsed, err := parseSnapshotArgs(args)
+	if err != nil {
+		return usageError(err, "Usage: workspace snapshot [name] [--label <label>] [--list]")
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	targetPath, _, err := resolveWorktree(projectRoot, parsed.name)
+	if err != nil {
+		return err
+	}
+	wsName := filepath.Base(targetPath)
+
+	snapshots, err := loadSnapshots(projectRoot)
+	if err != nil {
+		return fmt.Errorf("reading snapshot index: %w", err)
+	}
+
+	if parsed.list {
+		records := snapshots[wsName]
+		if len(records) == 0 {
+			fmt.Printf("No snapshots recorded for %s.\n", wsName)
+			return nil
+		}
+		for _, rec := range records {
+			label := ""
+			if rec.Label != "" {
+				label = "  (" + rec.Label + ")"
+			}
+			fmt.Printf("  %-40s %s%s\n", rec.Name, rec.Created.Format("2006-01-02 15:04"), label)
+		}
+		return nil
+	}
+
+	if _, err := getDDEVProjectName(targetPath); err != nil {
+		return fmt.Errorf("no DDEV project found in %s", targetPath)
+	}
+
+	now := time.Now()
+	snapName := wsName + "_" + now.Format("20060102-150405")
+	if parsed.label != "" {
+		snapName = wsName + "_" + normalizeDDEVName(parsed.label)
+		// ddev snapshot would silently replace the earlier one
+		for _, rec := range snapshots[wsName] {
+			if rec.Name == snapName {
+				return withHints(fmt.Errorf("%s already has a snapshot %s (taken %s)", wsName, snapName, rec.Created.Format("2006-01-02 15:04")),
+					"Pick another --label, or restore it with: workspace restore "+wsName+" "+snapName)
+			}
+		}
+	}
+
+	fmt.Println("--- Taking DDEV snapshot ---")
+	if err := runCommandLive(ddevRoot(targetPath), ddevBin, "snapshot", "--name", snapName); err != nil {
+		return withKind(ErrDDEVFailed, fmt.Errorf("running ddev snapshot: %w", err))
+	}
+
+	snapshots[wsName] = append(snapshots[wsName], snapshotRecord{Name: snapName, Label: parsed.label, Created: now})
+	if err := saveSnapshots(projectRoot, snapshots); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: snapshot taken but not recorded: %v\n", err)
+	}
+
+	fmt.Printf("\nSnapshot %s taken for %s.\n", snapName, wsName)
+	return nil
+}
+
+func cmdRestore(args []string) error {
+	if len(args) > 2 {
+		return usageError(fmt.Errorf("expected at most 2 arguments, got %d", len(args)), "Usage: workspace restore [name] [snapshot]")
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	// A single argument is a workspace name if spaces/<arg> exists, otherwise
+	// a snapshot of the current workspace.
+	var name, snapName string
+	switch len(args) {
+	case 2:
+		name, snapName = args[0], args[1]
+	case 1:
+		if info, err := os.Stat(filepath.Join(projectRoot, "spaces", args[0])); err == nil && info.IsDir() {
+			name = args[0]
+		} else {
+			snapName = args[0]
+		}
+	}
+
+	targetPath, _, err := resolveWorktree(projectRoot, name)
+	if err != nil {
+		return err
+	}
+	wsName := filepath.Base(targetPath)
+
+	if snapName == "" {
+		snapshots, err := loadSnapshots(projectRoot)
+		if err != nil {
+			return fmt.Errorf("reading snapshot index: %w", err)
+		}
+		records := snapshots[wsName]
+		if len(records) == 0 {
+			return fmt.Errorf("no snapshots recorded for %s", wsName)
+		}
+		snapName = records[len(records)-1].Name
+	}
+
+	fmt.Println("--- Restoring DDEV snapshot ---")
+	if err := runCommandLive(ddevRoot(targetPath), ddevBin, "snapshot", "restore", snapName); err != nil {
+		return withKind(ErrDDEVFailed, fmt.Errorf("restoring snapshot: %w", err))
+	}
+
+	fmt.Printf("\nRestored snapshot %s into %s.\n", snapName, wsName)
+	return nil
+}
+
+func cmdWhich(args []string) error {
+	asJSON := false
+	for _, arg := range args {
+		if arg == "--json" {
+			asJSON = true
+		} else {
+			return usageError(fmt.Errorf("unexpected argument: %s", arg), "Usage: workspace which [--json]")
+		}
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("getting current directory: %w", err)
+	}
+	cwd = resolveSymlinks(cwd)
+
+	worktrees, err := spaceWorktrees(projectRoot)
+	if err != nil {
+		return err
+	}
+
+	entry, ok := findContainingWorktree(worktrees, cwd)
+	if !ok {
+		return fmt.Errorf("%s is not inside a workspace under %s", cwd, filepath.Join(projectRoot, "spaces"))
+	}
+
+	name := filepath.Base(entry.path)
+	if asJSON {
+		out, _ := json.MarshalIndent(map[string]string{
+			"name":         name,
+			"branch":       entry.branch,
+			"path":         entry.path,
+			"project_root": projectRoot,
+		}, "", "  ")
+		fmt.Println(string(out))
+		return nil
+	}
+
+	fmt.Println(name)
+	if entry.branch != "" {
+		fmt.Println(entry.branch)
+	} else {
+		fmt.Println("(detached)")
+	}
+	fmt.Println(projectRoot)
+	return nil
+}
+
+// findWorktreeByBranch returns the worktree that has branch checked out.
+func findWorktreeByBranch(entries []worktreeEntry, branch string) (worktreeEntry, bool) {
+	for _, entry := range entries {
+		if !entry.isBare && branch != "" && entry.branch == branch {
+			return entry, true
+		}
+	}
+	return worktreeEntry{}, false
+}
+
+// findContainingWorktree returns the worktree whose directory is dir or an
+// ancestor of dir, preferring the deepest match.
+func findContainingWorktree(worktrees []worktreeEntry, dir string) (worktreeEntry, bool) {
+	var best worktreeEntry
+	found := false
+	for _, wt := range worktrees {
+		if dir == wt.path || strings.HasPrefix(dir, wt.path+string(filepath.Separator)) {
+			if !found || len(wt.path) > len(best.path) {
+				best = wt
+				found = true
+			}
+		}
+	}
+	return best, found
+}
+
+// dockerDiskUsage returns the size in bytes of each type reported by
+// `docker system df` (Images, Containers, Local Volumes, Build Cache).
+func dockerDiskUsage() (map[string]int64, error) {
+	out, err := exec.Command(dockerBin, "system", "df", "--format", "{{.Type}}\t{{.Size}}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker system df failed: %w", err)
+	}
+	return parseDockerDiskUsage(string(out))
+}
+
+// parseDockerDiskUsage parses "<type>\t<size>" lines from docker system df.
+func parseDockerDiskUsage(out string) (map[string]int64, error) {
+	usage := make(map[string]int64)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		kind, size, ok := strings.Cut(line, "\t")
+		if !ok {
+			return nil, fmt.Errorf("unexpected docker system df line %q", line)
+		}
+		n, err := parseDockerSize(size)
+		if err != nil {
+			return nil, err
+		}
+		usage[kind] = n
+	}
+	return usage, nil
+}
+
+// parseDockerSize parses sizes as Docker prints them ("0B", "12.3kB",
+// "1.2GB"), which use decimal units.
+func parseDockerSize(value string) (int64, error) {
+	s := strings.TrimSpace(value)
+	multiplier := 1.0
+	for i, unit := range []string{"kB", "MB", "GB", "TB"} {
+		if strings.HasSuffix(s, unit) {
+			multiplier = math.Pow(1000, float64(i+1))
+			s = strings.TrimSuffix(s, unit)
+			break
+		}
+	}
+	s = strings.TrimSuffix(s, "B")
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid docker size %q", value)
+	}
+	return int64(n * multiplier), nil
+}
+
+// cmdPruneDocker reclaims Docker disk space shared by all workspaces. By
+// default it removes the build cache and dangling images; --all removes all
+// unused images and cache, and --volumes also removes unused volumes, which
+// include the databases of DDEV projects that were stopped or deleted.
+func cmdPruneDocker(args []string) error {
+	all, volumes, yes := false, false, false
+	for _, arg := range args {
+		switch arg {
+		case "--all", "-a":
+			all = true
+		case "--volumes":
+			volumes = true
+		case "--yes", "-y":
+			yes = true
+		default:
+			return usageError(fmt.Errorf("unknown argument: %s", arg), "Usage: workspace prune-docker [--all] [--volumes] [--yes]")
+		}
+	}
+
+	if volumes {
+		fmt.Println("--volumes deletes every Docker volume no container uses, including the databases of stopped DDEV projects.")
+		ok, err := confirmUnlessYes("Continue? (y/N) ", yes)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+
+	before, err := dockerDiskUsage()
+	if err != nil {
+		return err
+	}
+
+	type pruneStep struct {
+		description string
+		args        []string
+	}
+	prunes := []pruneStep{{"Build cache", []string{"builder", "prune", "-f"}}, {"Dangling images", []string{"image", "prune", "-f"}}}
+	if all {
+		prunes = []pruneStep{{"Build cache", []string{"builder", "prune", "-af"}}, {"Unused images", []string{"image", "prune", "-af"}}}
+	}
+	if volumes {
+		prunes = append(prunes, pruneStep{"Volumes", []string{"volume", "prune", "-af"}})
+	}
+
+	var steps []StepResult
+	failed := false
+	for _, prune := range prunes {
+		fmt.Printf("--- Pruning %s ---\n", strings.ToLower(prune.description))
+		if err := runCommandLive("", dockerBin, prune.args...); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: docker %s failed: %v\n", strings.Join(prune.args, " "), err)
+			steps = append(steps, StepResult{Description: prune.description, Detail: fmt.Sprintf("Failed: %v", err)})
+			failed = true
+			continue
+		}
+		steps = append(steps, StepResult{Description: prune.description, Detail: "Pruned"})
+	}
+
+	if after, err := dockerDiskUsage(); err == nil {
+		var reclaimed int64
+		for kind, size := range before {
+			reclaimed += size - after[kind]
+		}
+		if reclaimed < 0 {
+			reclaimed = 0
+		}
+		steps = append(steps, StepResult{Description: "Reclaimed", Detail: formatBytes(reclaimed)})
+	}
+
+	fmt.Println()
+	renderSummary("Docker Prune", steps)
+	if failed {
+		return fmt.Errorf("some prune commands failed")
+	}
+	return nil
+}
+
+func cmdStopAll(args []string) error {
+	if len(args) > 0 {
+		return usageError(fmt.Errorf("unexpected argument: %s", args[0]), "Usage: workspace stop-all")
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	workspaces, err := collectWorkspaces(projectRoot)
+	if err != nil {
+		return fmt.Errorf("listing worktrees: %w", err)
+	}
+
+	var steps []StepResult
+	failed := false
+	for _, ws := range workspaces {
+		ddevName, err := getDDEVProjectName(ws.path)
+		if err != nil {
+			continue
+		}
+		if ws.frozen {
+			steps = append(steps, StepResult{Description: ws.name, Detail: "Frozen, skipped"})
+			continue
+		}
+		if desc, err := ddevDescribe(ws.path); err == nil && desc.Status != "running" {
+			steps = append(steps, StepResult{
+				Description: ws.name,
+				Detail:      "Not running (" + ddevName + ")",
+			})
+			continue
+		}
+
+		fmt.Printf("\n--- Stopping DDEV (%s) ---\n", ws.name)
+		if err := runCommandLive(ddevRoot(ws.path), ddevBin, "stop"); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to stop DDEV for %s: %v\n", ws.name, err)
+			steps = append(steps, StepResult{
+				Description: ws.name,
+				Detail:      fmt.Sprintf("Failed to stop: %v", err),
+			})
+			failed = true
+			continue
+		}
+		steps = append(steps, StepResult{
+			Description: ws.name,
+			Detail:      "Stopped (" + ddevName + ")",
+		})
+	}
+
+	printBulkSummary("Stop All", steps)
+	if failed {
+		return withKind(ErrDDEVFailed, fmt.Errorf("some DDEV projects could not be stopped"))
+	}
+	return nil
+}
+
+type startAllArgs struct {
+	onlyRecent int
+}
+
+// parseStartAllArgs parses the arguments for the "start-all" subcommand.
+func parseStartAllArgs(args []string) (startAllArgs, error) {
+	var parsed startAllArgs
+
+	for i := 0; i < len(args); i++ {
+		if value, n, err := parseValueFlag(args, i, "--only-recent"); err != nil {
+			return startAllArgs{}, err
+		} else if n > 0 {
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return startAllArgs{}, fmt.Errorf("--only-recent must be a positive number, got %q", value)
+			}
+			parsed.onlyRecent = count
+			i += n - 1
+		} else {
+			return startAllArgs{}, fmt.Errorf("unexpected argument: %s", args[i])
+		}
+	}
+	return parsed, nil
+}
+
+func cmdStartAll(args []string) error {
+	parsed, err := parseStartAllArgs(args)
+	if err != nil {
+		return usageError(err, "Usage: workspace start-all [--only-recent N]")
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	workspaces, err := collectWorkspaces(projectRoot)
+	if err != nil {
+		return fmt.Errorf("listing worktrees: %w", err)
+	}
+
+	// Only workspaces with DDEV, most recently modified first
+	var candidates []workspace
+	for _, ws := range workspaces {
+		if _, err := getDDEVProjectName(ws.path); err == nil {
+			candidates = append(candidates, ws)
+		}
+	}
+	sortWorkspaces(candidates, "mtime", false)
+	if parsed.onlyRecent > 0 && len(candidates) > parsed.onlyRecent {
+		candidates = candidates[:parsed.onlyRecent]
+	}
+
+	var steps []StepResult
+	failed := false
+	for _, ws := range candidates {
+		ddevName, _ := getDDEVProjectName(ws.path)
+		if ws.frozen {
+			steps = append(steps, StepResult{Description: ws.name, Detail: "Frozen, skipped"})
+			continue
+		}
+		if desc, err := ddevDescribe(ws.path); err == nil && desc.Status == "running" {
+			steps = append(steps, StepResult{
+				Description: ws.name,
+				Detail:      "Already running (" + ddevName + ")",
+			})
+			continue
+		}
+
+		fmt.Printf("\n--- Starting DDEV (%s) ---\n", ws.name)
+		if err := runDDEVLocked(ddevRoot(ws.path), nil, "start"); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to start DDEV for %s: %v\n", ws.name, err)
+			steps = append(steps, StepResult{
+				Description: ws.name,
+				Detail:      fmt.Sprintf("Failed to start: %v", err),
+			})
+			failed = true
+			continue
+		}
+		steps = append(steps, StepResult{
+			Description: ws.name,
+			Detail:      "Started (" + ddevName + ")",
+		})
+	}
+
+	printBulkSummary("Start All", steps)
+	if failed {
+		return withKind(ErrDDEVFailed, fmt.Errorf("some DDEV projects could not be started"))
+	}
+	return nil
+}
+
+// printBulkSummary prints the per-workspace results of a bulk DDEV command.
+func printBulkSummary(operation string, steps []StepResult) {
+	fmt.Println()
+	if len(steps) == 0 {
+		fmt.Println("No DDEV workspaces found.")
+		return
+	}
+	renderSummary(operation, steps)
+}
+
+type pruneArgs struct {
+	olderThan    time.Duration
+	merged       bool
+	danglingDDEV bool
+	dryRun       bool
+	yes          bool
+}
+
+// parsePruneArgs parses the arguments for the "prune" subcommand.
+func parsePruneArgs(args []string) (pruneArgs, error) {
+	var parsed pruneArgs
+
+	for i := 0; i < len(args); i++ {
+		if value, n, err := parseValueFlag(args, i, "--older-than"); err != nil {
+			return pruneArgs{}, err
+		} else if n > 0 {
+			age, err := parseAge(value)
+			if err != nil {
+				return pruneArgs{}, err
+			}
+			parsed.olderThan = age
+			i += n - 1
+		} else if args[i] == "--merged" {
+			parsed.merged = true
+		} else if args[i] == "--dangling-ddev" {
+			parsed.danglingDDEV = true
+		} else if args[i] == "--dry-run" {
+			parsed.dryRun = true
+		} else if args[i] == "--yes" || args[i] == "-y" {
+			parsed.yes = true
+		} else {
+			return pruneArgs{}, fmt.Errorf("unexpected argument: %s", args[i])
+		}
+	}
+
+	if parsed.danglingDDEV {
+		if parsed.olderThan > 0 || parsed.merged {
+			return pruneArgs{}, fmt.Errorf("--dangling-ddev prunes DDEV projects, not workspaces, and cannot be combined with --older-than or --merged")
+		}
+		return parsed, nil
+	}
+	if parsed.olderThan == 0 && !parsed.merged {
+		return pruneArgs{}, fmt.Errorf("at least one of --older-than, --merged, or --dangling-ddev is required")
+	}
+	return parsed, nil
+}
+
+func cmdPrune(args []string) error {
+	parsed, err := parsePruneArgs(args)
+	if err != nil {
+		return usageError(err, "Usage: workspace prune [--older-than <age>] [--merged] [--dry-run] [--yes]", "       workspace prune --dangling-ddev [--dry-run] [--yes]")
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+	if parsed.danglingDDEV {
+		return pruneDanglingDDEV(projectRoot, parsed)
+	}
+
+	workspaces, err := collectWorkspaces(projectRoot)
+	if err != nil {
+		return fmt.Errorf("listing worktrees: %w", err)
+	}
+
+	// Never prune the long-lived default branch worktrees, nor the ones
+	// frozen to be kept
+	var candidates []workspace
+	var frozen []string
+	for _, ws := range workspaces {
+		if ws.frozen {
+			frozen = append(frozen, ws.name)
+		} else if ws.branch != "develop" && ws.branch != "main" && ws.branch != "master" {
+			candidates = append(candidates, ws)
+		}
+	}
+	if len(frozen) > 0 {
+		fmt.Printf("Skipping frozen workspaces: %s\n", strings.Join(frozen, ", "))
+	}
+
+	if parsed.olderThan > 0 {
+		candidates = filterOlderThan(candidates, parsed.olderThan, time.Now())
+	}
+
+	if parsed.merged {
+		base := defaultBaseRef(projectRoot)
+		if base == "" {
+			return fmt.Errorf("could not determine the base branch for --merged")
+		}
+		var merged []workspace
+		for _, ws := range candidates {
+			if ws.branch != "" && branchMerged(projectRoot, ws.branch, base) {
+				merged = append(merged, ws)
+			}
+		}
+		candidates = merged
+	}
+
+	// Uncommitted work is never pruned
+	var clean []workspace
+	var dirty []string
+	for _, ws := range candidates {
+		if worktreeDirty(ws.path) {
+			dirty = append(dirty, ws.name)
+		} else {
+			clean = append(clean, ws)
+		}
+	}
+	candidates = clean
+	if len(dirty) > 0 {
+		fmt.Printf("Skipping workspaces with uncommitted changes: %s\n", strings.Join(dirty, ", "))
+	}
+
+	if len(candidates) == 0 {
+		fmt.Println("No workspaces to prune.")
+		return nil
+	}
+
+	fmt.Println("Workspaces to prune:")
+	for _, ws := range candidates {
+		fmt.Printf("  %-25s last modified %s\n", ws.name, ws.modTime.Format("2006-01-02"))
+	}
+
+	if parsed.dryRun {
+		fmt.Println("\nDry run: nothing was removed.")
+		return nil
+	}
+
+	ok, err := confirmUnlessYes("\nRemove these workspaces? (y/N) ", parsed.yes)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("Aborted.")
+		return nil
+	}
+
+	var steps []StepResult
+	failed := false
+	for _, ws := range candidates {
+		if _, ok := removeWorkspace(projectRoot, ws.path, ws.branch, false); !ok {
+			failed = true
+			steps = append(steps, StepResult{Description: ws.name, Detail: "Failed to remove"})
+			continue
+		}
+		steps = append(steps, StepResult{Description: ws.name, Detail: "Removed"})
+	}
+
+	printBulkSummary("Prune", steps)
+	if failed {
+		return fmt.Errorf("some workspaces could not be removed")
+	}
+	return nil
+}
+
+// danglingProject is a DDEV project left registered for a worktree that is
+// gone, with why it is considered orphaned.
+type danglingProject struct {
+	name    string
+	appRoot string
+	reason  string
+}
+
+// danglingDDEVProjects picks the registered DDEV projects that no worktree
+// of the project owns: those registered inside the project whose directory
+// is gone, isn't in a worktree, or now configures another name, and those
+// elsewhere that are named like the project's workspaces (baseName with an
+// identifier) and whose directory is gone.
+func danglingDDEVProjects(projectRoot string, projects []ddevListEntry, worktrees []worktreeEntry, locations map[string]string, baseName string) []danglingProject {
+	var dangling []danglingProject
+	for _, project := range projects {
+		inProject := pathWithin(projectRoot, project.AppRoot)
+		for _, location := range locations {
+			inProject = inProject || pathWithin(location, project.AppRoot)
+		}
+		_, statErr := os.Stat(project.AppRoot)
+
+		if !inProject {
+			namedLikeOurs := baseName != "" && (strings.HasPrefix(project.Name, baseName+"-") || strings.HasSuffix(project.Name, "-"+baseName))
+			if namedLikeOurs && os.IsNotExist(statErr) {
+				dangling = append(dangling, danglingProject{project.Name, project.AppRoot, "named like this project's workspaces, directory is gone"})
+			}
+			continue
+		}
+		if os.IsNotExist(statErr) {
+			dangling = append(dangling, danglingProject{project.Name, project.AppRoot, "directory is gone"})
+			continue
+		}
+
+		var owner *worktreeEntry
+		for i := range worktrees {
+			if pathWithin(worktrees[i].path, project.AppRoot) {
+				owner = &worktrees[i]
+				break
+			}
+		}
+		if owner == nil {
+			dangling = append(dangling, danglingProject{project.Name, project.AppRoot, "not inside a worktree"})
+			continue
+		}
+		if name, err := getDDEVProjectName(project.AppRoot); err != nil {
+			dangling = append(dangling, danglingProject{project.Name, project.AppRoot, "no DDEV config there any more"})
+		} else if name != project.Name {
+			dangling = append(dangling, danglingProject{project.Name, project.AppRoot, "the worktree's DDEV config is now named " + name})
+		}
+	}
+	return dangling
+}
+
+// pruneDanglingDDEV deletes the DDEV projects still registered for
+// worktrees removed outside the tool.
+func pruneDanglingDDEV(projectRoot string, parsed pruneArgs) error {
+	projects, err := ddevListProjects()
+	if err != nil {
+		return withKind(ErrDDEVFailed, fmt.Errorf("listing DDEV projects: %w", err))
+	}
+	worktrees, err := spaceWorktrees(projectRoot)
+	if err != nil {
+		return err
+	}
+	locations, err := loadWorktreeLocations(projectRoot)
+	if err != nil {
+		return err
+	}
+	// The name in a worktree's shared config.yaml is the one identifiers
+	// are added to; config.local.yaml holds the workspace's own.
+	baseName := ""
+	for _, wt := range worktrees {
+		if name, err := readDDEVName(filepath.Join(ddevRoot(wt.path), ".ddev", "config.yaml")); err == nil {
+			baseName = name
+			break
+		}
+	}
+
+	dangling := danglingDDEVProjects(projectRoot, projects, worktrees, locations, baseName)
+	if len(dangling) == 0 {
+		fmt.Println("No dangling DDEV projects.")
+		return nil
+	}
+
+	width := 0
+	for _, project := range dangling {
+		width = max(width, len(project.name))
+	}
+	fmt.Println("DDEV projects without a worktree:")
+	for _, project := range dangling {
+		fmt.Printf("  %-*s  %s (%s)\n", width, project.name, project.appRoot, project.reason)
+	}
+
+	if parsed.dryRun {
+		fmt.Println("\nDry run: nothing was deleted.")
+		return nil
+	}
+
+	ok, err := confirmUnlessYes("\nDelete these DDEV projects? (y/N) ", parsed.yes)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("Aborted.")
+		return nil
+	}
+
+	var steps []StepResult
+	failed := false
+	for _, project := range dangling {
+		// By name, since the directory may be gone
+		if err := runPhase("Deleting DDEV project "+project.name, func() error {
+			return runDDEVLocked(projectRoot, nil, "delete", "--omit-snapshot", "-y", project.name)
+		}); err != nil {
+			failed = true
+			steps = append(steps, StepResult{Description: project.name, Detail: fmt.Sprintf("Failed to delete: %v", err)})
+			continue
+		}
+		steps = append(steps, StepResult{Description: project.name, Detail: "Deleted"})
+	}
+
+	printBulkSummary("Prune DDEV", steps)
+	if failed {
+		return withKind(ErrDDEVFailed, fmt.Errorf("some DDEV projects could not be deleted"))
+	}
+	return nil
+}
+
+// branchMerged reports whether branch is fully merged into base: it has
+// commits of its own since the fork point recorded when new created it, and
+// all of them are reachable from base. A branch with no commits of its own
+// is an unused workspace, not a finished one, and one whose fork point is
+// unknown is never considered merged.
+func branchMerged(projectRoot, branch, base string) bool {
+	fork, err := gitOutput(projectRoot, "config", "--get", forkPointKey(branch))
+	if err != nil || fork == "" {
+		return false
+	}
+	count, err := gitOutput(projectRoot, "rev-list", "--count", fork+"..refs/heads/"+branch)
+	if err != nil || count == "0" {
+		return false
+	}
+	cmd := exec.Command(gitBin, "merge-base", "--is-ancestor", "refs/heads/"+branch, base)
+	cmd.Dir = projectRoot
+	return cmd.Run() == nil
+}
+
+// worktreeDirty reports whether the worktree at path has uncommitted
+// changes or untracked files, or its status can't be read.
+func worktreeDirty(path string) bool {
+	status, err := gitOutput(path, "status", "--porcelain")
+	return err != nil || status != ""
+}
+
+// findDDEVProjectName reads the DDEV project name from the main/master
+// worktree, which always has the original (un-prefixed) name.
+// detectProjectType reads the DDEV project type from the first existing worktree.
+func detectProjectType(projectRoot string) ProjectType {
+	spacesDir := filepath.Join(projectRoot, "spaces")
+
+	entries, err := os.ReadDir(spacesDir)
+	if err != nil {
+		return ProjectUnsupported
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			return getDDEVProjectType(filepath.Join(spacesDir, entry.Name()))
+		}
+	}
+
+	return ProjectUnsupported
+}
+
+// removeTarget is a workspace selected for removal. Stray targets are
+// directories under spaces/ that aren't registered worktrees.
+type removeTarget struct {
+	path   string
+	branch string
+	stray  bool
+}
+
+// safeToRemove reports whether removing targets loses nothing: each is a
+// worktree with no uncommitted changes whose branch is merged into the base
+// branch or has no commits missing from its upstream.
+func safeToRemove(projectRoot string, targets []removeTarget) bool {
+	base := defaultBaseRef(projectRoot)
+	for _, target := range targets {
+		if target.stray || target.branch == "" {
+			return false
+		}
+		if worktreeDirty(target.path) {
+			return false
+		}
+		if base != "" && branchMerged(projectRoot, target.branch, base) {
+			continue
+		}
+		out, err := gitOutput(target.path, "rev-list", "--left-right", "--count", "HEAD...@{u}")
+		if err != nil {
+			return false
+		}
+		if ahead, _, err := parseAheadBehind(out); err != nil || ahead > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// pickWorktree lists worktrees as a numbered menu on w and reads the
+// user's choice from r. An empty answer or EOF cancels (ok is false).
+func pickWorktree(r io.Reader, w io.Writer, worktrees []worktreeEntry) (picked worktreeEntry, ok bool, err error) {
+	if len(worktrees) == 0 {
+		return worktreeEntry{}, false, fmt.Errorf("no workspaces found under spaces/")
+	}
+	fmt.Fprintln(w, "Workspaces:")
+	for i, wt := range worktrees {
+		fmt.Fprintf(w, "  %2d) %-25s %s\n", i+1, filepath.Base(wt.path), wt.branch)
+	}
+	fmt.Fprintf(w, "\nRemove which workspace? [1-%d, Enter to cancel]: ", len(worktrees))
+
+	line, readErr := bufio.NewReader(r).ReadString('\n')
+	answer := strings.TrimSpace(line)
+	if answer == "" {
+		if readErr != nil {
+			fmt.Fprintln(w)
+		}
+		return worktreeEntry{}, false, nil
+	}
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(worktrees) {
+		return worktreeEntry{}, false, fmt.Errorf("invalid choice %q (expected a number from 1 to %d)", answer, len(worktrees))
+	}
+	return worktrees[n-1], true, nil
+}
+
+func cmdRemove(args []string) error {
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	force := false
+	yes := false
+	progressJSON := ""
+	for i := 0; i < len(args); i++ {
+		if value, n, err := parseValueFlag(args, i, "--progress-json"); err != nil {
+			return usageError(err, "Usage: workspace remove [--force] [--yes] [--progress-json <path>] [name...]")
+		} else if n > 0 {
+			progressJSON = value
+			i += n - 1
+		} else if args[i] == "--force" {
+			force = true
+		} else if args[i] == "--yes" || args[i] == "-y" {
+			yes = true
+		} else {
+			names = append(names, args[i])
+		}
+	}
+	stopProgress, err := startProgress("remove", progressJSON, nil)
+	if err != nil {
+		return err
+	}
+	defer stopProgress()
+	if len(names) == 0 {
+		// No names: remove the worktree at the current directory, or let
+		// the user pick one when run from outside a worktree
+		names = []string{""}
+		if _, _, err := resolveWorktree(projectRoot, ""); err != nil && stdinIsTerminal() {
+			worktrees, err := spaceWorktrees(projectRoot)
+			if err != nil {
+				return err
+			}
+			picked, ok, err := pickWorktree(os.Stdin, os.Stdout, worktrees)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				fmt.Println("Aborted.")
+				return nil
+			}
+			names = []string{filepath.Base(picked.path)}
+		}
+	}
+
+	strays, _ := strayDirs(projectRoot)
+
+	// Resolve and validate every target before touching anything
+	var targets []removeTarget
+	for _, name := range names {
+		// A directory under spaces/ that git doesn't know about can't go
+		// through the worktree teardown; it can only be deleted with --force.
+		if name != "" && containsString(strays, name) {
+			path := filepath.Join(projectRoot, "spaces", name)
+			if !force {
+				return withHints(fmt.Errorf("%s is not a git worktree (stray directory under spaces/)", path), "Re-run with --force to delete the directory.")
+			}
+			targets = append(targets, removeTarget{path: path, stray: true})
+			continue
+		}
+
+		targetPath, branchName, err := resolveWorktree(projectRoot, name)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, removeTarget{path: targetPath, branch: branchName})
+	}
+
+	config, err := loadConfig(projectRoot)
+	if err != nil {
+		return err
+	}
+	switch config.Confirm {
+	case confirmNever:
+		yes = true
+	case confirmDirtyOnly:
+		if !yes && safeToRemove(projectRoot, targets) {
+			fmt.Println("Nothing unsaved (clean, merged or pushed); skipping confirmation (confirm: dirty-only).")
+			yes = true
+		}
+	}
+
+	// Confirmation prompt
+	fmt.Println("The following will be destroyed:")
+	for _, target := range targets {
+		fmt.Println()
+		if target.stray {
+			fmt.Printf("  Directory: %s (not a worktree)\n", target.path)
+			continue
+		}
+		if _, err := os.Stat(target.path); os.IsNotExist(err) {
+			fmt.Printf("  Worktree:  %s (directory already deleted)\n", target.path)
+		} else {
+			fmt.Printf("  Worktree:  %s\n", target.path)
+		}
+		if target.branch != "" {
+			fmt.Printf("  Branch:    %s\n", target.branch)
+		} else {
+			fmt.Printf("  Branch:    (detached HEAD, none to delete)\n")
+		}
+		fmt.Printf("  DDEV project in that worktree (if any)\n")
+	}
+
+	ok, err := confirmUnlessYes("\nAre you sure? (y/N) ", yes)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("Aborted.")
+		return nil
+	}
+
+	// Tear down each target; a failure on one doesn't stop the others
+	results := make([][]StepResult, len(targets))
+	failed := false
+	for i, target := range targets {
+		var ok bool
+		if target.stray {
+			results[i], ok = removeStrayDir(target.path)
+		} else {
+			results[i], ok = removeWorkspace(projectRoot, target.path, target.branch, true)
+		}
+		if !ok {
+			failed = true
+		}
+	}
+
+	// Summary, grouped per workspace
+	var steps []StepResult
+	if len(targets) == 1 {
+		steps = results[0]
+	} else {
+		for i, target := range targets {
+			steps = append(steps, StepResult{Description: filepath.Base(target.path), Steps: results[i]})
+		}
+	}
+	fmt.Println()
+	renderSummary("Workspace Removal", steps)
+
+	if failed {
+		return fmt.Errorf("some workspaces could not be removed")
+	}
+	return nil
+}
+
+// ddevProjectAt returns the name of the DDEV project registered with its
+// app root at or below dir, for when the directory (and its config) is gone.
+func ddevProjectAt(dir string) (string, bool) {
+	projects, err := ddevListProjects()
+	if err != nil {
+		return "", false
+	}
+	for _, project := range projects {
+		if pathWithin(dir, project.AppRoot) {
+			return project.Name, true
+		}
+	}
+	return "", false
+}
+
+// ddevListEntry is one project from `ddev list -j`.
+type ddevListEntry struct {
+	Name    string `json:"name"`
+	AppRoot string `json:"approot"`
+}
+
+// ddevListProjects returns the projects DDEV has registered on the machine.
+func ddevListProjects() ([]ddevListEntry, error) {
+	out, err := exec.Command(ddevBin, "list", "-j").Output()
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Raw []ddevListEntry `json:"raw"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, err
+	}
+	return list.Raw, nil
+}
+
+// removeMissingWorktree reconciles a worktree whose directory was deleted
+// outside the tool: the DDEV project still registered for it is deleted by
+// name and git's stale entry is pruned (unlocking it first, since prune
+// skips locked entries).
+func removeMissingWorktree(projectRoot, targetPath string) []StepResult {
+	var steps []StepResult
+	if ddevName, ok := ddevProjectAt(targetPath); ok {
+		ddevCmd := exec.Command(ddevBin, "delete", "--omit-snapshot", "-y", ddevName)
+		ddevCmd.Dir = projectRoot
+		ddevCmd.Stdout = os.Stdout
+		ddevCmd.Stderr = os.Stderr
+		if err := runPhase("Deleting DDEV project", func() error { return withDDEVLock(ddevCmd.Run) }); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to delete DDEV project: %v\n", err)
+			steps = append(steps, StepResult{
+				Description: "DDEV project",
+				Detail:      fmt.Sprintf("Failed to delete: %v", err),
+			})
+		} else {
+			steps = append(steps, StepResult{
+				Description: "DDEV project",
+				Detail:      "Deleted (" + ddevName + ")",
+			})
+		}
+	} else {
+		steps = append(steps, StepResult{
+			Description: "DDEV project",
+			Detail:      "Skipped (none registered for the missing directory)",
+		})
+	}
+
+	if err := runPhase("Pruning stale worktree entry", func() error {
+		_, _ = gitOutput(projectRoot, "worktree", "unlock", targetPath)
+		_, err := gitOutput(projectRoot, "worktree", "prune")
+		return err
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: git worktree prune failed: %v\n", err)
+	}
+	return append(steps, StepResult{
+		Description: "Git worktree",
+		Detail:      "Reconciled stale worktree entry (directory was already gone)",
+	})
+}
+
+// removeWorkspace deletes a worktree's DDEV project, the worktree itself, and
+// its branch, or reconciles it when its directory is already gone. It reports
+// false if the worktree could not be removed.
+func removeWorkspace(projectRoot, targetPath, branchName string, force bool) ([]StepResult, bool) {
+	var steps []StepResult
+
+	if _, err := os.Stat(targetPath); os.IsNotExist(err) {
+		steps = removeMissingWorktree(projectRoot, targetPath)
+		forgetWorkspace(projectRoot, targetPath)
+		return append(steps, deleteBranch(projectRoot, branchName)), true
+	}
+
+	// Step 1: Delete DDEV (if present)
+	ddevName, ddevErr := getDDEVProjectName(targetPath)
+	if ddevErr == nil {
+		// Pass the project name explicitly so DDEV can clean up its
+		// global registration even if the directory disappears later.
+		ddevCmd := exec.Command(ddevBin, "delete", "--omit-snapshot", "-y", ddevName)
+		ddevCmd.Dir = targetPath
+		ddevCmd.Stdout = os.Stdout
+		ddevCmd.Stderr = os.Stderr
+		if err := runPhase("Deleting DDEV project", func() error { return withDDEVLock(ddevCmd.Run) }); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to delete DDEV project: %v\n", err)
+			steps = append(steps, StepResult{
+				Description: "DDEV project",
+				Detail:      fmt.Sprintf("Failed to delete: %v", err),
+			})
+		} else {
+			steps = append(steps, StepResult{
+				Description: "DDEV project",
+				Detail:      "Deleted (" + ddevName + ")",
+			})
+		}
+	} else {
+		steps = append(steps, StepResult{
+			Description: "DDEV project",
+			Detail:      "Skipped (no .ddev/config.yaml)",
+		})
+	}
+
+	// Step 2: Remove git worktree (run from the project root). Without
+	// force, git refuses a worktree with changes.
+	wtArgs := []string{"worktree", "remove", targetPath}
+	if force {
+		wtArgs = []string{"worktree", "remove", "--force", targetPath}
+	}
+	wtCmd := exec.Command(gitBin, wtArgs...)
+	wtCmd.Dir = projectRoot
+	wtCmd.Stdout = os.Stdout
+	wtCmd.Stderr = os.Stderr
+	if err := runPhase("Removing git worktree", wtCmd.Run); err != nil {
+		fmt.Fprintf(os.Stderr, "Error removing worktree: %v\n", err)
+		steps = append(steps, StepResult{
+			Description: "Git worktree",
+			Detail:      fmt.Sprintf("Failed to remove: %v", err),
+		})
+		return steps, false
+	}
+	steps = append(steps, StepResult{
+		Description: "Git worktree",
+		Detail:      "Removed " + targetPath,
+	})
+	forgetWorkspace(projectRoot, targetPath)
+
+	// Step 3: Delete the branch
+	return append(steps, deleteBranch(projectRoot, branchName)), true
+}
+
+func deleteBranch(projectRoot, branchName string) StepResult {
+	if branchName == "" {
+		return StepResult{Description: "Branch", Detail: "None (detached HEAD)"}
+	}
+	branchCmd := exec.Command(gitBin, "branch", "-D", branchName)
+	branchCmd.Dir = projectRoot
+	branchCmd.Stdout = os.Stdout
+	branchCmd.Stderr = os.Stderr
+	if err := runPhase("Deleting branch", branchCmd.Run); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to delete branch %s: %v\n", branchName, err)
+		return StepResult{
+			Description: "Branch",
+			Detail:      fmt.Sprintf("Failed to delete %s: %v", branchName, err),
+		}
+	}
+	return StepResult{
+		Description: "Branch",
+		Detail:      "Deleted " + branchName,
+	}
+}
+
+// removeStrayDir deletes a non-worktree directory under spaces/.
+func removeStrayDir(path string) ([]StepResult, bool) {
+	if err := runPhase("Removing stray directory", func() error { return os.RemoveAll(path) }); err != nil {
+		fmt.Fprintf(os.Stderr, "Error removing directory: %v\n", err)
+		return []StepResult{{
+			Description: "Stray directory",
+			Detail:      fmt.Sprintf("Failed to remove: %v", err),
+		}}, false
+	}
+	return []StepResult{{
+		Description: "Stray directory",
+		Detail:      "Removed " + path,
+	}}, true
+}
+
+// confirm prints prompt and reports whether the user answered "y" or "Y".
+func confirm(prompt string) (bool, error) {
+	fmt.Print(prompt)
+	return readConfirmation(os.Stdin)
+}
+
+// readConfirmation reads a y/N answer from r. EOF counts as the answer read
+// so far, so closed or empty input declines rather than failing.
+func readConfirmation(r io.Reader) (bool, error) {
+	input, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	input = strings.TrimSpace(input)
+	return input == "y" || input == "Y", nil
+}
+
+// confirmUnlessYes asks prompt unless yes is set. Without a terminal on
+// stdin nobody can answer, so --yes is required instead.
+func confirmUnlessYes(prompt string, yes bool) (bool, error) {
+	if yes {
+		return true, nil
+	}
+	if !stdinIsTerminal() {
+		return false, fmt.Errorf("stdin is not a terminal; pass --yes to confirm")
+	}
+	return confirm(prompt)
+}
+
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// strayDirs returns the names of directories under spaces/ that are not
+// registered git worktrees (e.g. leftovers from a failed run).
+func strayDirs(projectRoot string) ([]string, error) {
+	worktrees, err := spaceWorktrees(projectRoot)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, wt := range worktrees {
+		names = append(names, filepath.Base(wt.path))
+	}
+	return findStrayDirs(filepath.Join(projectRoot, "spaces"), names)
+}
+
+// findStrayDirs returns the directories in spacesDir whose names are not in
+// worktreeNames.
+func findStrayDirs(spacesDir string, worktreeNames []string) ([]string, error) {
+	entries, err := os.ReadDir(spacesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var strays []string
+	for _, entry := range entries {
+		if entry.IsDir() && !containsString(worktreeNames, entry.Name()) {
+			strays = append(strays, entry.Name())
+		}
+	}
+	return strays, nil
+}
+
+// resolveWorktree resolves a workspace name to its absolute worktree path
+// under spaces/ (or the current directory when name is empty), validates
+// that it is a git worktree, and returns the path and its branch name.
+func resolveWorktree(projectRoot, name string) (path, branch string, err error) {
+	if name != "" {
+		path = filepath.Join(projectRoot, "spaces", name)
+		// Directories may be named by identifier rather than branch, so a
+		// branch name that isn't a directory is looked up among worktrees,
+		// after the workspaces moved out of spaces/.
+		if _, statErr := os.Stat(path); statErr != nil {
+			if locations, _ := loadWorktreeLocations(projectRoot); locations[name] != "" {
+				path = locations[name]
+			} else if worktrees, wtErr := spaceWorktrees(projectRoot); wtErr == nil {
+				if wt, ok := findWorktreeByBranch(worktrees, name); ok {
+					path = wt.path
+				}
+			}
+		}
+	} else {
+		path, err = os.Getwd()
+		if err != nil {
+			return "", "", fmt.Errorf("could not get current directory: %w", err)
+		}
+	}
+
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return "", "", fmt.Errorf("could not resolve path: %w", err)
+	}
+	path = resolveSymlinks(path)
+
+	branch, err = validateWorktree(path, projectRoot)
+	if err != nil {
+		return "", "", err
+	}
+	return path, branch, nil
+}
+
+// spaceWorktrees returns the non-bare worktrees that live under the
+// project's spaces/ directory, plus those moved elsewhere with mv.
+func spaceWorktrees(projectRoot string) ([]worktreeEntry, error) {
+	cmd := exec.Command(gitBin, "worktree", "list", "--porcelain")
+	cmd.Dir = projectRoot
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worktrees: %w", err)
+	}
+
+	locations, _ := loadWorktreeLocations(projectRoot)
+	spacesDir := filepath.Join(projectRoot, "spaces")
+	// git records the real path of worktrees under a spaces/ that is a
+	// symlink to another disk
+	realSpacesDir := resolveSymlinks(spacesDir)
+	var worktrees []worktreeEntry
+	for _, entry := range parseWorktreeList(string(out)) {
+		if entry.isBare {
+			continue
+		}
+		if strings.HasPrefix(entry.path, spacesDir+string(filepath.Separator)) || strings.HasPrefix(entry.path, realSpacesDir+string(filepath.Separator)) || movedWorktreeName(locations, entry.path) != "" {
+			worktrees = append(worktrees, entry)
+		}
+	}
+	return worktrees, nil
+}
+
+// worktreeLocationsPath is where mv records the workspaces it moved out of
+// spaces/, as a map of workspace name to absolute path.
+func worktreeLocationsPath(projectRoot string) string {
+	return filepath.Join(projectRoot, ".workspace", "locations.json")
+}
+
+// loadWorktreeLocations reads the moved-workspace map. A missing file is
+// not an error.
+func loadWorktreeLocations(projectRoot string) (map[string]string, error) {
+	locations := map[string]string{}
+	data, err := os.ReadFile(worktreeLocationsPath(projectRoot))
+	if os.IsNotExist(err) {
+		return locations, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &locations); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", worktreeLocationsPath(projectRoot), err)
+	}
+	return locations, nil
+}
+
+func saveWorktreeLocations(projectRoot string, locations map[string]string) error {
+	path := worktreeLocationsPath(projectRoot)
+	if len(locations) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(locations, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0644)
+}
+
+// movedWorktreeName returns the workspace name recorded for a worktree
+// moved out of spaces/ to path, or "".
+func movedWorktreeName(locations map[string]string, path string) string {
+	for name, location := range locations {
+		if samePath(location, path) {
+			return name
+		}
+	}
+	return ""
+}
+
+// workspaceName returns the name a worktree is known by: its directory
+// under spaces/, or the name recorded when mv moved it elsewhere.
+func workspaceName(projectRoot, path string) string {
+	if locations, err := loadWorktreeLocations(projectRoot); err == nil {
+		if name := movedWorktreeName(locations, path); name != "" {
+			return name
+		}
+	}
+	spacesDir := filepath.Join(projectRoot, "spaces")
+	if rel, err := filepath.Rel(spacesDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return filepath.Base(path)
+}
+
+// forgetWorkspace drops a removed worktree from the moved-workspace map and
+// the frozen list, if it was in them.
+func forgetWorkspace(projectRoot, path string) {
+	name := workspaceName(projectRoot, path)
+	if frozen, err := loadFrozen(projectRoot); err == nil {
+		if _, ok := frozen[name]; ok {
+			delete(frozen, name)
+			if err := saveFrozen(projectRoot, frozen); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: could not update %s: %v\n", frozenPath(projectRoot), err)
+			}
+		}
+	}
+
+	locations, err := loadWorktreeLocations(projectRoot)
+	if err != nil {
+		return
+	}
+	if name := movedWorktreeName(locations, path); name != "" {
+		delete(locations, name)
+		if err := saveWorktreeLocations(projectRoot, locations); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not update %s: %v\n", worktreeLocationsPath(projectRoot), err)
+		}
+	}
+}
+
+// frozenPath is where freeze records the workspaces that bulk commands
+// leave alone, as a map of workspace name to when it was frozen.
+func frozenPath(projectRoot string) string {
+	return filepath.Join(projectRoot, ".workspace", "frozen.json")
+}
+
+// loadFrozen reads the frozen workspaces. A missing file is not an error.
+func loadFrozen(projectRoot string) (map[string]time.Time, error) {
+	frozen := map[string]time.Time{}
+	data, err := os.ReadFile(frozenPath(projectRoot))
+	if os.IsNotExist(err) {
+		return frozen, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &frozen); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", frozenPath(projectRoot), err)
+	}
+	return frozen, nil
+}
+
+func saveFrozen(projectRoot string, frozen map[string]time.Time) error {
+	path := frozenPath(projectRoot)
+	if len(frozen) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(frozen, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0644)
+}
+
+// hashIdentifier derives a stable identifier for --auto-identifier from the
+// first 6 hex digits of the SHA-256 of the worktree name. Later attempts
+// salt the name to get past a collision.
+func hashIdentifier(worktreeName string, attempt int) string {
+	input := worktreeName
+	if attempt > 0 {
+		input += "#" + strconv.Itoa(attempt)
+	}
+	sum := sha256.Sum256([]byte(input))
+	return hex.EncodeToString(sum[:])[:6]
+}
+
+// identifierTaken reports whether any of names is built from identifier
+// under either naming scheme.
+func identifierTaken(identifier string, names []string) bool {
+	for _, name := range names {
+		if name == identifier || strings.HasPrefix(name, identifier+"-") || strings.HasSuffix(name, "-"+identifier) {
+			return true
+		}
+	}
+	return false
+}
+
+// knownDDEVNames returns the DDEV project names of this project's
+// worktrees and of every project DDEV has registered on the machine.
+func knownDDEVNames(projectRoot string) []string {
+	var names []string
+	if worktrees, err := spaceWorktrees(projectRoot); err == nil {
+		var paths []string
+		for _, wt := range worktrees {
+			paths = append(paths, wt.path)
+		}
+		for name := range ddevNamesByWorktree(paths) {
+			names = append(names, name)
+		}
+	}
+	if projects, err := ddevListProjects(); err == nil {
+		for _, project := range projects {
+			names = append(names, project.Name)
+		}
+	}
+	return names
+}
+
+// ddevNamesByWorktree reads the DDEV project name of each worktree path and
+// returns a map of DDEV name to the worktree directory names using it.
+// Worktrees without a DDEV config are ignored.
+func ddevNamesByWorktree(paths []string) map[string][]string {
+	names := make(map[string][]string)
+	for _, path := range paths {
+		name, err := getDDEVProjectName(path)
+		if err != nil {
+			continue
+		}
+		names[name] = append(names[name], filepath.Base(path))
+	}
+	return names
+}
+
+// validateWorktree checks that targetPath is a git worktree and returns its
+// branch name. It runs git commands from projectRoot and skips bare repo entries.
+func validateWorktree(targetPath, projectRoot string) (branch string, err error) {
+	cmd := exec.Command(gitBin, "worktree", "list", "--porcelain")
+	cmd.Dir = projectRoot
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to list worktrees: %w", err)
+	}
+
+	for _, entry := range parseWorktreeList(string(out)) {
+		if !entry.isBare && samePath(entry.path, targetPath) {
+			return entry.branch, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s is not a git worktree", targetPath)
+}
+
+// ddevRoot returns the directory holding the DDEV project of the worktree
+// containing path. A .ddev/config.yaml directly in path wins; otherwise
+// ddev_dir from .workspace.yaml names it, or findDDEVDir searches the
+// worktree. Paths that aren't in a worktree (yet) are returned unchanged.
+func ddevRoot(path string) string {
+	if hasDDEVConfig(path) {
+		return path
+	}
+	out, err := gitOutput(path, "rev-parse", "--show-toplevel", "--git-common-dir")
+	if err != nil {
+		return path
+	}
+	top, commonDir, _ := strings.Cut(out, "\n")
+	top, commonDir = filepath.FromSlash(top), filepath.FromSlash(commonDir)
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(path, commonDir)
+	}
+	configured := ""
+	if config, err := loadConfig(projectRootFor(commonDir)); err == nil {
+		configured = config.DDEVDir
+	}
+	return findDDEVDir(top, configured)
+}
+
+// findDDEVDir returns where the DDEV project of the worktree at top lives:
+// the configured subdirectory when given, else top itself or the shallowest
+// directory up to two levels down with a .ddev/config.yaml, else top.
+func findDDEVDir(top, configured string) string {
+	if configured != "" {
+		return filepath.Join(top, configured)
+	}
+	if hasDDEVConfig(top) {
+		return top
+	}
+	level := []string{top}
+	for depth := 0; depth < 2; depth++ {
+		var next []string
+		for _, dir := range level {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				name := entry.Name()
+				if !entry.IsDir() || strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules" {
+					continue
+				}
+				sub := filepath.Join(dir, name)
+				if hasDDEVConfig(sub) {
+					return sub
+				}
+				next = append(next, sub)
+			}
+		}
+		level = next
+	}
+	return top
+}
+
+func hasDDEVConfig(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".ddev", "config.yaml"))
+	return err == nil
+}
+
+func getDDEVProjectName(dir string) (string, error) {
+	dir = ddevRoot(dir)
+
+	// Check config.local.yaml first for a name override
+	localConfigPath := filepath.Join(dir, ".ddev", "config.local.yaml")
+	if name, err := readDDEVName(localConfigPath); err == nil {
+		return name, nil
+	}
+
+	// Fall back to config.yaml
+	configPath := filepath.Join(dir, ".ddev", "config.yaml")
+	if name, err := readDDEVName(configPath); err == nil {
+		return name, nil
+	}
+
+	return "", fmt.Errorf("no 'name:' field found in %s or %s", localConfigPath, configPath)
+}
+
+func readDDEVName(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "name: ") {
+			return strings.TrimPrefix(line, "name: "), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("no 'name:' field found in %s", path)
+}
+
+var ddevConfigKeyRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// setDDEVConfigValue sets the top-level scalar key in the YAML content of
+// a .ddev/config.yaml, keeping every other line (and comments) as is. A key
+// that isn't present is appended. This is a line editor rather than a YAML
+// parser (the tool has no dependencies), so it refuses whatever it can't
+// rewrite as one line: a key holding a list or map, block or flow, and a
+// value spanning several lines, such as a | or > block scalar.
+func setDDEVConfigValue(content, key, value string) (string, error) {
+	if !ddevConfigKeyRe.MatchString(key) {
+		return "", fmt.Errorf("invalid key %q (only top-level keys can be set)", key)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return "", fmt.Errorf("%s: value must be a single line", key)
+	}
+	line := key + ": " + yamlScalar(value)
+
+	lines := strings.Split(content, "\n")
+	for i, existing := range lines {
+		if !strings.HasPrefix(existing, key+":") {
+			continue
+		}
+		rest := strings.TrimSpace(strings.TrimPrefix(existing, key+":"))
+		comment := yamlTrailingComment(rest)
+		if strings.HasPrefix(rest, "#") {
+			comment = " " + rest
+		}
+		scalar := strings.TrimSpace(strings.TrimSuffix(rest, strings.TrimPrefix(comment, " ")))
+		var next string
+		if i+1 < len(lines) {
+			next = lines[i+1]
+		}
+		indented := strings.TrimSpace(next) != "" && (strings.HasPrefix(next, " ") || strings.HasPrefix(next, "\t"))
+		switch {
+		case scalar == "" && (indented || strings.HasPrefix(next, "-")),
+			strings.HasPrefix(scalar, "["), strings.HasPrefix(scalar, "{"):
+			return "", fmt.Errorf("%s is not a scalar value", key)
+		case strings.HasPrefix(scalar, "|"), strings.HasPrefix(scalar, ">"):
+			return "", withHints(fmt.Errorf("%s is a block scalar, which config-ddev can't rewrite", key), "Edit .ddev/config.yaml by hand.")
+		case indented:
+			return "", withHints(fmt.Errorf("%s spans several lines, which config-ddev can't rewrite", key), "Edit .ddev/config.yaml by hand.")
+		}
+		lines[i] = line + comment
+		return strings.Join(lines, "\n"), nil
+	}
+
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return content + line + "\n", nil
+}
+
+// yamlTrailingComment returns the " # ..." comment at the end of a YAML
+// value, if any, skipping '#' inside quotes.
+func yamlTrailingComment(value string) string {
+	var quote rune
+	for i, c := range value {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && i > 0 && value[i-1] == ' ':
+			return " " + value[i:]
+		}
+	}
+	return ""
+}
+
+// yamlKeywords are the plain scalars a YAML 1.1 parser, like DDEV's, reads
+// as a boolean or null rather than the string written. true and false are
+// left out so boolean keys can still be set.
+var yamlKeywords = []string{"y", "yes", "n", "no", "on", "off", "null", "~"}
+
+// yamlScalar quotes value when YAML would otherwise read it as something
+// other than the plain string, number, or boolean it looks like.
+func yamlScalar(value string) string {
+	if value == "" || strings.ContainsAny(value, ":#'\"{}[],&*!|>%@`") || strings.TrimSpace(value) != value ||
+		containsString(yamlKeywords, strings.ToLower(value)) {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+func cmdConfigDDEV(args []string) error {
+	usage := "Usage: workspace config-ddev [name] <key>=<value>... [--yes]"
+	var names []string
+	var assignments [][2]string
+	yes := false
+	for _, arg := range args {
+		if arg == "--yes" || arg == "-y" {
+			yes = true
+		} else if key, value, ok := strings.Cut(arg, "="); ok {
+			assignments = append(assignments, [2]string{key, value})
+		} else {
+			names = append(names, arg)
+		}
+	}
+	if len(assignments) == 0 {
+		return usageError(fmt.Errorf("expected at least one key=value"), usage)
+	}
+	if len(names) > 1 {
+		return usageError(fmt.Errorf("expected at most 1 workspace name, got %d", len(names)), usage)
+	}
+	for _, a := range assignments {
+		if a[0] == "name" {
+			return withHints(fmt.Errorf("the DDEV name is managed by new and adopt"), "It is set in .ddev/config.local.yaml so config.yaml stays shared.")
+		}
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return err
+	}
+	var name string
+	if len(names) > 0 {
+		name = names[0]
+	}
+	targetPath, _, err := resolveWorktree(projectRoot, name)
+	if err != nil {
+		return err
+	}
+
+	configPath := filepath.Join(ddevRoot(targetPath), ".ddev", "config.yaml")
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("no DDEV project found in %s", targetPath)
+	}
+	content := string(data)
+	var steps []StepResult
+	for _, a := range assignments {
+		content, err = setDDEVConfigValue(content, a[0], a[1])
+		if err != nil {
+			return err
+		}
+		steps = append(steps, StepResult{Description: a[0], Detail: a[1]})
+	}
+	if err := writeFileAtomic(configPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", configPath, err)
+	}
+	fmt.Printf("Updated %s\n", configPath)
+
+	// The change only takes effect on restart; ask rather than restarting
+	// unannounced, and leave it to the user when there's no one to ask.
+	if !yes && !stdinIsTerminal() {
+		fmt.Println("Run 'ddev restart' in the workspace to apply the change.")
+		return nil
+	}
+	ok, err := confirmUnlessYes("Restart DDEV now to apply it? (y/N) ", yes)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("Run 'ddev restart' in the workspace to apply the change.")
+		return nil
+	}
+	fmt.Println("\n--- Restarting DDEV ---")
+	if err := runDDEVLocked(ddevRoot(targetPath), nil, "restart"); err != nil {
+		return withKind(ErrDDEVFailed, fmt.Errorf("restarting DDEV: %w", err))
+	}
+	steps = append(steps, StepResult{Description: "DDEV", Detail: "Restarted"})
+	fmt.Println()
+	renderSummary("DDEV Config Update", steps)
+	return nil
+}
+
+func getDDEVProjectType(dir string) ProjectType {
+	configPath := filepath.Join(ddevRoot(dir), ".ddev", "config.yaml")
+	f, err := os.Open(configPath)
+	if err != nil {
+		return ProjectUnsupported
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "type: ") {
+			value := strings.TrimPrefix(line, "type: ")
+			if strings.HasPrefix(value, "drupal") {
+				return ProjectDrupal
+			}
+			if strings.HasPrefix(value, "wordpress") {
+				return ProjectWordPress
+			}
+			return ProjectUnsupported
+		}
+	}
+
+	return ProjectUnsupported
+}
+
+// localBranchExists reports whether refs/heads/<name> exists. Tags and
+// commit SHAs with the same name don't count.
+func localBranchExists(projectRoot, name string) bool {
+	cmd := exec.Command(gitBin, "rev-parse", "--verify", "--quiet", "refs/heads/"+name)
+	cmd.Dir = projectRoot
+	return cmd.Run() == nil
+}
+
+// resolveCommitish resolves a branch, tag, SHA, or HEAD to a full commit SHA,
+// running git from dir.
+func resolveCommitish(dir, ref string) (string, error) {
+	return gitOutput(dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// defaultHooksDir is where new --run-hooks looks for hooks tracked in the
+// repository, relative to the worktree.
+const defaultHooksDir = ".githooks"
+
+// repoHookNames are the hooks new --run-hooks runs, in order.
+var repoHookNames = []string{"post-checkout", "post-worktree"}
+
+// findRepoHooks returns the paths of the executable hooks from repoHookNames
+// present in dir.
+func findRepoHooks(dir string) []string {
+	var hooks []string
+	for _, name := range repoHookNames {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0 {
+			hooks = append(hooks, path)
+		}
+	}
+	return hooks
+}
+
+// defaultCopyFiles is what new --copy-from copies when copy_files isn't set.
+var defaultCopyFiles = []string{".env", ".env.local", ".vscode/", ".idea/"}
+
+// parsePathPatterns splits a comma-separated list of worktree paths
+// (copy_files, archive_exclude) into patterns: paths relative to the
+// worktree root, which may contain glob characters and end in / to match
+// only directories.
+func parsePathPatterns(value string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		clean := path.Clean(strings.TrimSuffix(pattern, "/"))
+		if path.IsAbs(clean) || filepath.IsAbs(pattern) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("%q is not a path inside the worktree", pattern)
+		}
+		if _, err := path.Match(clean, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q", pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no patterns given")
+	}
+	return patterns, nil
+}
+
+// copyLocalFiles copies the untracked files matching patterns from the
+// worktree at src, the workspace named from, into dest.
+func copyLocalFiles(src, dest, from string, patterns []string) []StepResult {
+	out, err := gitOutput(src, "ls-files", "-z")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nWarning: failed to list tracked files in %s: %v\n", src, err)
+		return []StepResult{{Description: "Copied from " + from, Detail: "Failed: " + err.Error()}}
+	}
+	tracked := make(map[string]bool)
+	for _, file := range strings.Split(out, "\x00") {
+		if file != "" {
+			tracked[file] = true
+		}
+	}
+
+	copied, kept, err := copyUntrackedFiles(src, dest, patterns, tracked)
+	detail := strings.Join(copied, ", ")
+	if len(copied) == 0 {
+		detail = "Nothing matched " + strings.Join(patterns, ", ")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nWarning: failed to copy local files from %s: %v\n", from, err)
+		detail = "Failed: " + err.Error()
+		if len(copied) > 0 {
+			detail += " (copied " + strings.Join(copied, ", ") + ")"
+		}
+	}
+	steps := []StepResult{{Description: "Copied from " + from, Detail: detail}}
+	if len(kept) > 0 {
+		steps = append(steps, StepResult{
+			Description: "Kept existing",
+			Detail:      strings.Join(kept, ", "),
+		})
+	}
+	return steps
+}
+
+// copyUntrackedFiles copies the files and directories under src matching
+// patterns into the same places under dest, and returns their paths
+// relative to src. Matches that git tracks (the path itself or anything
+// under it, per tracked) are left out, since the checkout already has
+// them; matches that already exist in dest are left alone and returned as
+// kept.
+func copyUntrackedFiles(src, dest string, patterns []string, tracked map[string]bool) (copied, kept []string, err error) {
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		dirsOnly := strings.HasSuffix(pattern, "/")
+		matches, err := filepath.Glob(filepath.Join(src, filepath.FromSlash(strings.TrimSuffix(pattern, "/"))))
+		if err != nil {
+			return copied, kept, fmt.Errorf("invalid pattern %q", pattern)
+		}
+		for _, match := range matches {
+			rel, err := filepath.Rel(src, match)
+			if err != nil {
+				return copied, kept, err
+			}
+			rel = filepath.ToSlash(rel)
+			if seen[rel] || rel == ".git" || isTrackedPath(rel, tracked) {
+				continue
+			}
+			seen[rel] = true
+			info, err := os.Lstat(match)
+			if err != nil {
+				return copied, kept, err
+			}
+			if dirsOnly && !info.IsDir() {
+				continue
+			}
+			name := rel
+			if info.IsDir() {
+				name += "/"
+			}
+
+			target := filepath.Join(dest, filepath.FromSlash(rel))
+			if _, err := os.Lstat(target); err == nil {
+				kept = append(kept, name)
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return copied, kept, err
+			}
+			if err := copyTree(match, target); err != nil {
+				return copied, kept, fmt.Errorf("copying %s: %w", name, err)
+			}
+			copied = append(copied, name)
+		}
+	}
+	return copied, kept, nil
+}
+
+// isTrackedPath reports whether git tracks rel or, for a directory,
+// anything under it.
+func isTrackedPath(rel string, tracked map[string]bool) bool {
+	if tracked[rel] {
+		return true
+	}
+	for file := range tracked {
+		if strings.HasPrefix(file, rel+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// runRepoHooks runs the repository's own hooks from hooksDir in a freshly
+// created worktree, streaming their output. post-checkout gets the
+// arguments git passes for a new checkout, and is skipped when hooksDir is
+// the configured hooks path because git already ran it during worktree add.
+// Hook failures are reported as warnings.
+func runRepoHooks(worktreePath, hooksDir string) []StepResult {
+	dir := hooksDir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(worktreePath, dir)
+	}
+	hooks := findRepoHooks(dir)
+	if len(hooks) == 0 {
+		return []StepResult{{Description: "Repo hooks", Detail: "None found in " + hooksDir}}
+	}
+
+	gitHooks, _ := gitOutput(worktreePath, "rev-parse", "--git-path", "hooks")
+	if gitHooks != "" && !filepath.IsAbs(gitHooks) {
+		gitHooks = filepath.Join(worktreePath, gitHooks)
+	}
+	head, _ := gitOutput(worktreePath, "rev-parse", "HEAD")
+
+	var steps []StepResult
+	for _, hook := range hooks {
+		name := filepath.Base(hook)
+		if name == "post-checkout" && gitHooks != "" && filepath.Clean(gitHooks) == filepath.Clean(dir) {
+			steps = append(steps, StepResult{Description: name + " hook", Detail: "Already run by git worktree add"})
+			continue
+		}
+
+		var args []string
+		if name == "post-checkout" {
+			args = []string{strings.Repeat("0", 40), head, "1"}
+		}
+		if err := runPhase("Running "+name+" hook", func() error {
+			return runCommandLive(worktreePath, hook, args...)
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "\nWarning: %s hook failed: %v\n", name, err)
+			steps = append(steps, StepResult{Description: name + " hook", Detail: fmt.Sprintf("Failed: %v", err)})
+		} else {
+			steps = append(steps, StepResult{Description: name + " hook", Detail: "Ran " + filepath.Join(hooksDir, name)})
+		}
+	}
+	return steps
+}
+
+// fetchPullRequest fetches the head of pull (GitHub) or merge (GitLab)
+// request number into the local branch and returns the remote ref it came
+// from. The forge is recognized from the host in origin's URL.
+func fetchPullRequest(projectRoot string, number int, branch string) (string, error) {
+	originURL, err := gitOutput(projectRoot, "config", "remote.origin.url")
+	if err != nil {
+		return "", fmt.Errorf("reading origin URL: %w", err)
+	}
+	ref, err := pullRequestRef(originURL, number)
+	if err != nil {
+		return "", withHints(err, "Fetch the branch yourself and create the workspace with --checkout.")
+	}
+	if err := runPhase(fmt.Sprintf("Fetching pull request #%d", number), func() error {
+		return runCommandLive(projectRoot, gitBin, "fetch", "origin", "+"+ref+":refs/heads/"+branch)
+	}); err != nil {
+		return "", fmt.Errorf("fetching %s: %w", ref, err)
+	}
+	return ref, nil
+}
+
+// pullRequestRef returns the ref under which the forge hosting originURL
+// publishes the head of a pull or merge request.
+func pullRequestRef(originURL string, number int) (string, error) {
+	host := strings.ToLower(remoteHost(originURL))
+	switch {
+	case strings.Contains(host, "github"):
+		return fmt.Sprintf("refs/pull/%d/head", number), nil
+	case strings.Contains(host, "gitlab"):
+		return fmt.Sprintf("refs/merge-requests/%d/head", number), nil
+	}
+	return "", fmt.Errorf("--pr needs a GitHub or GitLab origin, not %s", originURL)
+}
+
+// remoteHost returns the host of a git remote URL, whether URL-shaped
+// (https://host/..., ssh://user@host:22/...) or scp-like (user@host:path),
+// or "" for local paths.
+func remoteHost(remote string) string {
+	if u, err := url.Parse(remote); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+	before, _, found := strings.Cut(remote, ":")
+	if !found || strings.ContainsAny(before, `/\`) {
+		return ""
+	}
+	if _, host, ok := strings.Cut(before, "@"); ok {
+		return host
+	}
+	return before
+}
+
+// createWorktree adds the worktree spaces/<dir> for branch name, creating the
+// branch from baseBranch when it doesn't exist yet.
+func createWorktree(projectRoot, dir, name, baseBranch string) error {
+	if localBranchExists(projectRoot, name) {
+		// Branch exists — check it out directly
+		return addWorktree(projectRoot, dir, nil, name)
+	}
+	// Branch doesn't exist — create it
+	var err error
+	if baseBranch != "" {
+		err = addWorktree(projectRoot, dir, []string{"-b", name}, "--no-track", baseBranch)
+	} else {
+		err = addWorktree(projectRoot, dir, []string{"-b", name})
+	}
+	if err == nil {
+		recordForkPoint(projectRoot, name)
+	}
+	return err
+}
+
+// forkPointKey is the git config key holding the commit a branch was
+// created from, so its own commits can be told apart later.
+func forkPointKey(branch string) string {
+	return "branch." + branch + ".workspaceBase"
+}
+
+// recordForkPoint stores the commit the newly created branch points at as
+// its fork point. It is best effort: without one the branch is never
+// considered merged.
+func recordForkPoint(projectRoot, branch string) {
+	sha, err := gitOutput(projectRoot, "rev-parse", "refs/heads/"+branch)
+	if err != nil {
+		return
+	}
+	if _, err := gitOutput(projectRoot, "config", forkPointKey(branch), sha); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not record where %s was branched from: %v\n", branch, err)
+	}
+}
+
+// createDetachedWorktree adds the worktree spaces/<dir> with commit checked
+// out on a detached HEAD, creating no branch.
+func createDetachedWorktree(projectRoot, dir, commit string) error {
+	return addWorktree(projectRoot, dir, []string{"--detach"}, commit)
+}
+
+// addWorktree runs git worktree add for spaces/<dir>, with flags before the
+// path and rest after it.
+//
+// The path is normally the relative spaces/<dir>. When spaces/ is on another
+// filesystem than the git directory (a bind mount onto another disk) or
+// resolves outside the project (a symlink), the gitdir and commondir links
+// git writes between the worktree and the git directory only stay valid as
+// absolute paths, so the fully resolved path is passed, relative links are
+// turned off, and the links are checked afterwards, repaired if broken.
+func addWorktree(projectRoot, dir string, flags []string, rest ...string) error {
+	spacesDir := filepath.Join(projectRoot, "spaces")
+	if err := os.MkdirAll(spacesDir, 0755); err != nil {
+		return fmt.Errorf("could not create spaces directory: %w", err)
+	}
+
+	path, absolute := worktreeAddPath(projectRoot, dir)
+	var gitArgs []string
+	if absolute {
+		gitArgs = []string{"-c", "worktree.useRelativePaths=false"}
+	}
+	gitArgs = append(gitArgs, "worktree", "add")
+	gitArgs = append(gitArgs, flags...)
+	gitArgs = append(gitArgs, path)
+	gitArgs = append(gitArgs, rest...)
+	cmd := exec.Command(gitBin, gitArgs...)
+	cmd.Dir = projectRoot
+	cmd.Stdout, cmd.Stderr = outputWriters()
+	if err := cmd.Run(); err != nil || !absolute {
+		return err
+	}
+
+	if err := checkWorktreeLinks(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; running git worktree repair\n", err)
+		repair := exec.Command(gitBin, "worktree", "repair", path)
+		repair.Dir = projectRoot
+		repair.Stdout, repair.Stderr = outputWriters()
+		if repairErr := repair.Run(); repairErr != nil {
+			return fmt.Errorf("git worktree repair: %w", repairErr)
+		}
+		return checkWorktreeLinks(path)
+	}
+	return nil
+}
+
+// worktreeAddPath returns the path to give git worktree add for
+// spaces/<dir>, and whether it had to be absolute (see addWorktree).
+func worktreeAddPath(projectRoot, dir string) (string, bool) {
+	relative := filepath.Join("spaces", dir)
+	spacesDir, err := filepath.EvalSymlinks(filepath.Join(projectRoot, "spaces"))
+	if err != nil {
+		return relative, false
+	}
+	spacesDir, err = filepath.Abs(spacesDir)
+	if err != nil {
+		return relative, false
+	}
+	gitDir := projectRoot
+	if commonDir, err := gitOutput(projectRoot, "rev-parse", "--path-format=absolute", "--git-common-dir"); err == nil {
+		gitDir = commonDir
+	}
+	if pathWithin(projectRoot, spacesDir) && sameFilesystem(gitDir, spacesDir) {
+		return relative, false
+	}
+	return filepath.Join(spacesDir, dir), true
+}
 
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
+// checkWorktreeLinks checks that the worktree at path and its entry in the
+// git directory point at each other: path/.git names an existing gitdir,
+// whose gitdir file points back at path/.git and whose commondir exists.
+func checkWorktreeLinks(path string) error {
+	data, err := os.ReadFile(filepath.Join(path, ".git"))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("worktree %s has no .git file: %w", path, err)
 	}
-	input = strings.TrimSpace(input)
-	if input != "y" && input != "Y" {
-		fmt.Println("Aborted.")
-		return
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return fmt.Errorf("worktree %s: .git file has no gitdir line", path)
+	}
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(path, gitDir)
+	}
+	if _, err := os.Stat(gitDir); err != nil {
+		return fmt.Errorf("worktree %s: gitdir %s is missing", path, gitDir)
 	}
 
-	var steps []StepResult
+	data, err = os.ReadFile(filepath.Join(gitDir, "gitdir"))
+	if err != nil {
+		return fmt.Errorf("worktree %s: %w", path, err)
+	}
+	back := strings.TrimSpace(string(data))
+	if !filepath.IsAbs(back) {
+		back = filepath.Join(gitDir, back)
+	}
+	if !samePath(back, filepath.Join(path, ".git")) {
+		return fmt.Errorf("worktree %s: %s points at %s", path, filepath.Join(gitDir, "gitdir"), back)
+	}
 
-	// Step 1: Delete DDEV (if present)
-	ddevName, ddevErr := getDDEVProjectName(targetPath)
-	if ddevErr == nil {
-		fmt.Println("\n--- Deleting DDEV project ---")
-		// Pass the project name explicitly so DDEV can clean up its
-		// global registration even if the directory disappears later.
-		ddevCmd := exec.Command("ddev", "delete", "--omit-snapshot", "-y", ddevName)
-		ddevCmd.Dir = targetPath
-		ddevCmd.Stdout = os.Stdout
-		ddevCmd.Stderr = os.Stderr
-		if err := ddevCmd.Run(); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to delete DDEV project: %v\n", err)
-			steps = append(steps, StepResult{
-				Description: "DDEV project",
-				Detail:      fmt.Sprintf("Failed to delete: %v", err),
-			})
-		} else {
-			steps = append(steps, StepResult{
-				Description: "DDEV project",
-				Detail:      "Deleted (" + ddevName + ")",
-			})
-		}
-	} else {
-		steps = append(steps, StepResult{
-			Description: "DDEV project",
-			Detail:      "Skipped (no .ddev/config.yaml)",
-		})
+	data, err = os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return fmt.Errorf("worktree %s: %w", path, err)
 	}
+	commonDir := strings.TrimSpace(string(data))
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(gitDir, commonDir)
+	}
+	if _, err := os.Stat(filepath.Join(commonDir, "HEAD")); err != nil {
+		return fmt.Errorf("worktree %s: commondir %s is not a git directory", path, commonDir)
+	}
+	return nil
+}
 
-	// Step 2: Remove git worktree (run from the project root)
-	fmt.Println("\n--- Removing git worktree ---")
-	wtCmd := exec.Command("git", "worktree", "remove", "--force", targetPath)
-	wtCmd.Dir = projectRoot
-	wtCmd.Stdout = os.Stdout
-	wtCmd.Stderr = os.Stderr
-	if err := wtCmd.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error removing worktree: %v\n", err)
-		os.Exit(1)
+// applyDDEVName renames the DDEV project in a worktree to ddevName via
+// .ddev/config.local.yaml and, for Drupal, points settings.ddev.php at the
+// renamed database container.
+func applyDDEVName(worktreePath, ddevName string, projectType ProjectType) ([]StepResult, error) {
+	if err := createDDEVLocalConfig(worktreePath, ddevName); err != nil {
+		return nil, fmt.Errorf("creating DDEV local config: %w", err)
 	}
-	steps = append(steps, StepResult{
-		Description: "Git worktree",
-		Detail:      "Removed " + targetPath,
+	steps := []StepResult{{
+		Description: "Created DDEV local config",
+		Detail:      ddevName,
+	}}
+	settingsSteps, err := rewriteDDEVSettings(worktreePath, ddevName, projectType)
+	return append(steps, settingsSteps...), err
+}
+
+// rewriteDDEVSettings points a Drupal worktree's settings.ddev.php at the
+// database container of ddevName and hides the change from git status.
+func rewriteDDEVSettings(worktreePath, ddevName string, projectType ProjectType) ([]StepResult, error) {
+	if projectType != ProjectDrupal {
+		return nil, nil
+	}
+	root := ddevRoot(worktreePath)
+	settingsPath := filepath.Join(root, "web", "sites", "default", "settings.ddev.php")
+	if _, err := os.Stat(settingsPath); err != nil {
+		return nil, nil
+	}
+	if err := updateSettingsDdevPHP(settingsPath, ddevName); err != nil {
+		return nil, fmt.Errorf("updating settings.ddev.php: %w", err)
+	}
+	assumeCmd := exec.Command(gitBin, "update-index", "--assume-unchanged", filepath.Join("web", "sites", "default", "settings.ddev.php"))
+	assumeCmd.Dir = root
+	_ = assumeCmd.Run()
+	return []StepResult{{
+		Description: "Updated settings.ddev.php",
+		Detail:      "DB host set to ddev-" + ddevName + "-db",
+	}}, nil
+}
+
+func createDDEVLocalConfig(worktreePath, ddevName string) error {
+	localConfigPath := filepath.Join(ddevRoot(worktreePath), ".ddev", "config.local.yaml")
+	content := "name: " + ddevName + "\n"
+	err := writeFileAtomic(localConfigPath, []byte(content), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write %s: %w", localConfigPath, err)
+	}
+	return nil
+}
+
+// Ports handed out by --assign-ports come from portSlots blocks of
+// portSlotSize ports starting at portRangeStart.
+const (
+	portRangeStart = 20000
+	portSlotSize   = 10
+	portSlots      = 4000
+)
+
+type workspacePorts struct {
+	HTTP    int
+	HTTPS   int
+	Mailpit int
+}
+
+// portsFor deterministically maps a DDEV project name to a block of host
+// ports, so a workspace keeps the same ports across recreations.
+func portsFor(ddevName string) workspacePorts {
+	h := fnv.New32a()
+	h.Write([]byte(ddevName))
+	base := portRangeStart + int(h.Sum32()%portSlots)*portSlotSize
+	return workspacePorts{HTTP: base, HTTPS: base + 1, Mailpit: base + 2}
+}
+
+func writeDDEVPortsConfig(worktreePath string, ports workspacePorts) error {
+	configPath := filepath.Join(ddevRoot(worktreePath), ".ddev", "config.workspace.yaml")
+	content := fmt.Sprintf("# Written by workspace new --assign-ports\nrouter_http_port: \"%d\"\nrouter_https_port: \"%d\"\nmailpit_http_port: \"%d\"\n",
+		ports.HTTP, ports.HTTPS, ports.Mailpit)
+	if err := writeFileAtomic(configPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("could not write %s: %w", configPath, err)
+	}
+	return nil
+}
+
+// updateSettingsDdevPHP rewrites the $host assignment in settings.ddev.php
+// and nothing else; comment blocks and the rest of the file are kept as is.
+func updateSettingsDdevPHP(settingsPath, ddevName string) error {
+	data, err := os.ReadFile(settingsPath)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", settingsPath, err)
+	}
+
+	content := string(data)
+
+	// Set $host to the new DDEV container name
+	hostRe := regexp.MustCompile(`\$host\s*=\s*["'].*?["']`)
+	newHost := `$host = "ddev-` + ddevName + `-db"`
+	if !hostRe.MatchString(content) {
+		return fmt.Errorf("could not find $host assignment in %s", settingsPath)
+	}
+	content = hostRe.ReplaceAllLiteralString(content, newHost)
+
+	err = writeFileAtomic(settingsPath, []byte(content), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write %s: %w", settingsPath, err)
+	}
+
+	return nil
+}
+
+// writeFileAtomic replaces path with data so that a crash or kill midway
+// leaves either the old contents or the new, never a truncated file: data
+// goes to a temporary file in the same directory, which is then renamed
+// over path. An existing file keeps its mode (and a symlink is followed, so
+// the link stays); a new one gets perm.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+func runCommandLive(dir, name string, args ...string) error {
+	return runCommandLiveEnv(dir, nil, name, args...)
+}
+
+// DDEV keeps its project registry and router configuration in ~/.ddev,
+// shared by every project on the machine. ddev start, restart, and delete
+// change it, and concurrent runs (scripted back-to-back new commands) can
+// race on it, so the tool runs them one at a time across processes under a
+// per-user lock file. Git work and other DDEV commands run unlocked.
+const ddevLockTimeout = 15 * time.Minute
+
+// ddevLockHeld is set while this process holds the DDEV lock, so nested
+// withDDEVLock calls don't wait on themselves.
+var ddevLockHeld bool
+
+func ddevLockPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "workspace", "ddev.lock"), nil
+}
+
+// withDDEVLock runs fn holding the DDEV lock, waiting up to ddevLockTimeout
+// for other workspace commands to release it. The operating system drops
+// the lock when a process exits, so a crashed command never leaves it held.
+func withDDEVLock(fn func() error) error {
+	if ddevLockHeld {
+		return fn()
+	}
+	path, err := ddevLockPath()
+	if err != nil {
+		return fmt.Errorf("locating the DDEV lock: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating the DDEV lock: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("opening the DDEV lock: %w", err)
+	}
+	defer f.Close()
+
+	deadline := time.Now().Add(ddevLockTimeout)
+	for waiting := false; ; waiting = true {
+		ok, err := tryLockFile(f)
+		if err != nil {
+			return fmt.Errorf("locking %s: %w", path, err)
+		}
+		if ok {
+			break
+		}
+		if !waiting {
+			fmt.Fprintln(os.Stderr, "Waiting for another workspace command to finish with DDEV...")
+		}
+		if time.Now().After(deadline) {
+			return withHints(fmt.Errorf("timed out after %s waiting for the DDEV lock %s", ddevLockTimeout, path),
+				"Another workspace command is still starting or deleting a DDEV project.")
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	ddevLockHeld = true
+	defer func() {
+		ddevLockHeld = false
+		_ = unlockFile(f)
+	}()
+	return fn()
+}
+
+// runDDEVLocked runs ddev with live output under the DDEV lock, for the
+// commands that change DDEV's global state.
+func runDDEVLocked(dir string, env []string, args ...string) error {
+	return withDDEVLock(func() error {
+		return runCommandLiveEnv(dir, env, ddevBin, args...)
 	})
+}
 
-	// Step 3: Delete the branch
-	fmt.Println("\n--- Deleting branch ---")
-	branchCmd := exec.Command("git", "branch", "-D", branchName)
-	branchCmd.Dir = projectRoot
-	branchCmd.Stdout = os.Stdout
-	branchCmd.Stderr = os.Stderr
-	if err := branchCmd.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to delete branch %s: %v\n", branchName, err)
-		steps = append(steps, StepResult{
-			Description: "Branch",
-			Detail:      fmt.Sprintf("Failed to delete %s: %v", branchName, err),
-		})
-	} else {
-		steps = append(steps, StepResult{
-			Description: "Branch",
-			Detail:      "Deleted " + branchName,
-		})
+// runCommandLiveEnv is runCommandLive with extra KEY=VALUE entries added to
+// the command's environment.
+func runCommandLiveEnv(dir string, env []string, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout, cmd.Stderr = outputWriters()
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// dbImportOptions override how handleDBImport picks the dump: file names
+// it outright (--db-file), prompt asks even when db/db.sql.gz exists
+// (--db-prompt), and noPrompt makes a missing db/db.sql.gz an error instead
+// of asking (--no-prompt-db). dryRun checks the chosen dump without
+// importing it (--dry-run-db). env is passed to ddev start when a stopped
+// project has to be started again (new --env).
+type dbImportOptions struct {
+	file          string
+	prompt        bool
+	noPrompt      bool
+	excludeTables []string
+	dryRun        bool
+	env           []string
+}
+
+// parseExcludeTables parses the comma-separated --db-exclude-tables list.
+// Entries may be glob patterns such as cache_*.
+func parseExcludeTables(value string) ([]string, error) {
+	var tables []string
+	for _, table := range strings.Split(value, ",") {
+		table = strings.TrimSpace(table)
+		if table == "" {
+			continue
+		}
+		if _, err := filepath.Match(table, ""); err != nil {
+			return nil, fmt.Errorf("invalid --db-exclude-tables pattern %q", table)
+		}
+		tables = append(tables, table)
 	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("--db-exclude-tables needs at least one table name")
+	}
+	return tables, nil
+}
 
-	// Step 4: Prune Docker build cache
-	fmt.Println("\n--- Pruning Docker build cache ---")
-	pruneCmd := exec.Command("docker", "builder", "prune", "-f")
-	pruneCmd.Stdout = os.Stdout
-	pruneCmd.Stderr = os.Stderr
-	if err := pruneCmd.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to prune Docker build cache: %v\n", err)
-		steps = append(steps, StepResult{
-			Description: "Docker build cache",
-			Detail:      fmt.Sprintf("Failed to prune: %v", err),
-		})
+func handleDBImport(worktreePath, projectRoot string, opts dbImportOptions) (string, error) {
+	config, err := loadConfig(projectRoot)
+	if err != nil {
+		return "", err
+	}
+	dumpDir, err := dbDir(projectRoot)
+	if err != nil {
+		return "", err
+	}
+	defaultPath := filepath.Join(dumpDir, "db.sql.gz")
+
+	// use verifies and imports the chosen dump, or with --dry-run-db only
+	// checks it.
+	use := func(path string) (string, error) {
+		if opts.dryRun {
+			return dryRunDump(path)
+		}
+		if err := verifyDump(path); err != nil {
+			return "", err
+		}
+		skipped, err := importDump(worktreePath, path, config.MinFreeSpace, opts.excludeTables, opts.env)
+		if err != nil {
+			return "", err
+		}
+		return "Imported from " + path + skipped, nil
+	}
+
+	if opts.file != "" {
+		path, err := filepath.Abs(opts.file)
+		if err != nil {
+			return "", fmt.Errorf("could not resolve path: %w", err)
+		}
+		return use(path)
+	}
+
+	out, _ := outputWriters()
+	info, statErr := os.Stat(defaultPath)
+	if statErr == nil && !opts.prompt {
+		fmt.Fprintf(out, "\nFound database dump at %s\n", defaultPath)
+		return use(defaultPath)
+	}
+	if opts.noPrompt {
+		return "", withHints(fmt.Errorf("no database dump found at %s", defaultPath),
+			"Put the dump there or pass --db-file <path>.")
+	}
+
+	// Prompt user. Only a failing import is an error; skipping, an aborted
+	// prompt, or a missing file keep the workspace without a database.
+	reader := bufio.NewReader(os.Stdin)
+	if statErr == nil {
+		fmt.Fprintf(out, "\nDefault dump: %s (modified %s)\n", defaultPath, info.ModTime().Format("2006-01-02 15:04"))
 	} else {
-		steps = append(steps, StepResult{
-			Description: "Docker build cache",
-			Detail:      "Pruned",
-		})
+		fmt.Fprintf(out, "\nNo database dump found at %s\n", defaultPath)
+	}
+	fmt.Fprint(out, "Enter path to database dump (or press Enter to skip): ")
+	input, err := reader.ReadString('\n')
+	if err != nil && strings.TrimSpace(input) == "" {
+		fmt.Fprintln(out)
+		return "Skipped (no input)", nil
 	}
+	input = strings.TrimSpace(input)
 
-	// Summary
-	fmt.Println()
-	fmt.Println("=== Workspace Removal Complete ===")
-	fmt.Println()
-	for _, step := range steps {
-		fmt.Printf("  %-25s %s\n", step.Description+":", step.Detail)
+	if input == "" {
+		return "Skipped (no import)", nil
 	}
-	fmt.Println()
+
+	// Resolve the path
+	if !filepath.IsAbs(input) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("error getting working directory: %w", err)
+		}
+		input = filepath.Join(cwd, input)
+	}
+
+	if _, err := os.Stat(input); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: file not found: %s; skipping database import\n", input)
+		return "Skipped (file not found: " + input + ")", nil
+	}
+	return use(input)
 }
 
-// validateWorktree checks that targetPath is a git worktree and returns its
-// branch name. It runs git commands from projectRoot and skips bare repo entries.
-func validateWorktree(targetPath, projectRoot string) (branch string, err error) {
-	cmd := exec.Command("git", "worktree", "list", "--porcelain")
-	cmd.Dir = projectRoot
-	out, err := cmd.Output()
+// dryRunDump checks the dump at path for new --dry-run-db without importing
+// it: the checksum when there is a sidecar file, then a full read that
+// catches a corrupt .gz and, for SQL dumps, measures the uncompressed size
+// and counts the CREATE TABLE statements.
+func dryRunDump(path string) (string, error) {
+	if _, err := os.Stat(path + ".sha256"); err == nil {
+		if err := verifyDump(path); err != nil {
+			return "", err
+		}
+	}
+	if !sqlDumpPath(path) {
+		// Archives and other formats ddev import-db accepts can't be
+		// scanned line by line; .gz ones still get the integrity check.
+		if err := verifyDump(path); err != nil {
+			return "", err
+		}
+		return "Dry run: " + path + " not imported (only .sql and .sql.gz dumps are scanned)", nil
+	}
+
+	var size int64
+	var tables int
+	err := runPhase("Checking database dump", func() (err error) {
+		size, tables, err = scanDumpFile(path)
+		return err
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to list worktrees: %w", err)
+		return "", err
 	}
+	return fmt.Sprintf("Dry run: %s not imported (%s uncompressed, %d tables)", path, formatBytes(size), tables), nil
+}
 
-	for _, entry := range parseWorktreeList(string(out)) {
-		if !entry.isBare && entry.path == targetPath {
-			return entry.branch, nil
+// sqlDumpPath reports whether path names a plain or gzipped SQL dump, the
+// kinds that can be read line by line.
+func sqlDumpPath(path string) bool {
+	if strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz") {
+		return false
+	}
+	return strings.HasSuffix(path, ".sql") || strings.HasSuffix(path, ".gz")
+}
+
+// scanDumpFile reads the SQL dump at path, decompressing .gz dumps, and
+// returns its uncompressed size and number of tables.
+func scanDumpFile(path string) (int64, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s failed the gzip integrity check (truncated or corrupt?): %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	size, tables, err := scanDump(r)
+	if err != nil && strings.HasSuffix(path, ".gz") {
+		return 0, 0, fmt.Errorf("%s failed the gzip integrity check (truncated or corrupt?): %w", path, err)
+	}
+	return size, tables, err
+}
+
+// scanDump streams the SQL dump in r and returns its size in bytes and the
+// number of CREATE TABLE statements, mysqldump's and pg_dump's alike.
+func scanDump(r io.Reader) (int64, int, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	var size int64
+	tables := 0
+	for {
+		head, err := br.Peek(len("CREATE TABLE "))
+		if len(head) == 0 {
+			if err != nil && err != io.EOF {
+				return 0, 0, err
+			}
+			break
+		}
+		if strings.HasPrefix(string(head), "CREATE TABLE ") {
+			tables++
+		}
+
+		// Lines are skipped without being held in memory, however long an
+		// extended INSERT gets.
+		for {
+			chunk, err := br.ReadSlice('\n')
+			size += int64(len(chunk))
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			if err == io.EOF {
+				return size, tables, nil
+			}
+			if err != nil {
+				return 0, 0, err
+			}
+			break
 		}
 	}
-
-	return "", fmt.Errorf("%s is not a git worktree", targetPath)
+	return size, tables, nil
 }
 
-func getDDEVProjectName(dir string) (string, error) {
-	// Check config.local.yaml first for a name override
-	localConfigPath := filepath.Join(dir, ".ddev", "config.local.yaml")
-	if name, err := readDDEVName(localConfigPath); err == nil {
-		return name, nil
+// importDump imports dumpPath, first filtering out the rows of the excluded
+// tables into a temporary dump when there are any. The returned detail
+// names the tables that were skipped.
+func importDump(worktreePath, dumpPath string, minFree int64, exclude, env []string) (string, error) {
+	if len(exclude) == 0 {
+		return "", importDatabase(worktreePath, dumpPath, minFree, env)
 	}
 
-	// Fall back to config.yaml
-	configPath := filepath.Join(dir, ".ddev", "config.yaml")
-	if name, err := readDDEVName(configPath); err == nil {
-		return name, nil
+	tmp, err := os.CreateTemp("", "workspace-db-*.sql.gz")
+	if err != nil {
+		return "", fmt.Errorf("could not create temporary dump file: %w", err)
+	}
+	filteredPath := tmp.Name()
+	defer os.Remove(filteredPath)
+
+	var skipped []string
+	err = runPhase("Filtering database dump", func() error {
+		skipped, err = filterDumpFile(dumpPath, tmp, exclude)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("filtering %s: %w", dumpPath, err)
+	}
+	for _, pattern := range exclude {
+		if !matchesAnyTable(pattern, skipped) {
+			fmt.Fprintf(os.Stderr, "Warning: --db-exclude-tables %s matched no table with rows in the dump\n", pattern)
+		}
 	}
 
-	return "", fmt.Errorf("no 'name:' field found in %s or %s", localConfigPath, configPath)
+	if err := importDatabase(worktreePath, filteredPath, minFree, env); err != nil {
+		return "", err
+	}
+	if len(skipped) == 0 {
+		return " (no excluded tables found)", nil
+	}
+	return " (skipped rows of " + strings.Join(skipped, ", ") + ")", nil
 }
 
-func readDDEVName(path string) (string, error) {
+// filterDumpFile writes the dump at path, gzipped, to w without the rows of
+// the excluded tables. Only plain and gzipped SQL dumps can be filtered.
+func filterDumpFile(path string, w io.Writer, exclude []string) ([]string, error) {
+	if !sqlDumpPath(path) {
+		return nil, fmt.Errorf("--db-exclude-tables needs a .sql or .sql.gz dump")
+	}
 	f, err := os.Open(path)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "name: ") {
-			return strings.TrimPrefix(line, "name: "), nil
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
 		}
-	}
-	if err := scanner.Err(); err != nil {
-		return "", err
+		defer gz.Close()
+		r = gz
 	}
 
-	return "", fmt.Errorf("no 'name:' field found in %s", path)
-}
-
-func getDDEVProjectType(dir string) ProjectType {
-	configPath := filepath.Join(dir, ".ddev", "config.yaml")
-	f, err := os.Open(configPath)
+	gw := gzip.NewWriter(w)
+	skipped, err := filterDump(r, gw, exclude)
 	if err != nil {
-		return ProjectUnsupported
+		return nil, err
 	}
-	defer f.Close()
+	return skipped, gw.Close()
+}
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "type: ") {
-			value := strings.TrimPrefix(line, "type: ")
-			if strings.HasPrefix(value, "drupal") {
-				return ProjectDrupal
+// filterDump copies the SQL dump in r to w, dropping the data of the tables
+// matching the exclude patterns: mysqldump's INSERT lines and the rows of
+// pg_dump's COPY blocks. Table definitions are kept, so the tables exist but
+// are empty. Lines are streamed, however long an extended INSERT gets, and an
+// INSERT wrapped over several lines is followed to the line ending in ";". It
+// returns the tables whose rows were dropped, sorted.
+func filterDump(r io.Reader, w io.Writer, exclude []string) ([]string, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	bw := bufio.NewWriter(w)
+	dropped := map[string]bool{}
+	inCopy, dropCopy := false, false
+	inInsert, dropInsert := false, false
+
+	for {
+		// The start of the line decides whether the whole line is kept
+		head, err := br.Peek(512)
+		if len(head) == 0 {
+			if err != nil && err != io.EOF {
+				return nil, err
 			}
-			if strings.HasPrefix(value, "wordpress") {
-				return ProjectWordPress
+			break
+		}
+		line := string(head)
+		if i := strings.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+		}
+
+		drop := false
+		if inCopy {
+			drop = dropCopy
+			if strings.TrimRight(line, "\r") == `\.` {
+				inCopy = false
 			}
-			return ProjectUnsupported
+		} else if inInsert {
+			drop = dropInsert
+		} else if table, isCopy := dumpStatementTable(line); table != "" {
+			excluded := matchesTable(table, exclude)
+			if excluded {
+				dropped[table] = true
+			}
+			if isCopy {
+				inCopy, dropCopy = true, excluded
+			} else {
+				inInsert, dropInsert = true, excluded
+			}
+			drop = excluded
+		}
+
+		last, done, err := copyLine(br, bw, drop)
+		if err != nil {
+			return nil, err
+		}
+		if inInsert && last == ';' {
+			inInsert = false
+		}
+		if done {
+			break
 		}
 	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
 
-	return ProjectUnsupported
+	tables := make([]string, 0, len(dropped))
+	for table := range dropped {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables, nil
 }
 
-func createWorktree(projectRoot, name, baseBranch string) error {
-	// Ensure spaces/ directory exists
-	spacesDir := filepath.Join(projectRoot, "spaces")
-	if err := os.MkdirAll(spacesDir, 0755); err != nil {
-		return fmt.Errorf("could not create spaces directory: %w", err)
+// copyLine copies the next line from br to w, or discards it when drop is
+// set. It returns the line's last non-space byte (0 for a blank line) and
+// reports whether the input ended.
+func copyLine(br *bufio.Reader, w io.Writer, drop bool) (last byte, done bool, err error) {
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if !drop {
+			if _, werr := w.Write(chunk); werr != nil {
+				return 0, false, werr
+			}
+		}
+		if trimmed := bytes.TrimRight(chunk, " \t\r\n"); len(trimmed) > 0 {
+			last = trimmed[len(trimmed)-1]
+		}
+		switch err {
+		case nil:
+			return last, false, nil
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+			return last, true, nil
+		default:
+			return 0, false, err
+		}
+	}
+}
+
+// dumpStatementTable returns the table a dump line adds rows to, for
+// INSERT and REPLACE statements and COPY ... FROM stdin blocks (isCopy).
+// Other lines return "".
+func dumpStatementTable(line string) (table string, isCopy bool) {
+	rest, ok := "", false
+	for _, prefix := range []string{"INSERT INTO ", "INSERT IGNORE INTO ", "REPLACE INTO "} {
+		if rest, ok = strings.CutPrefix(line, prefix); ok {
+			break
+		}
+	}
+	if !ok {
+		if rest, ok = strings.CutPrefix(line, "COPY "); !ok || !strings.Contains(line, "FROM stdin") {
+			return "", false
+		}
+		isCopy = true
 	}
 
-	// Check if the branch already exists
-	checkCmd := exec.Command("git", "rev-parse", "--verify", name)
-	checkCmd.Dir = projectRoot
-	branchExists := checkCmd.Run() == nil
+	// The table name may end the line when the VALUES are wrapped
+	rest = strings.TrimRight(rest, "\r")
+	end := strings.IndexAny(rest, " (")
+	if end < 0 {
+		end = len(rest)
+	}
+	name := rest[:end]
+	// Schema-qualified names (public.cache) match on the table alone
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.Trim(name, "`\""), isCopy
+}
 
-	var gitArgs []string
-	if branchExists {
-		// Branch exists — check it out directly
-		gitArgs = []string{"worktree", "add", filepath.Join("spaces", name), name}
-	} else {
-		// Branch doesn't exist — create it
-		gitArgs = []string{"worktree", "add", "-b", name, filepath.Join("spaces", name)}
-		if baseBranch != "" {
-			gitArgs = append(gitArgs, "--no-track", baseBranch)
+func matchesTable(table string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, table); ok {
+			return true
 		}
 	}
-	cmd := exec.Command("git", gitArgs...)
-	cmd.Dir = projectRoot
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return false
 }
 
-func createDDEVLocalConfig(worktreePath, ddevName string) error {
-	localConfigPath := filepath.Join(worktreePath, ".ddev", "config.local.yaml")
-	content := "name: " + ddevName + "\n"
-	err := os.WriteFile(localConfigPath, []byte(content), 0644)
-	if err != nil {
-		return fmt.Errorf("could not write %s: %w", localConfigPath, err)
+func matchesAnyTable(pattern string, tables []string) bool {
+	for _, table := range tables {
+		if ok, _ := filepath.Match(pattern, table); ok {
+			return true
+		}
 	}
-	return nil
+	return false
 }
 
-func updateSettingsDdevPHP(settingsPath, ddevName string) error {
-	data, err := os.ReadFile(settingsPath)
+// importSpacePath returns where a database import's data lands, for the
+// free space check: Docker's data root when it is on this machine (native
+// Docker on Linux), else worktreePath. Docker Desktop keeps its data in a VM
+// disk that can't be measured from here.
+func importSpacePath(worktreePath string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, dockerBin, "info", "--format", "{{.DockerRootDir}}").Output()
 	if err != nil {
-		return fmt.Errorf("could not read %s: %w", settingsPath, err)
+		return worktreePath
 	}
+	if dir := strings.TrimSpace(string(out)); dir != "" && filepath.IsAbs(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return worktreePath
+}
 
-	content := string(data)
-
-	// Set $host to the new DDEV container name
-	hostRe := regexp.MustCompile(`\$host\s*=\s*["'].*?["']`)
-	newHost := `$host = "ddev-` + ddevName + `-db"`
-	if !hostRe.MatchString(content) {
-		return fmt.Errorf("could not find $host assignment in %s", settingsPath)
+// importDatabase imports dumpPath with ddev import-db. If the import fails
+// because the project has stopped (e.g. after a sleep/resume), DDEV is
+// started once, with env, and the import retried. It refuses to start
+// unless the disk Docker stores the database on (see importSpacePath) has
+// the dump's size plus minFree bytes available.
+func importDatabase(worktreePath, dumpPath string, minFree int64, env []string) error {
+	if info, err := os.Stat(dumpPath); err == nil && minFree > 0 {
+		if err := checkFreeSpace(importSpacePath(worktreePath), minFree+info.Size(), "the database import"); err != nil {
+			return withHints(err, "Free up space, or lower min_free_space in .workspace.yaml (0 disables the check).")
+		}
+	}
+	err := runPhase("Importing database", func() error {
+		return runCommandLive(ddevRoot(worktreePath), ddevBin, "import-db", "--file="+dumpPath)
+	})
+	if err == nil {
+		return nil
+	}
+	if desc, descErr := ddevDescribe(worktreePath); descErr == nil && desc.Status == "running" {
+		return err
 	}
-	content = hostRe.ReplaceAllLiteralString(content, newHost)
 
-	err = os.WriteFile(settingsPath, []byte(content), 0644)
-	if err != nil {
-		return fmt.Errorf("could not write %s: %w", settingsPath, err)
+	fmt.Fprintf(os.Stderr, "\nWarning: import failed and the DDEV project is not running; starting it and retrying\n")
+	if startErr := runPhase("Starting DDEV", func() error {
+		return runDDEVLocked(ddevRoot(worktreePath), env, "start")
+	}); startErr != nil {
+		return withKind(ErrDDEVFailed, fmt.Errorf("import failed (%v) and starting DDEV failed: %w", err, startErr))
 	}
+	return runPhase("Retrying database import", func() error {
+		return runCommandLive(ddevRoot(worktreePath), ddevBin, "import-db", "--file="+dumpPath)
+	})
+}
 
-	return nil
+// databaseReady reports whether the DDEV db container of the project in dir
+// accepts connections, for both MySQL/MariaDB and PostgreSQL images.
+func databaseReady(dir string) bool {
+	cmd := exec.Command(ddevBin, "exec", "-s", "db", "sh", "-c", "mysqladmin ping --silent 2>/dev/null || pg_isready -q 2>/dev/null")
+	cmd.Dir = ddevRoot(dir)
+	return cmd.Run() == nil
 }
 
-func runCommandLive(dir, name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	cmd.Dir = dir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	return cmd.Run()
+// pollUntil calls check every interval until it returns true or timeout
+// elapses, and returns how long it waited.
+func pollUntil(check func() bool, timeout, interval time.Duration) (time.Duration, error) {
+	start := time.Now()
+	for {
+		if check() {
+			return time.Since(start), nil
+		}
+		if time.Since(start)+interval > timeout {
+			return time.Since(start), fmt.Errorf("database not ready after %s", timeout)
+		}
+		time.Sleep(interval)
+	}
 }
 
-func handleDBImport(worktreePath, projectRoot string) (string, error) {
-	defaultPath := filepath.Join(projectRoot, "db", "db.sql.gz")
+// verifyDump checks a database dump before it is imported. When a sidecar
+// <path>.sha256 exists the dump must match it; otherwise .gz dumps are fully
+// decompressed to catch truncated downloads.
+func verifyDump(path string) error {
+	sumPath := path + ".sha256"
+	if data, err := os.ReadFile(sumPath); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) == 0 {
+			return fmt.Errorf("%s is empty", sumPath)
+		}
+		if err := verifyFileChecksum(path, strings.ToLower(fields[0])); err != nil {
+			return err
+		}
+		out, _ := outputWriters()
+		fmt.Fprintln(out, "Checksum verified")
+		return nil
+	}
 
-	if _, err := os.Stat(defaultPath); err == nil {
-		fmt.Printf("\nFound database dump at %s\n", defaultPath)
-		fmt.Println("--- Importing database ---")
-		err := runCommandLive(worktreePath, "ddev", "import-db", "--file="+defaultPath)
-		if err != nil {
-			return "", err
+	if !strings.HasSuffix(path, ".gz") {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err == nil {
+		_, err = io.Copy(io.Discard, gz)
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed the gzip integrity check (truncated or corrupt?): %w", path, err)
+	}
+	return nil
+}
+
+// copyDatabase exports the database of the workspace at sourcePath and
+// imports it into the workspace at targetPath. The source project is started
+// first if it is not running, since ddev export-db needs the container.
+func copyDatabase(sourcePath, targetPath string) (string, error) {
+	if desc, err := ddevDescribe(sourcePath); err != nil || desc.Status != "running" {
+		if err := runPhase("Starting source DDEV project", func() error {
+			return runDDEVLocked(ddevRoot(sourcePath), nil, "start")
+		}); err != nil {
+			return "", fmt.Errorf("could not start %s: %w", filepath.Base(sourcePath), err)
 		}
-		return "Imported from " + defaultPath, nil
 	}
 
-	// Prompt user
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("\nNo database dump found at db/db.sql.gz\n")
-	fmt.Print("Enter path to database dump (or press Enter to skip): ")
-	input, err := reader.ReadString('\n')
+	tmp, err := os.CreateTemp("", "workspace-db-*.sql.gz")
 	if err != nil {
-		return "", fmt.Errorf("error reading input: %w", err)
+		return "", fmt.Errorf("could not create temporary dump file: %w", err)
+	}
+	dumpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(dumpPath)
+
+	if err := runPhase("Exporting database from "+filepath.Base(sourcePath), func() error {
+		return runCommandLive(ddevRoot(sourcePath), ddevBin, "export-db", "--file="+dumpPath)
+	}); err != nil {
+		return "", fmt.Errorf("export from %s failed: %w", filepath.Base(sourcePath), err)
 	}
-	input = strings.TrimSpace(input)
 
-	if input == "" {
-		return "Skipped (no import)", nil
+	if err := runPhase("Importing database", func() error {
+		return runCommandLive(ddevRoot(targetPath), ddevBin, "import-db", "--file="+dumpPath)
+	}); err != nil {
+		return "", err
 	}
+	return "Imported from workspace " + filepath.Base(sourcePath), nil
+}
 
-	// Resolve the path
-	if !filepath.IsAbs(input) {
-		cwd, err := os.Getwd()
-		if err != nil {
-			return "", fmt.Errorf("error getting working directory: %w", err)
+// pauseBeforeCleanup lets new --pause-on-error inspect a failed setup
+// before it is torn down: open a shell in the worktree (as often as
+// needed), keep everything, or clean up. It reports whether to clean up.
+// Without a terminal to ask on, or at end of input, it cleans up.
+func pauseBeforeCleanup(state *cleanupState) bool {
+	if !stdinIsTerminal() {
+		fmt.Fprintf(os.Stderr, "\nWarning: --pause-on-error needs a terminal on stdin; cleaning up\n")
+		return true
+	}
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprintf(os.Stderr, "\nSetup failed. Open a shell to investigate? [s]hell / [c]leanup / [k]eep: ")
+		input, err := reader.ReadString('\n')
+		if err != nil && strings.TrimSpace(input) == "" {
+			fmt.Fprintln(os.Stderr)
+			return true
+		}
+		switch pauseChoice(input) {
+		case "shell":
+			dir := state.worktreePath
+			if _, err := os.Stat(dir); err != nil {
+				dir = state.projectRoot
+			} else {
+				dir = ddevRoot(dir)
+			}
+			fmt.Fprintf(os.Stderr, "Opening a shell in %s; exit it to return here.\n", dir)
+			if err := runInteractiveShell(dir); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: shell: %v\n", err)
+			}
+		case "keep":
+			fmt.Fprintf(os.Stderr, "\nKept %s", state.worktreePath)
+			if state.ddevName != "" {
+				fmt.Fprintf(os.Stderr, " and DDEV project %s", state.ddevName)
+			}
+			fmt.Fprintf(os.Stderr, ".\nRemove it when done with: workspace remove %s\n", filepath.Base(state.worktreePath))
+			return false
+		case "cleanup":
+			return true
+		default:
+			fmt.Fprintf(os.Stderr, "Please answer s, c, or k.\n")
 		}
-		input = filepath.Join(cwd, input)
 	}
+}
 
-	if _, err := os.Stat(input); err != nil {
-		return "", fmt.Errorf("file not found: %s", input)
+// pauseChoice maps an answer to the --pause-on-error prompt to shell,
+// cleanup, or keep, or "" when it is none of them.
+func pauseChoice(input string) string {
+	switch strings.ToLower(strings.TrimSpace(input)) {
+	case "s", "shell":
+		return "shell"
+	case "c", "cleanup":
+		return "cleanup"
+	case "k", "keep":
+		return "keep"
 	}
+	return ""
+}
 
-	fmt.Println("--- Importing database ---")
-	err = runCommandLive(worktreePath, "ddev", "import-db", "--file="+input)
-	if err != nil {
-		return "", err
+// runInteractiveShell runs the user's shell ($SHELL, or %ComSpec% on
+// Windows) in dir on the terminal, until it exits.
+func runInteractiveShell(dir string) error {
+	shell := os.Getenv("SHELL")
+	if runtime.GOOS == "windows" {
+		shell = os.Getenv("ComSpec")
+		if shell == "" {
+			shell = "cmd"
+		}
+	} else if shell == "" {
+		shell = "sh"
+	}
+	cmd := exec.Command(shell)
+	cmd.Dir = dir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout, cmd.Stderr = outputWriters()
+	return cmd.Run()
+}
+
+// shellCommand returns how to run command through the platform's shell.
+func shellCommand(command string) (string, []string) {
+	if runtime.GOOS == "windows" {
+		return "cmd", []string{"/C", command}
+	}
+	return "sh", []string{"-c", command}
+}
+
+// runPostImportCommand runs the configured post-import shell command in the
+// worktree with live output. A failure is reported as a warning step rather
+// than aborting, since the database itself was imported successfully.
+func runPostImportCommand(worktreePath, command string, env []string) StepResult {
+	shell, shellArgs := shellCommand(command)
+	if err := runPhase("Running post-import command", func() error {
+		return runCommandLiveEnv(worktreePath, env, shell, shellArgs...)
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "\nWarning: post-import command failed: %v\n", err)
+		return StepResult{
+			Description: "Post-import command",
+			Detail:      fmt.Sprintf("Failed: %v", err),
+		}
+	}
+	return StepResult{
+		Description: "Post-import command",
+		Detail:      command,
 	}
-	return "Imported from " + input, nil
 }
 
 func linkProjectFiles(worktreePath, projectRoot string, projectType ProjectType) (string, error) {
 	var dest string
 	switch projectType {
 	case ProjectDrupal:
-		dest = filepath.Join(worktreePath, "web", "sites", "default", "files")
+		dest = filepath.Join(ddevRoot(worktreePath), "web", "sites", "default", "files")
 	case ProjectWordPress:
-		dest = filepath.Join(worktreePath, "web", "wp-content", "uploads")
+		dest = filepath.Join(ddevRoot(worktreePath), "web", "wp-content", "uploads")
 	default:
 		return "Skipped (unsupported project type)", nil
 	}
@@ -1390,6 +10329,14 @@ func linkProjectFiles(worktreePath, projectRoot string, projectType ProjectType)
 	return fmt.Sprintf("Linked %s → %s", dest, relPath), nil
 }
 
+// claudeProjectDirName encodes an absolute path the way Claude Code names
+// its per-project directories: separators (and a Windows drive colon)
+// become "-", so /home/me/proj is -home-me-proj and C:\Users\me\proj is
+// C--Users-me-proj.
+func claudeProjectDirName(path string) string {
+	return strings.NewReplacer("/", "-", "\\", "-", ":", "-").Replace(path)
+}
+
 // linkClaudeMemory creates a symlink so that a worktree shares Claude Code memory
 // with the project root. Claude stores project memory at ~/.claude/projects/<encoded-path>/memory/
 // where the encoded path replaces "/" with "-". This function symlinks the worktree's
@@ -1410,14 +10357,9 @@ func linkClaudeMemory(worktreePath, projectRoot string) (string, error) {
     return "", fmt.Errorf("could not resolve project root path: %w", err)
   }
 
-  // Claude encodes paths by replacing "/" with "-"
-  encodePath := func(p string) string {
-    return strings.ReplaceAll(p, string(filepath.Separator), "-")
-  }
-
   claudeProjectsDir := filepath.Join(home, ".claude", "projects")
-  rootMemoryDir := filepath.Join(claudeProjectsDir, encodePath(absRoot), "memory")
-  worktreeClaudeDir := filepath.Join(claudeProjectsDir, encodePath(absWorktree))
+  rootMemoryDir := filepath.Join(claudeProjectsDir, claudeProjectDirName(absRoot), "memory")
+  worktreeClaudeDir := filepath.Join(claudeProjectsDir, claudeProjectDirName(absWorktree))
   worktreeMemoryDir := filepath.Join(worktreeClaudeDir, "memory")
 
   // Ensure the root memory directory exists
@@ -1469,35 +10411,268 @@ func linkClaudeMemory(worktreePath, projectRoot string) (string, error) {
   return fmt.Sprintf("Linked Claude memory → %s", rootMemoryDir), nil
 }
 
-func printSummary(steps []StepResult) {
-	fmt.Println("=== Workspace Setup Complete ===")
-	fmt.Println()
+// renderSummary prints the "=== <title> Complete ===" block that every
+// command ends with, one aligned line per step. It goes through
+// outputWriters so --log files get a copy.
+func renderSummary(title string, steps []StepResult) {
+	out, _ := outputWriters()
+	fmt.Fprintf(out, "=== %s Complete ===\n", title)
+	fmt.Fprintln(out)
+	writeSteps(out, "  ", steps)
+	fmt.Fprintln(out)
+}
+
+// writeSteps writes steps one per line, with the durations of timed steps
+// lined up in a column after the widest of their details.
+func writeSteps(w io.Writer, indent string, steps []StepResult) {
+	width := 0
 	for _, step := range steps {
-		fmt.Printf("  %-25s %s\n", step.Description+":", step.Detail)
+		if step.Duration > 0 {
+			width = max(width, utf8.RuneCountInString(step.Detail))
+		}
 	}
-	fmt.Println()
+	for _, step := range steps {
+		if len(step.Steps) > 0 {
+			fmt.Fprintf(w, "%s%s:\n", indent, step.Description)
+			writeSteps(w, indent+"  ", step.Steps)
+			fmt.Fprintln(w)
+			continue
+		}
+		if step.Duration > 0 {
+			padding := strings.Repeat(" ", width-utf8.RuneCountInString(step.Detail))
+			fmt.Fprintf(w, "%s%-25s %s%s  %s\n", indent, step.Description+":", step.Detail, padding, formatDuration(step.Duration))
+			continue
+		}
+		fmt.Fprintf(w, "%s%-25s %s\n", indent, step.Description+":", step.Detail)
+	}
+}
+
+// ProgressEvent reports a phase of the running operation (init, new,
+// remove) starting or finishing, for consumers such as a GUI wrapper that
+// shows live progress. Finished events carry the phase's status and, when
+// it failed, the error, and how long the phase took.
+type ProgressEvent struct {
+	Operation  string    `json:"operation"`
+	Phase      string    `json:"phase"`
+	Event      string    `json:"event"`
+	Status     string    `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// ProgressEvent kinds and finished statuses.
+const (
+	progressStarted  = "started"
+	progressFinished = "finished"
+	phaseOK          = "ok"
+	phaseFailed      = "failed"
+)
+
+// ProgressHandler receives progress events as they happen.
+type ProgressHandler func(ProgressEvent)
+
+// progressHandler receives the events of runPhase; the default prints the
+// "--- Phase ---" banners. progressOperation names the running operation,
+// and progressOutput is where its output goes (see outputWriters).
+var (
+	progressHandler   ProgressHandler = printPhaseBanner
+	progressOperation string
+	progressOutput    io.Writer
+)
+
+// printPhaseBanner is the CLI's progress handler: a banner when a phase
+// starts, so the output of the commands it runs can be told apart.
+func printPhaseBanner(event ProgressEvent) {
+	if event.Event == progressStarted {
+		out, _ := outputWriters()
+		fmt.Fprintf(out, "\n--- %s ---\n", event.Phase)
+	}
+}
+
+// jsonProgressHandler returns a handler that writes each event to w as a
+// line of JSON, in addition to printing the banners.
+func jsonProgressHandler(w io.Writer) ProgressHandler {
+	enc := json.NewEncoder(w)
+	return func(event ProgressEvent) {
+		printPhaseBanner(event)
+		_ = enc.Encode(event)
+	}
+}
+
+// startProgress sets up the events of operation; with a path
+// (--progress-json) they are also written there as JSON lines. The
+// operation's output, banners included, goes to out (nil for the standard
+// output). The returned function closes the file and resets both.
+func startProgress(operation, path string, out io.Writer) (func(), error) {
+	progressOperation = operation
+	progressOutput = out
+	if path == "" {
+		return func() { progressOutput = nil }, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		progressOutput = nil
+		return nil, fmt.Errorf("opening --progress-json %s: %w", path, err)
+	}
+	progressHandler = jsonProgressHandler(f)
+	return func() {
+		progressHandler = printPhaseBanner
+		progressOutput = nil
+		f.Close()
+	}, nil
+}
+
+// runPhase reports phase as started, runs fn, and reports it as finished
+// with fn's outcome, which it returns.
+func runPhase(phase string, fn func() error) error {
+	start := time.Now()
+	progressHandler(ProgressEvent{Operation: progressOperation, Phase: phase, Event: progressStarted, Time: start})
+	err := fn()
+	event := ProgressEvent{Operation: progressOperation, Phase: phase, Event: progressFinished, Status: phaseOK, Time: time.Now()}
+	event.DurationMS = event.Time.Sub(start).Milliseconds()
+	if err != nil {
+		event.Status, event.Error = phaseFailed, err.Error()
+	}
+	progressHandler(event)
+	return err
+}
+
+// stepDuration is how long a summary step that started at start took, for
+// the timing column of new --trace; without trace it is 0, so the summary
+// has no column.
+func stepDuration(trace bool, start time.Time) time.Duration {
+	if !trace {
+		return 0
+	}
+	return time.Since(start)
+}
+
+// withTotal ends a --trace summary with the total time of the operation
+// that started at start.
+func withTotal(trace bool, steps []StepResult, start time.Time) []StepResult {
+	if !trace {
+		return steps
+	}
+	return append(steps, StepResult{Description: "Total", Duration: time.Since(start)})
+}
+
+// formatDuration rounds d for display: milliseconds below a second, tenths
+// of a second above.
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+// outputWriters returns where the running operation's output and its
+// subprocesses' go: the writer given to startProgress (stderr for new
+// --print-path), else the current standard streams, which an operation log
+// tees (see openOperationLog).
+func outputWriters() (stdout, stderr io.Writer) {
+	if progressOutput != nil {
+		return progressOutput, os.Stderr
+	}
+	return os.Stdout, os.Stderr
+}
+
+// logDrainTimeout bounds how long closing an operation log waits for the
+// teed output: a daemon a command started may hold the stream open.
+const logDrainTimeout = 2 * time.Second
+
+// openOperationLog creates the log file for an operation (new --log-file /
+// --log) and tees stdout and stderr into it until the returned function is
+// called, so phase banners, warnings, subprocess output, and the summary all
+// land there as well as on the terminal. An empty path means
+// projectRoot/.workspace/logs/<operation>-<timestamp>.log. The returned
+// function records the operation's error, if any, restores the standard
+// streams, and closes the log; callers defer it.
+func openOperationLog(projectRoot, operation, path string) (string, func(error), error) {
+	if path == "" {
+		path = filepath.Join(projectRoot, ".workspace", "logs", operation+"-"+time.Now().Format("20060102-150405")+".log")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", nil, fmt.Errorf("could not create log directory: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not create log file: %w", err)
+	}
+	fmt.Fprintf(f, "# workspace %s\n# %s\n\n", strings.Join(os.Args[1:], " "), time.Now().Format(time.RFC3339))
+
+	stdout, stderr := os.Stdout, os.Stderr
+	var drained sync.WaitGroup
+	tee := func(to *os.File) (*os.File, error) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		drained.Add(1)
+		go func() {
+			defer drained.Done()
+			_, _ = io.Copy(io.MultiWriter(to, f), r)
+		}()
+		return w, nil
+	}
+	outW, err := tee(stdout)
+	if err != nil {
+		f.Close()
+		return "", nil, fmt.Errorf("could not tee output into the log: %w", err)
+	}
+	errW, err := tee(stderr)
+	if err != nil {
+		outW.Close()
+		f.Close()
+		return "", nil, fmt.Errorf("could not tee output into the log: %w", err)
+	}
+	os.Stdout, os.Stderr = outW, errW
+
+	closeLog := func(opErr error) {
+		os.Stdout, os.Stderr = stdout, stderr
+		outW.Close()
+		errW.Close()
+		done := make(chan struct{})
+		go func() {
+			drained.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(logDrainTimeout):
+		}
+		if opErr != nil {
+			fmt.Fprintln(f)
+			reportError(f, opErr)
+		}
+		f.Close()
+	}
+	return path, closeLog, nil
 }
 
 func cleanup(state *cleanupState) {
+	if state.pauseOnError && (state.worktreeCreated || state.ddevStarted) && !pauseBeforeCleanup(state) {
+		return
+	}
 	fmt.Fprintf(os.Stderr, "\n--- Cleaning up ---\n")
 
 	if state.ddevStarted && state.ddevName != "" {
 		fmt.Fprintf(os.Stderr, "Deleting DDEV project...\n")
-		cmd := exec.Command("ddev", "delete", "-O", "-y", state.ddevName)
+		cmd := exec.Command(ddevBin, "delete", "-O", "-y", state.ddevName)
 		cmd.Dir = state.worktreePath
-		cmd.Stdout = os.Stderr
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
+		_, cmd.Stderr = outputWriters()
+		cmd.Stdout = cmd.Stderr
+		if err := withDDEVLock(cmd.Run); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: failed to delete DDEV project: %v\n", err)
 		}
 	}
 
 	if state.worktreeCreated {
 		fmt.Fprintf(os.Stderr, "Removing git worktree...\n")
-		cmd := exec.Command("git", "worktree", "remove", "--force", state.worktreePath)
+		cmd := exec.Command(gitBin, "worktree", "remove", "--force", state.worktreePath)
 		cmd.Dir = state.projectRoot
-		cmd.Stdout = os.Stderr
-		cmd.Stderr = os.Stderr
+		_, cmd.Stderr = outputWriters()
+		cmd.Stdout = cmd.Stderr
 		if err := cmd.Run(); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: failed to remove worktree: %v\n", err)
 		}